@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// interruptSignal 发送给播放线程的打断信号
+type interruptSignal struct {
+	// Source 打断来源: "vad"、"model" 或 "text"
+	Source string
+	// ContentID 被打断的音频内容块，为空表示当前正在播放的内容
+	ContentID string
+	// Announce 是否发布 BargeInEvent（重复的打断只清空缓冲）
+	Announce bool
+}
+
+// PlaybackCut 一次打断发生时的播放位置
+type PlaybackCut struct {
+	At        time.Time
+	Source    string
+	ContentID string
+	// Played 用户实际听到的时长
+	Played time.Duration
+	// Received 被打断时该内容已收到的音频时长
+	Received time.Duration
+	// FullText 模型计划说出的完整文本
+	FullText string
+	// HeardText 按播放比例估算的用户实际听到的文本
+	HeardText string
+}
+
+// replyTracker 记录当前 AI 回复的文本，用于在打断时估算用户听到了多少
+type replyTracker struct {
+	mu      sync.Mutex
+	text    strings.Builder
+	lastCut *PlaybackCut
+}
+
+// Reset 新的一轮回复开始
+func (r *replyTracker) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.text.Reset()
+	r.lastCut = nil
+}
+
+// AddText 追加模型计划说出的文本
+func (r *replyTracker) AddText(text string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.text.WriteString(text)
+}
+
+// Cut 记录打断位置，并按已播放/已收到的比例截断文本
+func (r *replyTracker) Cut(source, contentID string, played, received time.Duration) PlaybackCut {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	full := r.text.String()
+	cut := PlaybackCut{
+		At:        time.Now(),
+		Source:    source,
+		ContentID: contentID,
+		Played:    played,
+		Received:  received,
+		FullText:  full,
+		HeardText: heardPrefix(full, played, received),
+	}
+	r.lastCut = &cut
+	return cut
+}
+
+// LastCut 获取本轮回复最近一次打断，未被打断返回 nil
+func (r *replyTracker) LastCut() *PlaybackCut {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lastCut == nil {
+		return nil
+	}
+	cut := *r.lastCut
+	return &cut
+}
+
+// heardPrefix 按播放比例截取文本前缀，被截断时以省略号结尾
+func heardPrefix(text string, played, received time.Duration) string {
+	if received <= 0 || played >= received {
+		return text
+	}
+	if played <= 0 {
+		return ""
+	}
+	runes := []rune(text)
+	n := int(float64(len(runes)) * played.Seconds() / received.Seconds())
+	if n >= len(runes) {
+		return text
+	}
+	return string(runes[:n]) + "…"
+}
+
+// isInterruptedMarker 判断 textOutput 是否为模型发出的打断标记 {"interrupted": true}
+func isInterruptedMarker(content string) bool {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "{") {
+		return false
+	}
+	var marker struct {
+		Interrupted bool `json:"interrupted"`
+	}
+	if err := json.Unmarshal([]byte(content), &marker); err != nil {
+		return false
+	}
+	return marker.Interrupted
+}
+
+// playbackQueue 播放缓冲：16-bit PCM 数据，以及每段数据所属的内容块
+// 打断时只丢弃被打断内容块的音频，不影响之后到达的新回复
+type playbackQueue struct {
+	data     []byte
+	segments []playbackSegment
+}
+
+// playbackSegment 缓冲中属于同一内容块的一段连续数据，提示音的 contentID 为空
+type playbackSegment struct {
+	contentID string
+	size      int
+}
+
+// Len 缓冲中的字节数
+func (q *playbackQueue) Len() int {
+	return len(q.data)
+}
+
+// Push 追加一段 PCM 数据
+func (q *playbackQueue) Push(contentID string, pcm []byte) {
+	if len(pcm) == 0 {
+		return
+	}
+	q.data = append(q.data, pcm...)
+	if n := len(q.segments); n > 0 && q.segments[n-1].contentID == contentID {
+		q.segments[n-1].size += len(pcm)
+		return
+	}
+	q.segments = append(q.segments, playbackSegment{contentID: contentID, size: len(pcm)})
+}
+
+// Pop 取出最多 n 字节写入 out，返回实际取出的字节数
+func (q *playbackQueue) Pop(out []byte, n int) int {
+	n = min(n, len(q.data), len(out))
+	copy(out, q.data[:n])
+	q.data = q.data[n:]
+	for left := n; left > 0 && len(q.segments) > 0; {
+		seg := &q.segments[0]
+		if seg.size > left {
+			seg.size -= left
+			break
+		}
+		left -= seg.size
+		q.segments = q.segments[1:]
+	}
+	return n
+}
+
+// Pending 缓冲中属于 contentID 的字节数
+func (q *playbackQueue) Pending(contentID string) int {
+	total := 0
+	for _, seg := range q.segments {
+		if seg.contentID == contentID {
+			total += seg.size
+		}
+	}
+	return total
+}
+
+// Drop 丢弃属于 contentID 的数据，返回丢弃的字节数
+func (q *playbackQueue) Drop(contentID string) int {
+	dropped := 0
+	kept := q.data[:0:0]
+	segments := q.segments[:0]
+	offset := 0
+	for _, seg := range q.segments {
+		if seg.contentID == contentID {
+			dropped += seg.size
+		} else {
+			kept = append(kept, q.data[offset:offset+seg.size]...)
+			segments = append(segments, seg)
+		}
+		offset += seg.size
+	}
+	q.data = kept
+	q.segments = segments
+	return dropped
+}
+
+// Clear 丢弃全部数据
+func (q *playbackQueue) Clear() {
+	q.data = nil
+	q.segments = nil
+}
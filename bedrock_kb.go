@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+)
+
+// agentRuntimeTimeout 单次调用 Bedrock 知识库或 Agent 的超时，模型在等待工具结果时用户听不到任何声音
+const agentRuntimeTimeout = 15 * time.Second
+
+// Bedrock 知识库和 Agent 工具的名称
+const (
+	BedrockKnowledgeBaseToolName = "search_bedrock_knowledge_base"
+	KnowledgeAnswerToolName      = "ask_knowledge_base"
+	BedrockAgentToolName         = "ask_agent"
+)
+
+// 知识库工具的工作方式
+const (
+	// KnowledgeBaseModeRetrieve Retrieve：返回相关段落，由 Sonic 组织回答
+	KnowledgeBaseModeRetrieve = "retrieve"
+	// KnowledgeBaseModeGenerate RetrieveAndGenerate：由知识库配置的模型生成带引用的回答
+	KnowledgeBaseModeGenerate = "generate"
+)
+
+// Answer 知识库或 Agent 生成的回答
+type Answer struct {
+	Text    string   `json:"answer"`
+	Sources []string `json:"sources,omitempty"`
+}
+
+// AnswerGenerator 根据问题生成回答（RetrieveAndGenerate、InvokeAgent）
+type AnswerGenerator interface {
+	Answer(ctx context.Context, question string) (Answer, error)
+}
+
+// BedrockKnowledgeBase Bedrock 知识库：Retrieve 实现 Retriever，RetrieveAndGenerate 实现 AnswerGenerator
+type BedrockKnowledgeBase struct {
+	client          *bedrockagentruntime.Client
+	knowledgeBaseID string
+	// modelARN RetrieveAndGenerate 使用的模型
+	modelARN string
+
+	// sessionID RetrieveAndGenerate 返回的会话，后续提问沿用以理解上下文
+	mu        sync.Mutex
+	sessionID string
+}
+
+// NewBedrockKnowledgeBase 创建 Bedrock 知识库，只用 Retrieve 时 modelARN 可以为空
+func NewBedrockKnowledgeBase(client *bedrockagentruntime.Client, knowledgeBaseID, modelARN string) *BedrockKnowledgeBase {
+	return &BedrockKnowledgeBase{client: client, knowledgeBaseID: knowledgeBaseID, modelARN: modelARN}
+}
+
+// Retrieve 调用 Retrieve 返回最相关的 topK 段文本
+func (kb *BedrockKnowledgeBase) Retrieve(ctx context.Context, query string, topK int) ([]Passage, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("检索内容为空")
+	}
+	if topK <= 0 {
+		topK = defaultRetrieveTopK
+	}
+	ctx, cancel := context.WithTimeout(ctx, agentRuntimeTimeout)
+	defer cancel()
+
+	output, err := kb.client.Retrieve(ctx, &bedrockagentruntime.RetrieveInput{
+		KnowledgeBaseId: aws.String(kb.knowledgeBaseID),
+		RetrievalQuery:  &types.KnowledgeBaseQuery{Text: aws.String(query)},
+		RetrievalConfiguration: &types.KnowledgeBaseRetrievalConfiguration{
+			VectorSearchConfiguration: &types.KnowledgeBaseVectorSearchConfiguration{
+				NumberOfResults: aws.Int32(int32(topK)),
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("调用知识库 Retrieve 失败: %w", err)
+	}
+
+	passages := make([]Passage, 0, len(output.RetrievalResults))
+	for _, result := range output.RetrievalResults {
+		if result.Content == nil || aws.ToString(result.Content.Text) == "" {
+			continue
+		}
+		passages = append(passages, Passage{
+			Source: retrievalSource(result.Location),
+			Text:   aws.ToString(result.Content.Text),
+			Score:  aws.ToFloat64(result.Score),
+		})
+	}
+	return passages, nil
+}
+
+// Answer 调用 RetrieveAndGenerate 生成回答，附带引用的来源
+func (kb *BedrockKnowledgeBase) Answer(ctx context.Context, question string) (Answer, error) {
+	if strings.TrimSpace(question) == "" {
+		return Answer{}, fmt.Errorf("问题为空")
+	}
+	ctx, cancel := context.WithTimeout(ctx, agentRuntimeTimeout)
+	defer cancel()
+
+	input := &bedrockagentruntime.RetrieveAndGenerateInput{
+		Input: &types.RetrieveAndGenerateInput{Text: aws.String(question)},
+		RetrieveAndGenerateConfiguration: &types.RetrieveAndGenerateConfiguration{
+			Type: types.RetrieveAndGenerateTypeKnowledgeBase,
+			KnowledgeBaseConfiguration: &types.KnowledgeBaseRetrieveAndGenerateConfiguration{
+				KnowledgeBaseId: aws.String(kb.knowledgeBaseID),
+				ModelArn:        aws.String(kb.modelARN),
+			},
+		},
+	}
+	kb.mu.Lock()
+	if kb.sessionID != "" {
+		input.SessionId = aws.String(kb.sessionID)
+	}
+	kb.mu.Unlock()
+
+	output, err := kb.client.RetrieveAndGenerate(ctx, input)
+	if err != nil {
+		return Answer{}, fmt.Errorf("调用知识库 RetrieveAndGenerate 失败: %w", err)
+	}
+	kb.mu.Lock()
+	kb.sessionID = aws.ToString(output.SessionId)
+	kb.mu.Unlock()
+
+	answer := Answer{}
+	if output.Output != nil {
+		answer.Text = aws.ToString(output.Output.Text)
+	}
+	seen := make(map[string]bool)
+	for _, citation := range output.Citations {
+		for _, ref := range citation.RetrievedReferences {
+			if source := retrievalSource(ref.Location); source != "" && !seen[source] {
+				seen[source] = true
+				answer.Sources = append(answer.Sources, source)
+			}
+		}
+	}
+	return answer, nil
+}
+
+// retrievalSource 检索结果的来源位置（S3 URI、网页 URL 等）
+func retrievalSource(loc *types.RetrievalResultLocation) string {
+	if loc == nil {
+		return ""
+	}
+	switch {
+	case loc.S3Location != nil:
+		return aws.ToString(loc.S3Location.Uri)
+	case loc.WebLocation != nil:
+		return aws.ToString(loc.WebLocation.Url)
+	case loc.ConfluenceLocation != nil:
+		return aws.ToString(loc.ConfluenceLocation.Url)
+	case loc.SharePointLocation != nil:
+		return aws.ToString(loc.SharePointLocation.Url)
+	case loc.SalesforceLocation != nil:
+		return aws.ToString(loc.SalesforceLocation.Url)
+	case loc.KendraDocumentLocation != nil:
+		return aws.ToString(loc.KendraDocumentLocation.Uri)
+	case loc.CustomDocumentLocation != nil:
+		return aws.ToString(loc.CustomDocumentLocation.Id)
+	default:
+		return string(loc.Type)
+	}
+}
+
+// BedrockAgent 通过 InvokeAgent 调用 Bedrock Agent，实现 AnswerGenerator
+// 同一个 BedrockAgent 的调用使用同一个 Agent 会话，Agent 能记住之前的问题
+type BedrockAgent struct {
+	client    *bedrockagentruntime.Client
+	agentID   string
+	aliasID   string
+	sessionID string
+}
+
+// NewBedrockAgent 创建 Bedrock Agent，sessionID 为 Agent 会话 ID
+func NewBedrockAgent(client *bedrockagentruntime.Client, agentID, aliasID, sessionID string) *BedrockAgent {
+	return &BedrockAgent{client: client, agentID: agentID, aliasID: aliasID, sessionID: sessionID}
+}
+
+// Answer 把问题发给 Agent 并收集流式返回的回答
+func (a *BedrockAgent) Answer(ctx context.Context, question string) (Answer, error) {
+	if strings.TrimSpace(question) == "" {
+		return Answer{}, fmt.Errorf("问题为空")
+	}
+	ctx, cancel := context.WithTimeout(ctx, agentRuntimeTimeout)
+	defer cancel()
+
+	output, err := a.client.InvokeAgent(ctx, &bedrockagentruntime.InvokeAgentInput{
+		AgentId:      aws.String(a.agentID),
+		AgentAliasId: aws.String(a.aliasID),
+		SessionId:    aws.String(a.sessionID),
+		InputText:    aws.String(question),
+	})
+	if err != nil {
+		return Answer{}, fmt.Errorf("调用 InvokeAgent 失败: %w", err)
+	}
+	stream := output.GetStream()
+	defer stream.Close()
+
+	var text strings.Builder
+	answer := Answer{}
+	seen := make(map[string]bool)
+	for event := range stream.Events() {
+		chunk, ok := event.(*types.ResponseStreamMemberChunk)
+		if !ok {
+			continue
+		}
+		text.Write(chunk.Value.Bytes)
+		if chunk.Value.Attribution == nil {
+			continue
+		}
+		for _, citation := range chunk.Value.Attribution.Citations {
+			for _, ref := range citation.RetrievedReferences {
+				if source := retrievalSource(ref.Location); source != "" && !seen[source] {
+					seen[source] = true
+					answer.Sources = append(answer.Sources, source)
+				}
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return Answer{}, fmt.Errorf("读取 Agent 回答失败: %w", err)
+	}
+	answer.Text = strings.TrimSpace(text.String())
+	return answer, nil
+}
+
+// answerToolSchema 问答工具输入的 JSON Schema
+const answerToolSchema = `{
+  "type": "object",
+  "properties": {
+    "question": {"type": "string", "description": "用户的问题，补全上下文后的完整问句"}
+  },
+  "required": ["question"]
+}`
+
+// AnswerTool 把 AnswerGenerator 作为工具提供给模型，结果为生成的回答和来源
+type AnswerTool struct {
+	generator   AnswerGenerator
+	name        string
+	description string
+}
+
+// NewAnswerTool 创建问答工具
+func NewAnswerTool(name, description string, generator AnswerGenerator) *AnswerTool {
+	return &AnswerTool{generator: generator, name: name, description: description}
+}
+
+// Spec 工具定义
+func (t *AnswerTool) Spec() ToolSpec {
+	return ToolSpec{
+		Name:        t.name,
+		Description: t.description,
+		InputSchema: ToolInputSchema{JSON: answerToolSchema},
+	}
+}
+
+// Invoke 生成回答
+func (t *AnswerTool) Invoke(ctx context.Context, input json.RawMessage) (interface{}, error) {
+	var in struct {
+		Question string `json:"question"`
+	}
+	if err := json.Unmarshal(input, &in); err != nil {
+		return nil, fmt.Errorf("解析工具参数失败: %w", err)
+	}
+	return t.generator.Answer(ctx, in.Question)
+}
+
+// BedrockToolsConfig Bedrock 知识库和 Agent 工具的配置
+type BedrockToolsConfig struct {
+	// KnowledgeBaseID 知识库 ID，为空时不注册知识库工具
+	KnowledgeBaseID string
+	// Mode retrieve（默认）或 generate
+	Mode string
+	// ModelARN generate 模式生成回答的模型
+	ModelARN string
+	// AgentID / AgentAliasID Bedrock Agent，为空时不注册 Agent 工具
+	AgentID      string
+	AgentAliasID string
+}
+
+// ParseBedrockAgent 解析 "<agentId>:<aliasId>" 形式的 Agent 配置
+func ParseBedrockAgent(spec string) (agentID, aliasID string, err error) {
+	agentID, aliasID, ok := strings.Cut(strings.TrimSpace(spec), ":")
+	if !ok || agentID == "" || aliasID == "" {
+		return "", "", fmt.Errorf("无效的 Bedrock Agent %q，应为 <agentId>:<aliasId>", spec)
+	}
+	return agentID, aliasID, nil
+}
+
+// registerBedrockTools 按配置注册 Bedrock 知识库和 Agent 工具
+// retriever / generator 不为空时直接注册为知识库工具，代替按 KnowledgeBaseID 创建的 Bedrock 实现（测试中注入假实现）
+func registerBedrockTools(tools *ToolRegistry, client *bedrockagentruntime.Client, cfg BedrockToolsConfig, sessionID string, retriever Retriever, generator AnswerGenerator) error {
+	if cfg.KnowledgeBaseID != "" && retriever == nil && generator == nil {
+		kb := NewBedrockKnowledgeBase(client, cfg.KnowledgeBaseID, cfg.ModelARN)
+		switch cfg.Mode {
+		case "", KnowledgeBaseModeRetrieve:
+			retriever = kb
+		case KnowledgeBaseModeGenerate:
+			if cfg.ModelARN == "" {
+				return fmt.Errorf("知识库 generate 模式需要指定模型 ARN")
+			}
+			generator = kb
+		default:
+			return fmt.Errorf("未知的知识库模式 %q，可选 retrieve / generate", cfg.Mode)
+		}
+	}
+	if retriever != nil {
+		tools.Register(NewKnowledgeBaseTool(BedrockKnowledgeBaseToolName, "", retriever))
+	}
+	if generator != nil {
+		tools.Register(NewAnswerTool(KnowledgeAnswerToolName,
+			"向公司知识库提问，返回依据文档生成的回答和来源。回答产品、政策、流程等问题前先调用，"+
+				"把回答用简短的口语转述给用户，知识库没有答案时如实告诉用户。", generator))
+	}
+	if cfg.AgentID != "" {
+		if cfg.AgentAliasID == "" {
+			return fmt.Errorf("调用 Bedrock Agent 需要指定别名 ID")
+		}
+		tools.Register(NewAnswerTool(BedrockAgentToolName,
+			"把用户的请求交给业务 Agent 处理（查询订单、办理业务等），返回 Agent 的回答，"+
+				"把回答用简短的口语转述给用户。",
+			NewBedrockAgent(client, cfg.AgentID, cfg.AgentAliasID, sessionID)))
+	}
+	return nil
+}
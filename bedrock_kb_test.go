@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// fakeRetriever 记录查询并返回固定段落
+type fakeRetriever struct {
+	passages []Passage
+	queries  []string
+}
+
+func (r *fakeRetriever) Retrieve(ctx context.Context, query string, topK int) ([]Passage, error) {
+	r.queries = append(r.queries, query)
+	return r.passages, nil
+}
+
+// fakeAnswerGenerator 记录问题并返回固定回答
+type fakeAnswerGenerator struct {
+	answer    Answer
+	questions []string
+}
+
+func (g *fakeAnswerGenerator) Answer(ctx context.Context, question string) (Answer, error) {
+	g.questions = append(g.questions, question)
+	return g.answer, nil
+}
+
+// toolNames 已注册的工具名
+func toolNames(tools *ToolRegistry) []string {
+	var names []string
+	for _, def := range tools.Definitions() {
+		names = append(names, def.ToolSpec.Name)
+	}
+	return names
+}
+
+func TestRegisterBedrockToolsWithFakes(t *testing.T) {
+	ctx := context.Background()
+	retriever := &fakeRetriever{passages: []Passage{{Source: "s3://docs/退货.md", Text: "七天无理由退货", Score: 0.9}}}
+	generator := &fakeAnswerGenerator{answer: Answer{Text: "支持七天无理由退货", Sources: []string{"s3://docs/退货.md"}}}
+
+	tools := NewToolRegistry()
+	cfg := BedrockToolsConfig{KnowledgeBaseID: "KB123", AgentID: "AGENT1", AgentAliasID: "ALIAS1"}
+	if err := registerBedrockTools(tools, nil, cfg, "session_test", retriever, generator); err != nil {
+		t.Fatalf("registerBedrockTools: %v", err)
+	}
+	names := strings.Join(toolNames(tools), ",")
+	for _, want := range []string{BedrockKnowledgeBaseToolName, KnowledgeAnswerToolName, BedrockAgentToolName} {
+		if !strings.Contains(names, want) {
+			t.Errorf("没有注册 %s，已注册 %s", want, names)
+		}
+	}
+
+	out, err := tools.Invoke(ctx, BedrockKnowledgeBaseToolName, `{"query":"怎么退货"}`)
+	if err != nil {
+		t.Fatalf("调用检索工具: %v", err)
+	}
+	var passages knowledgeBaseResult
+	if err := json.Unmarshal([]byte(out), &passages); err != nil {
+		t.Fatal(err)
+	}
+	if len(passages.Passages) != 1 || passages.Passages[0].Text != "七天无理由退货" {
+		t.Errorf("检索结果 = %s", out)
+	}
+	if len(retriever.queries) != 1 || retriever.queries[0] != "怎么退货" {
+		t.Errorf("检索请求 = %q", retriever.queries)
+	}
+
+	out, err = tools.Invoke(ctx, KnowledgeAnswerToolName, `{"question":"可以退货吗"}`)
+	if err != nil {
+		t.Fatalf("调用问答工具: %v", err)
+	}
+	var answer Answer
+	if err := json.Unmarshal([]byte(out), &answer); err != nil {
+		t.Fatal(err)
+	}
+	if answer.Text != "支持七天无理由退货" || len(answer.Sources) != 1 {
+		t.Errorf("回答 = %s", out)
+	}
+	if len(generator.questions) != 1 || generator.questions[0] != "可以退货吗" {
+		t.Errorf("问答请求 = %q", generator.questions)
+	}
+}
+
+func TestRegisterBedrockToolsConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     BedrockToolsConfig
+		wantErr string
+		want    []string
+	}{
+		{"empty", BedrockToolsConfig{}, "", nil},
+		{"retrieve", BedrockToolsConfig{KnowledgeBaseID: "KB123"}, "", []string{BedrockKnowledgeBaseToolName}},
+		{"generate", BedrockToolsConfig{KnowledgeBaseID: "KB123", Mode: KnowledgeBaseModeGenerate, ModelARN: "arn:aws:bedrock:us-east-1::foundation-model/x"}, "", []string{KnowledgeAnswerToolName}},
+		{"generate without model", BedrockToolsConfig{KnowledgeBaseID: "KB123", Mode: KnowledgeBaseModeGenerate}, "模型 ARN", nil},
+		{"unknown mode", BedrockToolsConfig{KnowledgeBaseID: "KB123", Mode: "summarize"}, "未知的知识库模式", nil},
+		{"agent without alias", BedrockToolsConfig{AgentID: "AGENT1"}, "别名", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tools := NewToolRegistry()
+			err := registerBedrockTools(tools, nil, tt.cfg, "session_test", nil, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want 包含 %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("registerBedrockTools: %v", err)
+			}
+			if got := toolNames(tools); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("注册的工具 = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
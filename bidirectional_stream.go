@@ -8,7 +8,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
@@ -18,24 +22,124 @@ import (
 type NovaSonicStream struct {
 	agent      *VoiceAgent
 	promptName string
-	contentName string
-	audioContentName string
 	httpReq    *http.Request
 	httpResp   *http.Response
 	reader     io.Reader
 	writer     io.WriteCloser
+
+	// contents 输入内容块的生命周期，所有发送的事件都先经它校验
+	contents *ContentTracker
+	// audioContentName 当前打开的音频输入内容块，只在发送线程中访问
+	audioContentName string
+	// typed 已发送的文字输入，用于识别 Sonic 的回显
+	typed typedEcho
+
+	// 本条流的收发字节数
+	bytesSent     atomic.Int64
+	bytesReceived atomic.Int64
+	started       bool
+
+	// openedAt 连接建立时间，用于计算会话到期
+	openedAt time.Time
+	// closed 流已被主动关闭，之后的读取错误不再报告
+	closed    atomic.Bool
+	closeOnce sync.Once
+
+	// broken 响应读取意外结束时关闭，failure 为原因
+	broken    chan struct{}
+	failure   error
+	breakOnce sync.Once
+
+	// traceMu 保护 traceCtx：最近一次发送音频所属轮次的追踪上下文
+	traceMu  sync.Mutex
+	traceCtx context.Context
+
+	// sendMu 保证一组事件（如 contentStart/toolResult/contentEnd）连续写入
+	sendMu sync.Mutex
+
+	// outputContents 模型输出内容块，按 contentId 索引，只在读取线程中访问
+	outputContents map[string]*outputContent
+	// audioContentID 最近一个 AI 音频输出内容块
+	audioContentID string
+
+	// ctx 流的生命周期，用于工具调用等异步操作；cancel 在关闭时取消
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// outputContent 一个模型输出内容块的元信息
+type outputContent struct {
+	Type  string
+	Role  string
+	Stage string
+}
+
+// StreamStatusError 建立双向流时服务端返回的非 200 响应
+type StreamStatusError struct {
+	StatusCode int
+	// ErrorType 服务端返回的异常类型（x-amzn-ErrorType），如 ThrottlingException
+	ErrorType string
+	Body      string
+}
+
+func (e *StreamStatusError) Error() string {
+	if e.ErrorType != "" {
+		return fmt.Sprintf("请求失败 %d (%s): %s", e.StatusCode, e.ErrorType, e.Body)
+	}
+	return fmt.Sprintf("请求失败 %d: %s", e.StatusCode, e.Body)
+}
+
+// StreamExceptionError 服务端在流中返回的异常事件，如 modelStreamErrorException
+type StreamExceptionError struct {
+	// Type 异常类型，如 ModelStreamErrorException
+	Type    string
+	Message string
+}
+
+func (e *StreamExceptionError) Error() string {
+	return fmt.Sprintf("流异常 %s: %s", e.Type, e.Message)
+}
+
+// streamException 将事件名为 xxxException 的未知事件转换为错误
+func streamException(event UnknownOutputEvent) *StreamExceptionError {
+	if !strings.HasSuffix(strings.ToLower(event.Type), "exception") {
+		return nil
+	}
+	var body struct {
+		Message string `json:"message"`
+	}
+	json.Unmarshal(event.Raw, &body)
+	return &StreamExceptionError{
+		Type:    strings.ToUpper(event.Type[:1]) + event.Type[1:],
+		Message: body.Message,
+	}
+}
+
+// countingReader 统计读取字节数
+type countingReader struct {
+	r     io.Reader
+	count func(n int)
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.count(n)
+	}
+	return n, err
 }
 
 // NewNovaSonicStream 创建双向流
 func (va *VoiceAgent) NewNovaSonicStream(ctx context.Context) (*NovaSonicStream, error) {
-	endpoint := fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com/model/%s/invoke-with-bidirectional-stream",
-		va.region, va.modelID)
+	// 每条流有独立的生命周期，续期时可以单独关闭旧流
+	ctx, cancel := context.WithCancel(ctx)
 
 	// 创建 pipe 用于双向通信
 	pipeReader, pipeWriter := io.Pipe()
 
-	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, pipeReader)
+	req, err := http.NewRequestWithContext(ctx, "POST", va.streamEndpoint(), pipeReader)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
@@ -45,28 +149,80 @@ func (va *VoiceAgent) NewNovaSonicStream(ctx context.Context) (*NovaSonicStream,
 	// AWS SigV4 签名
 	credentials, err := va.awsConfig.Credentials.Retrieve(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("获取凭证失败: %w", err)
+		cancel()
+		return nil, fmt.Errorf("%w: %w", ErrCredentials, err)
 	}
 
 	signer := v4.NewSigner()
 	payloadHash := sha256.Sum256([]byte{})
 	err = signer.SignHTTP(ctx, credentials, req, hex.EncodeToString(payloadHash[:]), "bedrock", va.region, time.Now())
 	if err != nil {
-		return nil, fmt.Errorf("签名失败: %w", err)
+		cancel()
+		return nil, fmt.Errorf("%w: 签名失败: %w", ErrCredentials, err)
 	}
 
+	promptName := fmt.Sprintf("prompt_%d", time.Now().UnixNano())
 	stream := &NovaSonicStream{
-		agent:            va,
-		promptName:       fmt.Sprintf("prompt_%d", time.Now().UnixNano()),
-		contentName:      fmt.Sprintf("content_%d", time.Now().UnixNano()),
-		audioContentName: fmt.Sprintf("audio_%d", time.Now().UnixNano()),
-		httpReq:          req,
-		writer:           pipeWriter,
+		agent:          va,
+		promptName:     promptName,
+		httpReq:        req,
+		writer:         pipeWriter,
+		contents:       NewContentTracker(promptName),
+		outputContents: make(map[string]*outputContent),
+		ctx:            ctx,
+		cancel:         cancel,
+		broken:         make(chan struct{}),
 	}
 
 	return stream, nil
 }
 
+// streamEndpoint 双向流地址，AgentOptions.Endpoint 可替换为兼容的服务（如本地模拟服务）
+func (va *VoiceAgent) streamEndpoint() string {
+	if va.endpoint != "" {
+		return strings.TrimSuffix(va.endpoint, "/") + "/model/" + va.modelID + "/invoke-with-bidirectional-stream"
+	}
+	return fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com/model/%s/invoke-with-bidirectional-stream",
+		va.region, va.modelID)
+}
+
+// log 返回带 prompt 名称的日志器
+func (s *NovaSonicStream) log() *slog.Logger {
+	return s.agent.log().With(logKeyPrompt, s.promptName)
+}
+
+// fail 记录流意外中断的原因，只有第一次生效
+func (s *NovaSonicStream) fail(err error) {
+	s.breakOnce.Do(func() {
+		s.failure = err
+		close(s.broken)
+	})
+}
+
+// Broken 流意外中断时关闭的通道
+func (s *NovaSonicStream) Broken() <-chan struct{} {
+	return s.broken
+}
+
+// Failure 流中断的原因，应在 Broken 关闭后调用
+func (s *NovaSonicStream) Failure() error {
+	return s.failure
+}
+
+// setTraceCtx 记录当前轮次的追踪上下文，后续的模型输出归属到该轮次
+func (s *NovaSonicStream) setTraceCtx(ctx context.Context) {
+	s.traceMu.Lock()
+	defer s.traceMu.Unlock()
+	s.traceCtx = ctx
+}
+
+// currentTraceCtx 获取当前轮次的追踪上下文
+func (s *NovaSonicStream) currentTraceCtx() context.Context {
+	s.traceMu.Lock()
+	defer s.traceMu.Unlock()
+	return s.traceCtx
+}
+
 // Start 启动流
 func (s *NovaSonicStream) Start(ctx context.Context) error {
 	// 发送请求
@@ -77,11 +233,24 @@ func (s *NovaSonicStream) Start(ctx context.Context) error {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("请求失败 %d: %s", resp.StatusCode, string(body))
+		resp.Body.Close()
+		errorType, _, _ := strings.Cut(resp.Header.Get("X-Amzn-Errortype"), ":")
+		return &StreamStatusError{
+			StatusCode: resp.StatusCode,
+			ErrorType:  errorType,
+			Body:       string(body),
+		}
 	}
 
+	metrics := s.agent.metrics
 	s.httpResp = resp
-	s.reader = resp.Body
+	s.reader = &countingReader{r: resp.Body, count: func(n int) {
+		s.bytesReceived.Add(int64(n))
+		metrics.StreamBytes.WithLabelValues("received").Add(float64(n))
+	}}
+	s.started = true
+	s.openedAt = time.Now()
+	metrics.ActiveSessions.Inc()
 
 	// 发送初始化事件序列
 	if err := s.sendSessionStart(); err != nil {
@@ -96,166 +265,225 @@ func (s *NovaSonicStream) Start(ctx context.Context) error {
 		return err
 	}
 
+	// 续期或重连的新会话需要知道之前聊了什么
+	if err := s.sendHistory(s.agent.historyForReplay()); err != nil {
+		return err
+	}
+
 	return nil
 }
 
-// sendEvent 发送事件
-func (s *NovaSonicStream) sendEvent(event map[string]interface{}) error {
-	data, err := json.Marshal(event)
-	if err != nil {
-		return err
-	}
+// sendEvent 校验并发送事件
+func (s *NovaSonicStream) sendEvent(event SonicInput) error {
+	return s.sendEvents(event)
+}
+
+// sendEvents 校验并连续发送一组事件，期间不会插入其他线程的事件
+func (s *NovaSonicStream) sendEvents(events ...SonicInput) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	for _, event := range events {
+		data, err := MarshalSonicInput(event)
+		if err != nil {
+			return err
+		}
+		if err := s.contents.Observe(event); err != nil {
+			return err
+		}
 
-	// 添加换行符（流式传输需要）
-	data = append(data, '\n')
+		// 添加换行符（流式传输需要）
+		data = append(data, '\n')
 
-	_, err = s.writer.Write(data)
-	return err
+		n, err := s.writer.Write(data)
+		s.bytesSent.Add(int64(n))
+		s.agent.metrics.StreamBytes.WithLabelValues("sent").Add(float64(n))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // sendSessionStart 发送会话开始事件
 func (s *NovaSonicStream) sendSessionStart() error {
-	event := map[string]interface{}{
-		"event": map[string]interface{}{
-			"sessionStart": map[string]interface{}{
-				"inferenceConfiguration": map[string]interface{}{
-					"maxTokens":   1024,
-					"topP":        0.9,
-					"temperature": 0.7,
-				},
-			},
-		},
+	event := SessionStartEvent{
+		InferenceConfiguration: s.agent.Inference(),
 	}
-	fmt.Println("📤 发送 sessionStart")
+	s.log().Debug("发送 sessionStart")
 	return s.sendEvent(event)
 }
 
 // sendPromptStart 发送提示开始事件
 func (s *NovaSonicStream) sendPromptStart() error {
-	event := map[string]interface{}{
-		"event": map[string]interface{}{
-			"promptStart": map[string]interface{}{
-				"promptName": s.promptName,
-				"textOutputConfiguration": map[string]interface{}{
-					"mediaType": "text/plain",
-				},
-				"audioOutputConfiguration": map[string]interface{}{
-					"mediaType":        "audio/lpcm",
-					"sampleRateHertz":  24000,
-					"sampleSizeBits":   16,
-					"channelCount":     1,
-					"voiceId":          "matthew",
-					"encoding":         "base64",
-					"audioType":        "SPEECH",
-				},
-			},
+	event := PromptStartEvent{
+		PromptName: s.promptName,
+		TextOutputConfiguration: &MediaTypeConfiguration{
+			MediaType: "text/plain",
+		},
+		AudioOutputConfiguration: &AudioOutputConfiguration{
+			MediaType:       "audio/lpcm",
+			SampleRateHertz: 24000,
+			SampleSizeBits:  16,
+			ChannelCount:    1,
+			VoiceID:         s.agent.Voice(),
+			Encoding:        "base64",
+			AudioType:       "SPEECH",
 		},
 	}
-	fmt.Println("📤 发送 promptStart")
+	if tools := s.agent.toolDefinitions(); len(tools) > 0 {
+		event.ToolUseOutputConfiguration = &MediaTypeConfiguration{
+			MediaType: "application/json",
+		}
+		event.ToolConfiguration = &ToolConfiguration{
+			Tools: tools,
+		}
+	}
+	s.log().Debug("发送 promptStart")
 	return s.sendEvent(event)
 }
 
 // sendSystemPrompt 发送系统提示
 func (s *NovaSonicStream) sendSystemPrompt() error {
+	contentName := s.contents.NewName("system")
+
 	// contentStart
-	event1 := map[string]interface{}{
-		"event": map[string]interface{}{
-			"contentStart": map[string]interface{}{
-				"promptName":  s.promptName,
-				"contentName": s.contentName,
-				"type":        "TEXT",
-				"interactive": true,
-				"role":        "SYSTEM",
-				"textInputConfiguration": map[string]interface{}{
-					"mediaType": "text/plain",
-				},
-			},
+	err := s.sendEvent(ContentStartEvent{
+		PromptName:  s.promptName,
+		ContentName: contentName,
+		Type:        ContentTypeText,
+		Interactive: true,
+		Role:        SonicRoleSystem,
+		TextInputConfiguration: &MediaTypeConfiguration{
+			MediaType: "text/plain",
 		},
-	}
-	if err := s.sendEvent(event1); err != nil {
+	})
+	if err != nil {
 		return err
 	}
 
 	// textInput
-	systemPrompt := "你是一个友好的中文助手。用简短的中文回复，一般2-3句话。"
-	event2 := map[string]interface{}{
-		"event": map[string]interface{}{
-			"textInput": map[string]interface{}{
-				"promptName":  s.promptName,
-				"contentName": s.contentName,
-				"content":     systemPrompt,
-			},
-		},
-	}
-	if err := s.sendEvent(event2); err != nil {
+	err = s.sendEvent(TextInputEvent{
+		PromptName:  s.promptName,
+		ContentName: contentName,
+		Content:     s.agent.SystemPrompt(),
+	})
+	if err != nil {
 		return err
 	}
 
 	// contentEnd
-	event3 := map[string]interface{}{
-		"event": map[string]interface{}{
-			"contentEnd": map[string]interface{}{
-				"promptName":  s.promptName,
-				"contentName": s.contentName,
-			},
-		},
-	}
-	fmt.Println("📤 发送 system prompt")
-	return s.sendEvent(event3)
-}
-
-// StartAudioInput 开始音频输入
-func (s *NovaSonicStream) StartAudioInput() error {
-	event := map[string]interface{}{
-		"event": map[string]interface{}{
-			"contentStart": map[string]interface{}{
-				"promptName":  s.promptName,
-				"contentName": s.audioContentName,
-				"type":        "AUDIO",
-				"interactive": true,
-				"role":        "USER",
-				"audioInputConfiguration": map[string]interface{}{
-					"mediaType":        "audio/lpcm",
-					"sampleRateHertz":  16000,
-					"sampleSizeBits":   16,
-					"channelCount":     1,
-					"audioType":        "SPEECH",
-					"encoding":         "base64",
+	s.log().Debug("发送 system prompt", logKeyContent, contentName)
+	return s.sendEvent(ContentEndEvent{
+		PromptName:  s.promptName,
+		ContentName: contentName,
+	})
+}
+
+// sendHistory 在系统提示之后以非交互的 TEXT 内容重放对话历史
+func (s *NovaSonicStream) sendHistory(messages []ConversationMessage) error {
+	for _, msg := range messages {
+		contentName := s.contents.NewName("history")
+		err := s.sendEvents(
+			ContentStartEvent{
+				PromptName:  s.promptName,
+				ContentName: contentName,
+				Type:        ContentTypeText,
+				Interactive: false,
+				Role:        sonicRole(msg.Role),
+				TextInputConfiguration: &MediaTypeConfiguration{
+					MediaType: "text/plain",
 				},
 			},
+			TextInputEvent{
+				PromptName:  s.promptName,
+				ContentName: contentName,
+				Content:     msg.Text,
+			},
+			ContentEndEvent{
+				PromptName:  s.promptName,
+				ContentName: contentName,
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if len(messages) > 0 {
+		s.log().Debug("已重放对话历史", "message_count", len(messages))
+	}
+	return nil
+}
+
+// StartAudioInput 以新的内容块开始一段音频输入，返回内容块名称
+// 同一 prompt 内 contentName 不能复用，每段语音都使用新名称
+func (s *NovaSonicStream) StartAudioInput() (string, error) {
+	contentName := s.contents.NewName("audio")
+	event := ContentStartEvent{
+		PromptName:  s.promptName,
+		ContentName: contentName,
+		Type:        ContentTypeAudio,
+		Interactive: true,
+		Role:        SonicRoleUser,
+		AudioInputConfiguration: &AudioInputConfiguration{
+			MediaType:       "audio/lpcm",
+			SampleRateHertz: 16000,
+			SampleSizeBits:  16,
+			ChannelCount:    1,
+			AudioType:       "SPEECH",
+			Encoding:        "base64",
 		},
 	}
-	fmt.Println("📤 开始音频输入")
-	return s.sendEvent(event)
+	if err := s.sendEvent(event); err != nil {
+		return "", err
+	}
+	s.audioContentName = contentName
+	s.log().Debug("开始音频输入", logKeyContent, contentName)
+	return contentName, nil
 }
 
-// SendAudioChunk 发送音频块
+// SendAudioChunk 向当前音频内容块发送音频
 func (s *NovaSonicStream) SendAudioChunk(audioData []byte) error {
-	audioBase64 := base64.StdEncoding.EncodeToString(audioData)
-	event := map[string]interface{}{
-		"event": map[string]interface{}{
-			"audioInput": map[string]interface{}{
-				"promptName":  s.promptName,
-				"contentName": s.audioContentName,
-				"content":     audioBase64,
-			},
-		},
+	return s.sendEvent(AudioInputEvent{
+		PromptName:  s.promptName,
+		ContentName: s.audioContentName,
+		Content:     base64.StdEncoding.EncodeToString(audioData),
+	})
+}
+
+// audioInputChunkSize 每个 audioInput 事件最多携带的 PCM 字节数
+const audioInputChunkSize = 3200
+
+// SendAudio 将一段 PCM 音频分片发送到当前音频内容块
+func (s *NovaSonicStream) SendAudio(pcmData []byte) error {
+	for len(pcmData) > 0 {
+		n := min(len(pcmData), audioInputChunkSize)
+		if err := s.SendAudioChunk(pcmData[:n]); err != nil {
+			return err
+		}
+		pcmData = pcmData[n:]
 	}
-	return s.sendEvent(event)
+	return nil
 }
 
-// EndAudioInput 结束音频输入
+// EndAudioInput 结束当前音频内容块
 func (s *NovaSonicStream) EndAudioInput() error {
-	event := map[string]interface{}{
-		"event": map[string]interface{}{
-			"contentEnd": map[string]interface{}{
-				"promptName":  s.promptName,
-				"contentName": s.audioContentName,
-			},
-		},
+	contentName := s.audioContentName
+	s.audioContentName = ""
+	s.log().Debug("结束音频输入", logKeyContent, contentName)
+	return s.sendEvent(ContentEndEvent{
+		PromptName:  s.promptName,
+		ContentName: contentName,
+	})
+}
+
+// endOpenContents 结束所有尚未结束的输入内容块，promptEnd 之前调用
+func (s *NovaSonicStream) endOpenContents() {
+	for _, name := range s.contents.Open() {
+		if err := s.sendEvent(ContentEndEvent{PromptName: s.promptName, ContentName: name}); err != nil {
+			s.log().Debug("结束内容块失败", logKeyContent, name, "error", err)
+		}
 	}
-	fmt.Println("📤 结束音频输入")
-	return s.sendEvent(event)
 }
 
 // ReadResponses 读取响应
@@ -267,83 +495,270 @@ func (s *NovaSonicStream) ReadResponses(ctx context.Context) error {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			var response map[string]interface{}
-			if err := decoder.Decode(&response); err != nil {
+			var raw json.RawMessage
+			if err := decoder.Decode(&raw); err != nil {
 				if err == io.EOF {
 					return nil
 				}
 				return err
 			}
 
+			event, err := DecodeSonicOutput(raw)
+			if err != nil {
+				s.log().Error("解析响应事件失败", "error", err)
+				continue
+			}
+
+			// 服务端异常事件之后流不再可用
+			if unknown, ok := event.(UnknownOutputEvent); ok {
+				if exception := streamException(unknown); exception != nil {
+					return exception
+				}
+			}
+
 			// 处理响应
-			if err := s.handleResponse(response); err != nil {
-				fmt.Printf("❌ 处理响应错误: %v\n", err)
+			if err := s.handleResponse(event); err != nil {
+				s.log().Error("处理响应错误", "event", event.OutputType(), "error", err)
 			}
 		}
 	}
 }
 
 // handleResponse 处理响应事件
-func (s *NovaSonicStream) handleResponse(response map[string]interface{}) error {
-	event, ok := response["event"].(map[string]interface{})
-	if !ok {
-		return nil
+func (s *NovaSonicStream) handleResponse(event SonicOutput) error {
+	switch e := event.(type) {
+	case CompletionStartEvent:
+		s.log().Debug("completionStart", "completion_id", e.CompletionID)
+
+	case OutputContentStartEvent:
+		s.outputContents[e.ContentID] = &outputContent{
+			Type:  e.Type,
+			Role:  e.Role,
+			Stage: e.GenerationStage(),
+		}
+		if e.Type == ContentTypeAudio && e.Role == SonicRoleAssistant {
+			s.audioContentID = e.ContentID
+		}
+		s.log().Debug("contentStart", "content_id", e.ContentID, "type", e.Type,
+			logKeyRole, e.Role, "generation_stage", e.GenerationStage())
+
+	case TextOutputEvent:
+		s.handleTextOutput(e)
+
+	case AudioOutputEvent:
+		return s.handleAudioOutput(e)
+
+	case ToolUseEvent:
+		s.handleToolUse(e)
+
+	case OutputContentEndEvent:
+		s.handleContentEnd(e)
+
+	case CompletionEndEvent:
+		s.log().Debug("completionEnd", "completion_id", e.CompletionID, "stop_reason", e.StopReason)
+
+	case UsageEvent:
+		s.agent.recordUsage(e)
+
+	case UnknownOutputEvent:
+		s.log().Debug("忽略未知事件", "event", e.Type)
 	}
 
-	// 处理文本输出
-	if textOutput, ok := event["textOutput"].(map[string]interface{}); ok {
-		if content, ok := textOutput["content"].(string); ok {
-			if role, ok := textOutput["role"].(string); ok {
-				if role == "ASSISTANT" {
-					fmt.Printf("💬 Nova: %s\n", content)
-				} else if role == "USER" {
-					fmt.Printf("👤 识别: %s\n", content)
-				}
-			}
-		}
+	return nil
+}
+
+// handleTextOutput 处理文本输出
+// SPECULATIVE 阶段是模型计划要说的内容，FINAL 阶段是实际说出的内容
+func (s *NovaSonicStream) handleTextOutput(e TextOutputEvent) {
+	// 模型侧检测到用户打断时会发送 {"interrupted": true}
+	if isInterruptedMarker(e.Content) {
+		s.agent.interruptPlayback("model", s.audioContentID)
+		return
 	}
 
-	// 处理音频输出
-	if audioOutput, ok := event["audioOutput"].(map[string]interface{}); ok {
-		if content, ok := audioOutput["content"].(string); ok {
-			audioBytes, err := base64.StdEncoding.DecodeString(content)
-			if err == nil && len(audioBytes) > 0 {
-				// 注意：输出是 24kHz PCM，需要转换为 8kHz mulaw
-				// 暂时跳过播放
-				fmt.Printf("🔊 收到音频 %d 字节\n", len(audioBytes))
-			}
+	turnTraceFrom(s.currentTraceCtx()).MarkFirstText(e.Role)
+
+	stage := GenerationStageFinal
+	if content, ok := s.outputContents[e.ContentID]; ok && content.Stage != "" {
+		stage = content.Stage
+	}
+
+	if stage == GenerationStageSpeculative {
+		// 预测文本即将被说出，用于估算打断时用户听到了多少
+		if e.Role == SonicRoleAssistant {
+			s.agent.reply.AddText(e.Content)
 		}
+		s.log().Debug("Nova 回复（预测）", logKeyRole, e.Role, transcriptAttr(e.Content))
+		s.agent.events.Publish(TranscriptPartialEvent{At: time.Now(), Role: e.Role, Text: e.Content})
+		return
 	}
 
-	return nil
+	now := time.Now()
+	switch e.Role {
+	case SonicRoleAssistant:
+		s.log().Info("Nova 回复", logKeyRole, e.Role, transcriptAttr(e.Content))
+		s.agent.commitTurn(s.agent.transcript.AddText(RoleAssistant, e.Content, now))
+		s.agent.events.Publish(AssistantTextEvent{At: now, Text: e.Content})
+	case SonicRoleUser:
+		// 文字输入在发送时已经记录过
+		if s.typed.consume(e.Content) {
+			s.log().Debug("忽略文本输入的回显", transcriptAttr(e.Content))
+			return
+		}
+		// 用户新的一句话，下一次 AI 回复重新开始记录
+		s.agent.reply.Reset()
+		s.agent.commitTurn(s.agent.transcript.AddText(RoleUser, e.Content, now))
+		s.log().Info("识别结果", logKeyRole, e.Role, transcriptAttr(e.Content))
+	}
+	s.agent.events.Publish(TranscriptFinalEvent{At: time.Now(), Role: e.Role, Text: e.Content})
 }
 
-// Close 关闭流
-func (s *NovaSonicStream) Close() error {
-	// 发送结束事件
-	event1 := map[string]interface{}{
-		"event": map[string]interface{}{
-			"promptEnd": map[string]interface{}{
-				"promptName": s.promptName,
-			},
-		},
+// handleAudioOutput 处理音频输出
+func (s *NovaSonicStream) handleAudioOutput(e AudioOutputEvent) error {
+	audioBytes, err := base64.StdEncoding.DecodeString(e.Content)
+	if err != nil {
+		return fmt.Errorf("解码音频失败: %w", err)
+	}
+	if len(audioBytes) == 0 {
+		return nil
 	}
-	s.sendEvent(event1)
 
-	event2 := map[string]interface{}{
-		"event": map[string]interface{}{
-			"sessionEnd": map[string]interface{}{},
-		},
+	// 输出是 24kHz PCM，转换为 8kHz mulaw 后交给播放线程
+	mulawData := pcm24kToMulaw8k(audioBytes)
+	traceCtx := s.currentTraceCtx()
+	turnTraceFrom(traceCtx).MarkFirstAudio()
+	s.agent.commitTurn(s.agent.transcript.AddContentAudio(RoleAssistant, e.ContentID, mulawData, time.Now()))
+	s.agent.events.Publish(AssistantAudioChunkEvent{At: time.Now(), Data: mulawData})
+	select {
+	case s.agent.audioOutputChan <- AudioChunk{
+		Data:      mulawData,
+		Timestamp: time.Now(),
+		TraceCtx:  traceCtx,
+		ContentID: e.ContentID,
+	}:
+	case <-s.agent.playbackCtx.Done():
 	}
-	s.sendEvent(event2)
+	return nil
+}
+
+// handleContentEnd 处理内容块结束
+func (s *NovaSonicStream) handleContentEnd(e OutputContentEndEvent) {
+	content := s.outputContents[e.ContentID]
+	delete(s.outputContents, e.ContentID)
 
-	if s.writer != nil {
-		s.writer.Close()
+	s.log().Debug("contentEnd", "content_id", e.ContentID, "type", e.Type, "stop_reason", e.StopReason)
+
+	if e.StopReason == StopReasonInterrupted {
+		// 模型侧检测到用户打断，丢弃该内容块尚未播放的音频
+		if content == nil || content.Role == SonicRoleAssistant {
+			contentID := ""
+			if content != nil && content.Type == ContentTypeAudio {
+				contentID = e.ContentID
+			}
+			s.agent.interruptPlayback("model", contentID)
+		}
 	}
-	if s.httpResp != nil {
-		s.httpResp.Body.Close()
+
+	// 最终阶段的回复文本结束于 END_TURN 或 INTERRUPTED 时，这一轮回复生成完了
+	// 音频还在播放（或刚被打断、等待截断）时等播放线程提交
+	if content != nil && content.Role == SonicRoleAssistant && content.Type == ContentTypeText &&
+		content.Stage != GenerationStageSpeculative &&
+		(e.StopReason == StopReasonEndTurn || e.StopReason == StopReasonInterrupted) {
+		state := s.agent.turn.State()
+		playing := state == TurnAssistantSpeaking || state == TurnInterrupted
+		s.agent.commitTurn(s.agent.transcript.Finish(RoleAssistant, playing))
 	}
+}
 
-	return nil
+// handleToolUse 处理工具调用：执行工具并把结果发回模型
+func (s *NovaSonicStream) handleToolUse(e ToolUseEvent) {
+	s.log().Info("模型调用工具", "tool", e.ToolName, "tool_use_id", e.ToolUseID)
+	s.agent.events.Publish(ToolCallEvent{
+		At:        time.Now(),
+		ToolName:  e.ToolName,
+		ToolUseID: e.ToolUseID,
+		Input:     e.Content,
+	})
+	s.agent.transitionTurn(TurnToolPending, "工具调用 "+e.ToolName)
+
+	// 工具可能较慢，不阻塞读取线程
+	go func() {
+		result, err := s.agent.tools.Invoke(s.ctx, e.ToolName, e.Content)
+		if err != nil {
+			s.log().Warn("工具执行失败", "tool", e.ToolName, "error", err)
+		}
+		if err := s.SendToolResult(e.ToolUseID, result); err != nil {
+			s.log().Error("发送工具结果失败", "tool", e.ToolName, "error", err)
+			s.agent.publishError("stream", err)
+		}
+		if s.agent.turn.State() == TurnToolPending {
+			s.agent.transitionTurn(TurnWaitingModel, "工具结果已发送")
+		}
+	}()
 }
 
+// SendToolResult 发送工具结果（contentStart TOOL / toolResult / contentEnd）
+func (s *NovaSonicStream) SendToolResult(toolUseID, result string) error {
+	contentName := s.contents.NewName("tool")
+	return s.sendEvents(
+		ContentStartEvent{
+			PromptName:  s.promptName,
+			ContentName: contentName,
+			Type:        ContentTypeTool,
+			Interactive: false,
+			Role:        SonicRoleTool,
+			ToolResultInputConfiguration: &ToolResultInputConfiguration{
+				ToolUseID: toolUseID,
+				Type:      ContentTypeText,
+				TextInputConfiguration: MediaTypeConfiguration{
+					MediaType: "text/plain",
+				},
+			},
+		},
+		ToolResultEvent{
+			PromptName:  s.promptName,
+			ContentName: contentName,
+			Content:     result,
+		},
+		ContentEndEvent{
+			PromptName:  s.promptName,
+			ContentName: contentName,
+		},
+	)
+}
+
+// Close 关闭流，可重复调用
+func (s *NovaSonicStream) Close() error {
+	s.closeOnce.Do(func() {
+		s.closed.Store(true)
+
+		// 发送结束事件（连接未建立或已中断时没有读取方，写入会阻塞）
+		broken := false
+		select {
+		case <-s.broken:
+			broken = true
+		default:
+		}
+		if s.started && !broken {
+			s.endOpenContents()
+			s.sendEvent(PromptEndEvent{PromptName: s.promptName})
+			s.sendEvent(SessionEndEvent{})
+		}
+
+		if s.writer != nil {
+			s.writer.Close()
+		}
+		if s.httpResp != nil {
+			s.httpResp.Body.Close()
+		}
+		s.cancel()
+
+		if s.started {
+			metrics := s.agent.metrics
+			metrics.ActiveSessions.Dec()
+			metrics.StreamSessionBytes.WithLabelValues("sent").Observe(float64(s.bytesSent.Load()))
+			metrics.StreamSessionBytes.WithLabelValues("received").Observe(float64(s.bytesReceived.Load()))
+		}
+	})
+	return nil
+}
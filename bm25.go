@@ -0,0 +1,130 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 参数
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// BM25Index 纯 Go 的 BM25 倒排索引，不依赖任何外部服务
+type BM25Index struct {
+	// postings 词 → 文档编号 → 词频
+	postings  map[string]map[int]int
+	docLens   []int
+	avgDocLen float64
+}
+
+// bm25Hit 一条检索结果
+type bm25Hit struct {
+	doc   int
+	score float64
+}
+
+// NewBM25Index 为 docs 建立索引，文档编号即 docs 中的下标
+func NewBM25Index(docs []string) *BM25Index {
+	idx := &BM25Index{
+		postings: make(map[string]map[int]int),
+		docLens:  make([]int, len(docs)),
+	}
+	total := 0
+	for i, doc := range docs {
+		terms := tokenize(doc)
+		idx.docLens[i] = len(terms)
+		total += len(terms)
+		for _, term := range terms {
+			if idx.postings[term] == nil {
+				idx.postings[term] = make(map[int]int)
+			}
+			idx.postings[term][i]++
+		}
+	}
+	if len(docs) > 0 {
+		idx.avgDocLen = float64(total) / float64(len(docs))
+	}
+	return idx
+}
+
+// Search 返回得分最高的 topK 个文档，没有命中任何词的文档不返回
+func (idx *BM25Index) Search(query string, topK int) []bm25Hit {
+	n := float64(len(idx.docLens))
+	scores := make(map[int]float64)
+	seen := make(map[string]bool)
+	for _, term := range tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		postings := idx.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for doc, tf := range postings {
+			norm := 1 - bm25B + bm25B*float64(idx.docLens[doc])/idx.avgDocLen
+			scores[doc] += idf * float64(tf) * (bm25K1 + 1) / (float64(tf) + bm25K1*norm)
+		}
+	}
+
+	hits := make([]bm25Hit, 0, len(scores))
+	for doc, score := range scores {
+		hits = append(hits, bm25Hit{doc: doc, score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].doc < hits[j].doc
+	})
+	if len(hits) > topK {
+		hits = hits[:topK]
+	}
+	return hits
+}
+
+// tokenize 分词：字母数字按单词切分并转小写，中日韩文字没有空格，按相邻两字（bigram）切分
+func tokenize(text string) []string {
+	var terms []string
+	var word []rune
+	var cjk []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			terms = append(terms, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		switch {
+		case len(cjk) == 1:
+			terms = append(terms, string(cjk))
+		case len(cjk) > 1:
+			for i := 0; i+1 < len(cjk); i++ {
+				terms = append(terms, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return terms
+}
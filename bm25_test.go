@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Hello, World 42", []string{"hello", "world", "42"}},
+		{"退货政策", []string{"退货", "货政", "政策"}},
+		{"退", []string{"退"}},
+		{"iPhone15退货", []string{"iphone15", "退货"}},
+		{"VIP会员，7天内可退", []string{"vip", "会员", "7", "天内", "内可", "可退"}},
+		{"カタカナ", []string{"カタ", "タカ", "カナ"}},
+		{"  ,。! ", nil},
+	}
+	for _, tt := range tests {
+		if got := tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestBM25Search(t *testing.T) {
+	idx := NewBM25Index([]string{
+		"会员可以享受七天无理由退货",
+		"运费由买家承担，退货运费除外",
+		"营业时间为每天上午九点到晚上九点",
+		"退货退货退货：退货需要保留发票",
+	})
+
+	hits := idx.Search("怎么退货", 10)
+	if len(hits) != 3 {
+		t.Fatalf("命中 %d 篇, want 3（不含营业时间）: %+v", len(hits), hits)
+	}
+	// 词频高的文档排在前面，得分从高到低
+	if hits[0].doc != 3 {
+		t.Errorf("第一名 = %d, want 3", hits[0].doc)
+	}
+	for i := 1; i < len(hits); i++ {
+		if hits[i].score > hits[i-1].score {
+			t.Errorf("结果没有按得分排序: %+v", hits)
+		}
+	}
+
+	if hits := idx.Search("营业时间", 10); len(hits) != 1 || hits[0].doc != 2 {
+		t.Errorf("营业时间 = %+v, want 文档 2", hits)
+	}
+	if hits := idx.Search("退货", 2); len(hits) != 2 {
+		t.Errorf("topK=2 返回 %d 篇", len(hits))
+	}
+	if hits := idx.Search("quantum", 3); len(hits) != 0 {
+		t.Errorf("没有命中的词应返回空: %+v", hits)
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// 级联模式：语音 → SpeechToText → LanguageModel → TextToSpeech → 播放
+// 各阶段之间用通道按句流式传递：模型还在生成后面的句子时，前面的句子已经在合成和播放
+
+// SpeechToText 语音识别引擎
+type SpeechToText interface {
+	// Transcribe 识别一段 8kHz mulaw 语音，没有识别出内容时返回空串
+	Transcribe(ctx context.Context, audio []byte) (string, error)
+}
+
+// LanguageModel 对话模型
+type LanguageModel interface {
+	// StreamReply 根据系统提示和对话历史（最后一条是本轮用户发言）生成回复，
+	// 文本片段依次写入 out；返回后不再写入 out，由调用方关闭
+	StreamReply(ctx context.Context, system string, history []ConversationMessage, out chan<- string) error
+}
+
+// replyQueueSize 阶段之间的通道缓冲，TTS 慢于模型时让模型继续生成
+const replyQueueSize = 16
+
+// RunCascade 级联模式的处理线程：识别每段语音并生成语音回复
+func (va *VoiceAgent) RunCascade(ctx context.Context) error {
+	if va.stt == nil || va.llm == nil {
+		return fmt.Errorf("级联模式需要配置语音识别和对话模型")
+	}
+	va.logger.Info("级联模式处理线程已启动")
+
+	for {
+		select {
+		case <-ctx.Done():
+			va.logger.Info("级联模式处理线程已停止")
+			return ctx.Err()
+
+		case chunk := <-va.audioInputChan:
+			trace := turnTraceFrom(chunk.TraceCtx)
+			trace.StartModelWait()
+			text, err := va.stt.Transcribe(ctx, chunk.Data)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				va.log().Error("语音识别失败", "error", err)
+				va.publishError("stt", err)
+				trace.Fail(err)
+				va.transitionTurn(TurnListening, "识别失败")
+				continue
+			}
+			text = strings.TrimSpace(text)
+			if text == "" {
+				trace.End("no_speech")
+				va.transitionTurn(TurnListening, "未识别出内容")
+				continue
+			}
+			// 上一轮回复先结束并记录为被打断，再记录本轮用户语音
+			va.stopCascadeReply()
+			va.commitTurn(va.transcript.AddAudio(RoleUser, chunk.Data,
+				chunk.Timestamp.Add(-mulawDuration(chunk.Data))))
+			va.respond(ctx, text, chunk.TraceCtx)
+		}
+	}
+}
+
+// RespondText 以一段用户文本开始新的一轮，回复用语音播放
+func (va *VoiceAgent) RespondText(ctx context.Context, text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	if va.llm == nil {
+		return fmt.Errorf("未配置对话模型")
+	}
+
+	traceCtx := va.beginTextTurn()
+	turnTraceFrom(traceCtx).StartModelWait()
+	va.respond(ctx, text, traceCtx)
+	return nil
+}
+
+// cancelCascadeReply 取消正在生成的回复，不等待回复线程退出
+func (va *VoiceAgent) cancelCascadeReply() {
+	va.replyMu.Lock()
+	defer va.replyMu.Unlock()
+	if va.cancelReply != nil {
+		va.cancelReply()
+		va.cancelReply = nil
+	}
+}
+
+// stopCascadeReply 取消正在生成的回复并等回复线程退出，
+// 之后上一轮回复不会再写入对话记录
+func (va *VoiceAgent) stopCascadeReply() {
+	va.cancelCascadeReply()
+	va.replyMu.Lock()
+	done := va.replyDone
+	va.replyMu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// respond 记录用户发言并在后台生成回复，新的一轮开始时先结束上一轮未完成的回复
+func (va *VoiceAgent) respond(ctx context.Context, text string, traceCtx context.Context) {
+	va.stopCascadeReply()
+	replyCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	va.replyMu.Lock()
+	va.cancelReply = cancel
+	va.replyDone = done
+	va.replyMu.Unlock()
+
+	va.reply.Reset()
+	va.commitTurn(va.transcript.AddText(RoleUser, text, time.Now()))
+	va.events.Publish(TranscriptFinalEvent{At: time.Now(), Role: SonicRoleUser, Text: text})
+	va.log().Info("用户发言", transcriptAttr(text))
+
+	// 模型需要把本轮用户发言放在历史末尾
+	history := va.historyForReplay()
+	if n := len(history); n == 0 || history[n-1].Role != RoleUser || history[n-1].Text != text {
+		history = append(history, ConversationMessage{Role: RoleUser, Text: text})
+	}
+
+	go func() {
+		defer close(done)
+		defer cancel()
+		deltas := make(chan string, replyQueueSize)
+		var llmErr error
+		go func() {
+			defer close(deltas)
+			llmErr = va.llm.StreamReply(replyCtx, va.SystemPrompt(), history, deltas)
+		}()
+		va.speakReply(replyCtx, deltas, traceCtx)
+		if llmErr != nil && replyCtx.Err() == nil {
+			va.log().Error("对话模型出错", "error", llmErr)
+			va.publishError("llm", llmErr)
+			turnTraceFrom(traceCtx).Fail(llmErr)
+		}
+	}()
+}
+
+// speakReply 把模型输出的文本片段切成句子，由 TTS 阶段逐句合成播放，并记录这一轮回复
+// 阻塞到 deltas 关闭且所有句子处理完
+func (va *VoiceAgent) speakReply(ctx context.Context, deltas <-chan string, traceCtx context.Context) {
+	trace := turnTraceFrom(traceCtx)
+	sentences := make(chan string, replyQueueSize)
+
+	// 分句阶段：凑满一句就交给 TTS，不等整段回复生成完
+	go func() {
+		defer close(sentences)
+		var pending strings.Builder
+		for delta := range deltas {
+			pending.WriteString(delta)
+			complete, rest := splitSentences(pending.String())
+			pending.Reset()
+			pending.WriteString(rest)
+			for _, sentence := range complete {
+				sentences <- sentence
+			}
+		}
+		if rest := strings.TrimSpace(pending.String()); rest != "" {
+			sentences <- rest
+		}
+	}()
+
+	// TTS 阶段
+	spoken := false
+	for sentence := range sentences {
+		if ctx.Err() != nil {
+			continue
+		}
+		trace.MarkFirstText(SonicRoleAssistant)
+		va.reply.AddText(sentence)
+		va.log().Info("模型回复", transcriptAttr(sentence))
+		va.commitTurn(va.transcript.AddText(RoleAssistant, sentence, time.Now()))
+		va.events.Publish(AssistantTextEvent{At: time.Now(), Text: sentence})
+		va.events.Publish(TranscriptFinalEvent{At: time.Now(), Role: SonicRoleAssistant, Text: sentence})
+
+		audio, err := va.speak(ctx, sentence, traceCtx, true)
+		if err != nil {
+			if ctx.Err() == nil {
+				va.log().Warn("朗读失败", "error", err)
+				va.publishError("tts", err)
+			}
+			continue
+		}
+		if len(audio) > 0 {
+			spoken = true
+		}
+	}
+
+	if ctx.Err() != nil {
+		// 被打断或被新的一轮取消：回复没说完
+		va.transcript.MarkInterrupted()
+	}
+	// 音频还在播放时由播放线程在播放结束或被打断时提交
+	va.commitTurn(va.transcript.Finish(RoleAssistant, spoken))
+
+	// 没有合成出音频时播放线程不会接手这一轮
+	if !spoken && ctx.Err() == nil {
+		trace.End("text_only")
+		va.transitionTurn(TurnListening, "回复完成（无音频）")
+	}
+}
+
+// CommandSpeechToText 调用本地命令识别语音（如 whisper.cpp）
+// 参数中的 {wav} 会被替换为临时 WAV 文件路径，命令的标准输出作为识别结果
+type CommandSpeechToText struct {
+	Command string
+	Args    []string
+}
+
+// NewCommandSpeechToText 从一行命令创建，如 "whisper-cli -m ggml-base.bin -nt -l zh -f {wav}"
+func NewCommandSpeechToText(commandLine string) (*CommandSpeechToText, error) {
+	fields := strings.Fields(commandLine)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("语音识别命令为空")
+	}
+	return &CommandSpeechToText{Command: fields[0], Args: fields[1:]}, nil
+}
+
+// Transcribe 把音频写入临时 WAV 文件并运行命令
+func (c *CommandSpeechToText) Transcribe(ctx context.Context, audio []byte) (string, error) {
+	dir, err := os.MkdirTemp("", "voice-agent-stt")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	wavPath := filepath.Join(dir, "input.wav")
+	if err := writePCMWAVFile(wavPath, mulawToPCM(audio), 8000); err != nil {
+		return "", fmt.Errorf("写入临时音频失败: %w", err)
+	}
+
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = strings.ReplaceAll(arg, "{wav}", wavPath)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Command, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("语音识别命令失败: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// FakeSpeechToText 按顺序返回预设的识别结果，用尽后返回空串；用于测试和离线演示
+type FakeSpeechToText struct {
+	mu          sync.Mutex
+	Transcripts []string
+}
+
+// Transcribe 返回下一条预设结果
+func (f *FakeSpeechToText) Transcribe(ctx context.Context, audio []byte) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.Transcripts) == 0 {
+		return "", nil
+	}
+	text := f.Transcripts[0]
+	f.Transcripts = f.Transcripts[1:]
+	return text, nil
+}
+
+// FakeTextToSpeech 确定性的占位 TTS：每个字生成一段固定时长的提示音，字之间有短暂停顿
+type FakeTextToSpeech struct {
+	// PerRune 每个字的时长，为零时 80ms
+	PerRune time.Duration
+}
+
+// Synthesize 生成与文本长度成正比的 8kHz PCM
+func (f FakeTextToSpeech) Synthesize(ctx context.Context, text string) ([]byte, error) {
+	perRune := f.PerRune
+	if perRune <= 0 {
+		perRune = 80 * time.Millisecond
+	}
+	var pcm bytes.Buffer
+	tone := tonePCM(440, perRune*3/4, 0.2)
+	gap := make([]byte, int(perRune.Seconds()*8000/4)*2)
+	for _, r := range text {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if unicode.IsSpace(r) || unicode.IsPunct(r) {
+			pcm.Write(gap)
+			continue
+		}
+		pcm.Write(tone)
+		pcm.Write(gap)
+	}
+	return pcm.Bytes(), nil
+}
+
+// FakeLanguageModel 把用户发言原样（加上前缀）按字流式返回；用于测试和离线演示
+type FakeLanguageModel struct {
+	Prefix string
+}
+
+// StreamReply 逐字写入回复
+func (f FakeLanguageModel) StreamReply(ctx context.Context, system string, history []ConversationMessage, out chan<- string) error {
+	if len(history) == 0 {
+		return errors.New("对话历史为空")
+	}
+	for _, r := range f.Prefix + history[len(history)-1].Text {
+		select {
+		case out <- string(r):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// tonePCM 生成 8kHz 16-bit 正弦波 PCM
+func tonePCM(freq float64, duration time.Duration, volume float64) []byte {
+	n := int(duration.Seconds() * 8000)
+	pcm := make([]byte, n*2)
+	for i := 0; i < n; i++ {
+		sample := int16(volume * 32767 * math.Sin(2*math.Pi*freq*float64(i)/8000))
+		pcm[i*2] = byte(sample)
+		pcm[i*2+1] = byte(uint16(sample) >> 8)
+	}
+	return pcm
+}
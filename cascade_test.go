@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gatedTextToSpeech 第一句立即合成，之后的句子等到回复被取消（最多 wait）才返回，
+// 用来确定地检查打断后不再合成后面的句子
+type gatedTextToSpeech struct {
+	wait  time.Duration
+	calls atomic.Int32
+}
+
+func (g *gatedTextToSpeech) Synthesize(ctx context.Context, text string) ([]byte, error) {
+	if g.calls.Add(1) > 1 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(g.wait):
+		}
+	}
+	return FakeTextToSpeech{PerRune: time.Millisecond}.Synthesize(ctx, text)
+}
+
+// runCascade 在后台运行级联处理线程，返回送入一段语音的函数
+func runCascade(t *testing.T, va *VoiceAgent) func() {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		va.RunCascade(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return func() {
+		audio := make([]byte, 800)
+		va.audioInputChan <- AudioChunk{Data: audio, Timestamp: time.Now()}
+	}
+}
+
+func TestCascadeReply(t *testing.T) {
+	va := newTestAgent(t)
+	va.stt = &FakeSpeechToText{Transcripts: []string{"你好", "再见"}}
+	va.llm = FakeLanguageModel{Prefix: "收到。"}
+	va.tts = FakeTextToSpeech{PerRune: time.Millisecond}
+	say := runCascade(t, va)
+
+	say()
+	var chunks []AudioChunk
+	for len(chunks) < 2 {
+		select {
+		case chunk := <-va.audioOutputChan:
+			chunks = append(chunks, chunk)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("只收到 %d 段回复音频", len(chunks))
+		}
+	}
+	if chunks[0].ContentID == chunks[1].ContentID {
+		t.Errorf("每句回复应使用独立的内容块: %s", chunks[0].ContentID)
+	}
+
+	// 回复还在“播放”时不提交，下一轮用户发言开始时才记录
+	say()
+	ok := waitFor(t, 2*time.Second, func() bool { return len(va.GetConversationHistory()) >= 3 })
+	history := va.GetConversationHistory()
+	if !ok {
+		t.Fatalf("对话记录 = %+v", history)
+	}
+	user, assistant := history[0], history[1]
+	if user.Role != RoleUser || user.Text != "你好" || len(user.Content) == 0 {
+		t.Errorf("用户轮次 = %s %q (%d 字节音频)", user.Role, user.Text, len(user.Content))
+	}
+	if assistant.Role != RoleAssistant || assistant.Text != "收到。你好" || assistant.Interrupted {
+		t.Errorf("回复轮次 = %s %q interrupted=%v", assistant.Role, assistant.Text, assistant.Interrupted)
+	}
+	if want := len(chunks[0].Data) + len(chunks[1].Data); len(assistant.Content) != want {
+		t.Errorf("回复音频 %d 字节，want %d", len(assistant.Content), want)
+	}
+	if history[2].Role != RoleUser || history[2].Text != "再见" {
+		t.Errorf("第二轮用户发言 = %s %q", history[2].Role, history[2].Text)
+	}
+}
+
+func TestCascadeBargeInCancelsReply(t *testing.T) {
+	va := newTestAgent(t)
+	va.stt = &FakeSpeechToText{Transcripts: []string{"讲个故事", "停一下"}}
+	va.llm = FakeLanguageModel{Prefix: "第一句。第二句。第三句。"}
+	tts := &gatedTextToSpeech{wait: time.Second}
+	va.tts = tts
+	say := runCascade(t, va)
+
+	say()
+	select {
+	case <-va.audioOutputChan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("没有收到第一句的音频")
+	}
+	// 用户开口打断：回复应立即取消，后面的句子不再合成和播放
+	va.interruptPlayback("vad", "")
+	select {
+	case chunk := <-va.audioOutputChan:
+		t.Fatalf("打断后仍然播放了 %s", chunk.ContentID)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if calls := tts.calls.Load(); calls > 2 {
+		t.Errorf("打断后又合成了 %d 句", calls-2)
+	}
+
+	say()
+	ok := waitFor(t, 2*time.Second, func() bool { return len(va.GetConversationHistory()) >= 3 })
+	history := va.GetConversationHistory()
+	if !ok {
+		t.Fatalf("对话记录 = %+v", history)
+	}
+	// 被打断的回复在下一轮用户发言之前提交，并标记为被打断
+	assistant := history[1]
+	if assistant.Role != RoleAssistant || !assistant.Interrupted {
+		t.Errorf("回复轮次 = %s interrupted=%v", assistant.Role, assistant.Interrupted)
+	}
+	if !strings.HasPrefix(assistant.Text, "第一句。") || strings.Contains(assistant.Text, "第三句") {
+		t.Errorf("回复文本 = %q", assistant.Text)
+	}
+	if history[2].Role != RoleUser || history[2].Text != "停一下" {
+		t.Errorf("第二轮用户发言 = %s %q", history[2].Role, history[2].Text)
+	}
+}
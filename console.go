@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// calibrationDuration /calibrate 采集环境噪音的时长
+const calibrationDuration = 2 * time.Second
+
+// Console 会话中的交互式控制台：以 / 开头的行是命令，其他行作为文字输入发送
+// 与录音、发送、播放线程并行运行
+type Console struct {
+	agent *VoiceAgent
+	out   io.Writer
+	// quit 执行 /quit 时调用
+	quit func()
+	// saveDir /save 的默认保存目录
+	saveDir  string
+	commands []consoleCommand
+}
+
+// consoleCommand 一条控制台命令
+type consoleCommand struct {
+	name  string
+	usage string
+	help  string
+	run   func(ctx context.Context, args []string) error
+}
+
+// errUsage 命令参数不对，打印用法
+var errUsage = errors.New("用法错误")
+
+// NewConsole 创建控制台，输出写入 out，saveDir 为 /save 的默认目录
+func NewConsole(agent *VoiceAgent, out io.Writer, saveDir string, quit func()) *Console {
+	c := &Console{agent: agent, out: out, quit: quit, saveDir: saveDir}
+	c.commands = []consoleCommand{
+		{name: "reset", help: "开始新会话，清除对话历史（模型侧也换用新会话）", run: c.reset},
+		{name: "history", help: "显示对话历史", run: c.history},
+		{name: "mute", help: "麦克风静音", run: c.mute},
+		{name: "unmute", help: "取消麦克风静音", run: c.unmute},
+		{name: "threshold", usage: "[n]", help: "查看或设置 VAD 能量阈值", run: c.threshold},
+		{name: "calibrate", help: "采集 2 秒环境噪音并校准 VAD 阈值（请保持安静）", run: c.calibrate},
+		{name: "voice", usage: "[id]", help: "查看或切换 Sonic 输出音色", run: c.voice},
+		{name: "persona", usage: "[name]", help: "查看或切换人设", run: c.persona},
+		{name: "prompt", help: "打印当前人设渲染后的系统提示", run: c.prompt},
+		{name: "save", usage: "[dir]", help: "把当前对话另存为快照", run: c.save},
+		{name: "help", help: "显示命令列表", run: c.help},
+		{name: "quit", help: "退出程序", run: c.quitCommand},
+	}
+	return c
+}
+
+// Run 逐行读取输入直到输入结束或 ctx 取消
+func (c *Console) Run(ctx context.Context, in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := c.Execute(ctx, scanner.Text()); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fmt.Fprintf(c.out, "错误: %v\n", err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Execute 执行一行输入
+func (c *Console) Execute(ctx context.Context, line string) error {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "/") {
+		return c.agent.SendText(ctx, line)
+	}
+
+	fields := strings.Fields(line[1:])
+	if len(fields) == 0 {
+		return c.help(ctx, nil)
+	}
+	for _, cmd := range c.commands {
+		if cmd.name != fields[0] {
+			continue
+		}
+		err := cmd.run(ctx, fields[1:])
+		if errors.Is(err, errUsage) {
+			return fmt.Errorf("用法: /%s %s", cmd.name, cmd.usage)
+		}
+		return err
+	}
+	return fmt.Errorf("未知命令 /%s，输入 /help 查看命令列表", fields[0])
+}
+
+func (c *Console) reset(ctx context.Context, args []string) error {
+	c.agent.ResetSession()
+	sessionID, _, _ := c.agent.GetSessionInfo()
+	fmt.Fprintf(c.out, "已开始新会话 %s\n", sessionID)
+	return nil
+}
+
+func (c *Console) history(ctx context.Context, args []string) error {
+	messages := c.agent.GetConversationHistory()
+	if len(messages) == 0 {
+		fmt.Fprintln(c.out, "（对话历史为空）")
+		return nil
+	}
+	if summary, summarized := c.agent.ConversationSummary(); summary != nil {
+		fmt.Fprintf(c.out, "摘要（前 %d 轮）: %s\n", summarized, summary.Text)
+	}
+	for i, msg := range messages {
+		var label string
+		switch msg.Role {
+		case RoleUser:
+			label = "用户"
+		case RoleAssistant:
+			label = "助手"
+		case RoleSummary:
+			label = "摘要"
+		default:
+			label = msg.Role
+		}
+		text := msg.Text
+		if text == "" && len(msg.Content) > 0 {
+			text = fmt.Sprintf("（语音 %.1f 秒）", mulawDuration(msg.Content).Seconds())
+		}
+		if msg.Interrupted {
+			text += "（被打断）"
+		}
+		fmt.Fprintf(c.out, "%3d %s %s: %s\n", i+1, msg.StartTime.Format("15:04:05"), label, text)
+	}
+	return nil
+}
+
+func (c *Console) mute(ctx context.Context, args []string) error {
+	c.agent.SetMuted(true)
+	fmt.Fprintln(c.out, "麦克风已静音，仍可输入文字")
+	return nil
+}
+
+func (c *Console) unmute(ctx context.Context, args []string) error {
+	c.agent.SetMuted(false)
+	fmt.Fprintln(c.out, "麦克风已打开")
+	return nil
+}
+
+func (c *Console) threshold(ctx context.Context, args []string) error {
+	switch len(args) {
+	case 0:
+		fmt.Fprintf(c.out, "VAD 能量阈值: %.0f（最近一帧能量 %.0f）\n", c.agent.EnergyThreshold(), c.agent.vad.LastEnergy())
+		return nil
+	case 1:
+		threshold, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			return errUsage
+		}
+		if err := c.agent.SetEnergyThreshold(threshold); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "VAD 能量阈值已设为 %.0f\n", threshold)
+		return nil
+	default:
+		return errUsage
+	}
+}
+
+func (c *Console) calibrate(ctx context.Context, args []string) error {
+	fmt.Fprintf(c.out, "正在采集 %s 环境噪音，请保持安静……\n", calibrationDuration)
+	threshold, err := c.agent.CalibrateVAD(ctx, calibrationDuration)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "VAD 能量阈值已校准为 %.0f\n", threshold)
+	return nil
+}
+
+func (c *Console) voice(ctx context.Context, args []string) error {
+	switch len(args) {
+	case 0:
+		fmt.Fprintf(c.out, "当前音色: %s，可用音色: %s\n", c.agent.Voice(), strings.Join(SonicVoices(), ", "))
+		return nil
+	case 1:
+		if err := c.agent.SetVoice(args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "音色已切换为 %s，对话空闲时生效\n", c.agent.Voice())
+		return nil
+	default:
+		return errUsage
+	}
+}
+
+func (c *Console) persona(ctx context.Context, args []string) error {
+	switch len(args) {
+	case 0:
+		current := c.agent.Persona()
+		for _, p := range c.agent.Personas() {
+			mark := " "
+			if p.Name == current.Name {
+				mark = "*"
+			}
+			fmt.Fprintf(c.out, "%s %-14s %-9s %-6s %s\n", mark, p.Name, p.VoiceID, p.Language, p.Description)
+		}
+		return nil
+	case 1:
+		if err := c.agent.SetPersona(args[0]); err != nil {
+			return err
+		}
+		persona := c.agent.Persona()
+		fmt.Fprintf(c.out, "人设已切换为 %s（音色 %s），对话空闲时生效\n", persona.Name, persona.VoiceID)
+		return nil
+	default:
+		return errUsage
+	}
+}
+
+func (c *Console) prompt(ctx context.Context, args []string) error {
+	text, err := c.agent.RenderSystemPrompt()
+	if err != nil {
+		return err
+	}
+	persona := c.agent.Persona()
+	source := "人设 " + persona.Name
+	if path := c.agent.promptTemplate().Path(); path != "" {
+		source = path
+	}
+	fmt.Fprintf(c.out, "# 系统提示（%s）\n%s\n", source, text)
+	return nil
+}
+
+func (c *Console) save(ctx context.Context, args []string) error {
+	dir := c.saveDir
+	switch len(args) {
+	case 0:
+	case 1:
+		dir = args[0]
+	default:
+		return errUsage
+	}
+	snapshotID, err := c.agent.ExportConversation(dir)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "对话已保存为 %s，可用 -store file:%s -resume %s 恢复\n", snapshotID, dir, snapshotID)
+	return nil
+}
+
+func (c *Console) help(ctx context.Context, args []string) error {
+	for _, cmd := range c.commands {
+		name := "/" + cmd.name
+		if cmd.usage != "" {
+			name += " " + cmd.usage
+		}
+		fmt.Fprintf(c.out, "  %-16s %s\n", name, cmd.help)
+	}
+	fmt.Fprintln(c.out, "  其他输入作为文字发送给助手")
+	return nil
+}
+
+func (c *Console) quitCommand(ctx context.Context, args []string) error {
+	if c.quit != nil {
+		c.quit()
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrContentLifecycle 输入内容块的事件顺序不符合 Sonic 协议
+var ErrContentLifecycle = errors.New("内容块生命周期错误")
+
+// trackedContent 一个输入内容块
+type trackedContent struct {
+	Name        string
+	Type        string
+	Role        string
+	Interactive bool
+	OpenedAt    time.Time
+	// Events 已发送的 audioInput/textInput/toolResult 数量
+	Events int
+	Closed bool
+}
+
+// ContentTracker 跟踪一个 prompt 内输入内容块的生命周期
+// Sonic 要求每个内容块按 contentStart → 输入事件 → contentEnd 的顺序发送，
+// 且同一 prompt 内的 contentName 不能重复使用，违反时服务端会直接关闭流
+type ContentTracker struct {
+	mu         sync.Mutex
+	promptName string
+	contents   map[string]*trackedContent
+	// open 尚未结束的内容块，按打开顺序
+	open []string
+	seq  int
+}
+
+// NewContentTracker 创建指定 prompt 的内容块跟踪器
+func NewContentTracker(promptName string) *ContentTracker {
+	return &ContentTracker{
+		promptName: promptName,
+		contents:   make(map[string]*trackedContent),
+	}
+}
+
+// NewName 生成本 prompt 内唯一的内容块名称，如 audio_3_1712345678
+func (t *ContentTracker) NewName(prefix string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq++
+	return fmt.Sprintf("%s_%d_%d", prefix, t.seq, time.Now().UnixNano())
+}
+
+// Observe 校验即将发送的事件并更新内容块状态，不合法时返回 ErrContentLifecycle 且状态不变
+func (t *ContentTracker) Observe(event SonicInput) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch e := event.(type) {
+	case ContentStartEvent:
+		if err := t.checkPrompt(e.PromptName); err != nil {
+			return err
+		}
+		if _, used := t.contents[e.ContentName]; used {
+			return fmt.Errorf("%w: contentName %q 已使用过", ErrContentLifecycle, e.ContentName)
+		}
+		if e.Type == ContentTypeAudio {
+			for _, name := range t.open {
+				if t.contents[name].Type == ContentTypeAudio {
+					return fmt.Errorf("%w: 音频内容 %q 尚未结束", ErrContentLifecycle, name)
+				}
+			}
+		}
+		t.contents[e.ContentName] = &trackedContent{
+			Name:        e.ContentName,
+			Type:        e.Type,
+			Role:        e.Role,
+			Interactive: e.Interactive,
+			OpenedAt:    time.Now(),
+		}
+		t.open = append(t.open, e.ContentName)
+
+	case AudioInputEvent:
+		return t.observeInput(e.PromptName, e.ContentName, ContentTypeAudio)
+	case TextInputEvent:
+		return t.observeInput(e.PromptName, e.ContentName, ContentTypeText)
+	case ToolResultEvent:
+		return t.observeInput(e.PromptName, e.ContentName, ContentTypeTool)
+
+	case ContentEndEvent:
+		if err := t.checkPrompt(e.PromptName); err != nil {
+			return err
+		}
+		content, err := t.openContent(e.ContentName)
+		if err != nil {
+			return err
+		}
+		content.Closed = true
+		for i, name := range t.open {
+			if name == e.ContentName {
+				t.open = append(t.open[:i], t.open[i+1:]...)
+				break
+			}
+		}
+
+	case PromptEndEvent:
+		if err := t.checkPrompt(e.PromptName); err != nil {
+			return err
+		}
+		if len(t.open) > 0 {
+			return fmt.Errorf("%w: promptEnd 前仍有未结束的内容 %v", ErrContentLifecycle, t.open)
+		}
+	}
+	return nil
+}
+
+// Open 获取尚未结束的内容块名称，按打开顺序
+func (t *ContentTracker) Open() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.open...)
+}
+
+// checkPrompt 校验事件属于本 prompt
+func (t *ContentTracker) checkPrompt(promptName string) error {
+	if promptName != t.promptName {
+		return fmt.Errorf("%w: promptName %q 与当前 prompt %q 不符", ErrContentLifecycle, promptName, t.promptName)
+	}
+	return nil
+}
+
+// openContent 获取已打开且未结束的内容块
+func (t *ContentTracker) openContent(name string) (*trackedContent, error) {
+	content, ok := t.contents[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: 内容 %q 未打开", ErrContentLifecycle, name)
+	}
+	if content.Closed {
+		return nil, fmt.Errorf("%w: 内容 %q 已结束", ErrContentLifecycle, name)
+	}
+	return content, nil
+}
+
+// observeInput 校验输入事件发送到类型匹配的已打开内容块
+func (t *ContentTracker) observeInput(promptName, contentName, contentType string) error {
+	if err := t.checkPrompt(promptName); err != nil {
+		return err
+	}
+	content, err := t.openContent(contentName)
+	if err != nil {
+		return err
+	}
+	if content.Type != contentType {
+		return fmt.Errorf("%w: 内容 %q 的类型是 %s，不能发送 %s 输入", ErrContentLifecycle, contentName, content.Type, contentType)
+	}
+	content.Events++
+	return nil
+}
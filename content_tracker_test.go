@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestContentTrackerLifecycle(t *testing.T) {
+	const prompt = "prompt-1"
+	audioStart := func(name string) SonicInput {
+		return ContentStartEvent{PromptName: prompt, ContentName: name, Type: ContentTypeAudio, Role: SonicRoleUser, Interactive: true}
+	}
+	textStart := func(name string) SonicInput {
+		return ContentStartEvent{PromptName: prompt, ContentName: name, Type: ContentTypeText, Role: SonicRoleSystem}
+	}
+	audio := func(name string) SonicInput {
+		return AudioInputEvent{PromptName: prompt, ContentName: name, Content: "AAAA"}
+	}
+	end := func(name string) SonicInput {
+		return ContentEndEvent{PromptName: prompt, ContentName: name}
+	}
+
+	tests := []struct {
+		name   string
+		events []SonicInput
+		// rejected 最后一个事件应被拒绝
+		rejected bool
+		open     []string
+	}{
+		{
+			name:   "正常顺序",
+			events: []SonicInput{textStart("sys"), TextInputEvent{PromptName: prompt, ContentName: "sys", Content: "hi"}, end("sys"), audioStart("a1"), audio("a1"), audio("a1")},
+			open:   []string{"a1"},
+		},
+		{
+			name:     "未打开就发送输入",
+			events:   []SonicInput{audio("a1")},
+			rejected: true,
+		},
+		{
+			name:     "结束后继续发送输入",
+			events:   []SonicInput{audioStart("a1"), end("a1"), audio("a1")},
+			rejected: true,
+		},
+		{
+			name:     "输入类型与内容块不符",
+			events:   []SonicInput{textStart("sys"), audio("sys")},
+			rejected: true,
+			open:     []string{"sys"},
+		},
+		{
+			name:     "重复的内容块名称",
+			events:   []SonicInput{textStart("sys"), end("sys"), textStart("sys")},
+			rejected: true,
+		},
+		{
+			name:     "第二个未结束的音频内容",
+			events:   []SonicInput{audioStart("a1"), audioStart("a2")},
+			rejected: true,
+			open:     []string{"a1"},
+		},
+		{
+			name:   "音频与文本可以同时打开",
+			events: []SonicInput{audioStart("a1"), textStart("t1")},
+			open:   []string{"a1", "t1"},
+		},
+		{
+			name:     "未打开就结束",
+			events:   []SonicInput{end("a1")},
+			rejected: true,
+		},
+		{
+			name:     "重复结束",
+			events:   []SonicInput{audioStart("a1"), end("a1"), end("a1")},
+			rejected: true,
+		},
+		{
+			name:     "promptName 不符",
+			events:   []SonicInput{ContentStartEvent{PromptName: "other", ContentName: "a1", Type: ContentTypeAudio}},
+			rejected: true,
+		},
+		{
+			name:     "promptEnd 前仍有未结束的内容",
+			events:   []SonicInput{audioStart("a1"), PromptEndEvent{PromptName: prompt}},
+			rejected: true,
+			open:     []string{"a1"},
+		},
+		{
+			name:   "内容全部结束后 promptEnd",
+			events: []SonicInput{audioStart("a1"), end("a1"), PromptEndEvent{PromptName: prompt}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewContentTracker(prompt)
+			for i, event := range tt.events {
+				err := tracker.Observe(event)
+				last := i == len(tt.events)-1
+				if last && tt.rejected {
+					if !errors.Is(err, ErrContentLifecycle) {
+						t.Fatalf("%s 应被拒绝, got %v", event.InputType(), err)
+					}
+				} else if err != nil {
+					t.Fatalf("第 %d 个事件 %s: %v", i+1, event.InputType(), err)
+				}
+			}
+			if got := tracker.Open(); !reflect.DeepEqual(got, tt.open) && len(got)+len(tt.open) > 0 {
+				t.Errorf("未结束的内容 = %v, want %v", got, tt.open)
+			}
+		})
+	}
+}
+
+func TestContentTrackerNewNameUnique(t *testing.T) {
+	tracker := NewContentTracker("prompt-1")
+	seen := make(map[string]bool)
+	for range 100 {
+		name := tracker.NewName("audio")
+		if seen[name] {
+			t.Fatalf("重复的内容块名称 %q", name)
+		}
+		seen[name] = true
+	}
+}
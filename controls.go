@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultVoiceID Sonic 默认的输出音色
+const DefaultVoiceID = "matthew"
+
+// minCalibratedThreshold 校准后的最低能量阈值，过于安静的环境按噪音的 3 倍算会把呼吸声当成语音
+const minCalibratedThreshold = 100.0
+
+// calibrationRequest 一次环境噪音采样：录音回调把麦克风数据写入 buf，采满后交给 done
+type calibrationRequest struct {
+	need int
+	buf  []byte
+	done chan []byte
+}
+
+// calibration 正在进行的噪音采样，mu 保护 req
+type calibration struct {
+	mu  sync.Mutex
+	req *calibrationRequest
+}
+
+// capture 有采样请求时收下这一帧并返回 true，采样期间不做语音检测
+func (c *calibration) capture(pcmData []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.req == nil {
+		return false
+	}
+	c.req.buf = append(c.req.buf, pcmData...)
+	if len(c.req.buf) >= c.req.need {
+		c.req.done <- c.req.buf
+		c.req = nil
+	}
+	return true
+}
+
+// SetMuted 麦克风静音：静音期间丢弃麦克风数据，说到一半的语音也被丢弃
+func (va *VoiceAgent) SetMuted(muted bool) {
+	if va.muted.Swap(muted) != muted {
+		va.log().Info("麦克风静音状态已改变", "muted", muted)
+	}
+}
+
+// Muted 麦克风是否静音
+func (va *VoiceAgent) Muted() bool {
+	return va.muted.Load()
+}
+
+// SetEnergyThreshold 调整 VAD 能量阈值
+func (va *VoiceAgent) SetEnergyThreshold(threshold float64) error {
+	if threshold <= 0 {
+		return fmt.Errorf("能量阈值必须大于 0")
+	}
+	va.vad.SetEnergyThreshold(threshold)
+	va.log().Info("VAD 能量阈值已调整", "threshold", threshold)
+	return nil
+}
+
+// EnergyThreshold 当前的 VAD 能量阈值
+func (va *VoiceAgent) EnergyThreshold() float64 {
+	return va.vad.GetEnergyThreshold()
+}
+
+// CalibrateVAD 采集一段环境噪音并据此设置 VAD 阈值，返回新的阈值
+// 需要录音线程在运行，采样期间请保持安静
+func (va *VoiceAgent) CalibrateVAD(ctx context.Context, duration time.Duration) (float64, error) {
+	req := &calibrationRequest{
+		need: int(duration.Seconds() * 8000 * 2),
+		done: make(chan []byte, 1),
+	}
+	va.calibration.mu.Lock()
+	if va.calibration.req != nil {
+		va.calibration.mu.Unlock()
+		return 0, fmt.Errorf("校准正在进行")
+	}
+	va.calibration.req = req
+	va.calibration.mu.Unlock()
+
+	cancel := func() {
+		va.calibration.mu.Lock()
+		if va.calibration.req == req {
+			va.calibration.req = nil
+		}
+		va.calibration.mu.Unlock()
+	}
+
+	timer := time.NewTimer(duration + 2*time.Second)
+	defer timer.Stop()
+	select {
+	case noise := <-req.done:
+		va.vad.CalibrateThreshold(noise)
+		threshold := va.vad.GetEnergyThreshold()
+		if threshold < minCalibratedThreshold {
+			threshold = minCalibratedThreshold
+			va.vad.SetEnergyThreshold(threshold)
+		}
+		va.log().Info("VAD 已校准", "noise_rms", va.vad.CalculateRMS(noise), "threshold", threshold)
+		return threshold, nil
+	case <-timer.C:
+		cancel()
+		return 0, fmt.Errorf("没有收到麦克风数据，录音线程是否已启动")
+	case <-ctx.Done():
+		cancel()
+		return 0, ctx.Err()
+	}
+}
+
+// SetVoice 切换 Sonic 输出音色，音色在 promptStart 中指定，切换后在对话空闲时换用新会话
+// 音色的语言必须与人设的回复语言一致，除非人设设置了 AllowVoiceMismatch
+func (va *VoiceAgent) SetVoice(voiceID string) error {
+	voiceID = normalizeVoiceID(voiceID)
+	if err := validateVoiceID(voiceID); err != nil {
+		return err
+	}
+	va.personaMu.Lock()
+	candidate := va.persona
+	candidate.VoiceID = voiceID
+	if locale := candidate.VoiceLanguageMismatch(); locale != "" && !candidate.AllowVoiceMismatch {
+		va.personaMu.Unlock()
+		return fmt.Errorf("音色 %s（%s）与人设 %s 的回复语言 %s 不一致", voiceID, locale, candidate.Name, candidate.Language)
+	}
+	changed := va.persona.VoiceID != voiceID
+	va.persona.VoiceID = voiceID
+	persona := va.persona
+	va.personaMu.Unlock()
+
+	if changed {
+		va.log().Info("输出音色已切换", "voice_id", voiceID)
+		va.logPersona(persona)
+		va.requestRenewal()
+	}
+	return nil
+}
+
+// Voice 当前的 Sonic 输出音色
+func (va *VoiceAgent) Voice() string {
+	return va.Persona().VoiceID
+}
+
+// SetPersona 按名称切换人设，切换后在对话空闲时换用新会话，对话历史保留
+func (va *VoiceAgent) SetPersona(name string) error {
+	persona, err := FindPersona(va.personas, name)
+	if err != nil {
+		return err
+	}
+	if err := va.tools.checkNames(persona.Tools); err != nil {
+		return fmt.Errorf("人设 %s: %w", persona.Name, err)
+	}
+	prompt, err := persona.PromptTemplate()
+	if err != nil {
+		return fmt.Errorf("人设 %s 的系统提示: %w", persona.Name, err)
+	}
+	va.personaMu.Lock()
+	va.persona = persona
+	va.prompt = prompt
+	va.personaMu.Unlock()
+
+	va.log().Info("人设已切换", "persona", persona.Name, "voice_id", persona.VoiceID, "language", persona.Language)
+	va.logPersona(persona)
+	va.requestRenewal()
+	return nil
+}
+
+// Persona 当前的人设
+func (va *VoiceAgent) Persona() Persona {
+	va.personaMu.Lock()
+	defer va.personaMu.Unlock()
+	return va.persona
+}
+
+// Personas 可切换的人设
+func (va *VoiceAgent) Personas() []Persona {
+	return va.personas
+}
+
+// Inference 当前人设的推理参数
+func (va *VoiceAgent) Inference() InferenceConfiguration {
+	return va.Persona().Inference
+}
+
+// promptTemplate 当前人设的系统提示模板
+func (va *VoiceAgent) promptTemplate() *PromptTemplate {
+	va.personaMu.Lock()
+	defer va.personaMu.Unlock()
+	return va.prompt
+}
+
+// RenderSystemPrompt 按当前人设、时间和会话变量渲染系统提示，提示文件修改过时先重新加载
+func (va *VoiceAgent) RenderSystemPrompt() (string, error) {
+	persona := va.Persona()
+	prompt := va.promptTemplate()
+	if reloaded, err := prompt.Reload(); err != nil {
+		va.log().Warn("重新加载系统提示失败，继续使用上一版", "file", prompt.Path(), "error", err)
+	} else if reloaded {
+		va.log().Info("系统提示文件已重新加载", "file", prompt.Path())
+	}
+	sessionID, _, _ := va.GetSessionInfo()
+	return prompt.Render(newPromptVars(time.Now(), persona, sessionID, va.vars))
+}
+
+// SystemPrompt 渲染系统提示，Sonic 和级联模式共用
+// 模板执行失败时记录错误并使用默认的系统提示
+func (va *VoiceAgent) SystemPrompt() string {
+	prompt, err := va.RenderSystemPrompt()
+	if err != nil {
+		va.log().Error("渲染系统提示失败，使用默认的系统提示", "persona", va.Persona().Name, "error", err)
+		fallback, _ := NewPromptTemplate(defaultSystemPrompt)
+		prompt, _ = fallback.Render(newPromptVars(time.Now(), BuiltinPersonas()[0], "", SessionVars{}))
+	}
+	return prompt
+}
+
+// toolDefinitions 当前人设可用的工具定义
+func (va *VoiceAgent) toolDefinitions() []ToolDefinition {
+	return va.tools.DefinitionsFor(va.Persona().Tools)
+}
+
+// logPersona 人设允许音色的语言与回复语言不一致时提示
+func (va *VoiceAgent) logPersona(persona Persona) {
+	if locale := persona.VoiceLanguageMismatch(); locale != "" {
+		va.log().Info("音色的语言与人设的回复语言不一致，发音可能不自然",
+			"persona", persona.Name, "voice_id", persona.VoiceID, "voice_locale", locale, "language", persona.Language)
+	}
+}
+
+// requestRenewal 请求发送线程尽快换用新的 Sonic 会话（沿用续期流程，重放对话历史）
+func (va *VoiceAgent) requestRenewal() {
+	select {
+	case va.renewChan <- struct{}{}:
+	default:
+	}
+}
+
+// ExportConversation 把当前对话（含音频）另存为一个新会话，返回快照的会话 ID
+// 快照按文件存储的格式写入 dir，可以用 -store file:<dir> -resume <ID> 恢复
+func (va *VoiceAgent) ExportConversation(dir string) (string, error) {
+	va.contextMu.Lock()
+	sessionID, startTime := va.context.SessionID, va.context.StartTime
+	messages := append([]ConversationMessage(nil), va.context.Messages...)
+	va.contextMu.Unlock()
+	summary, summarized := va.ConversationSummary()
+
+	store, err := NewFileSessionStore(dir)
+	if err != nil {
+		return "", err
+	}
+	snapshotID := fmt.Sprintf("%s_%s", sessionID, time.Now().Format("20060102_150405"))
+	if err := store.CreateSession(snapshotID, startTime); err != nil {
+		return "", err
+	}
+	for _, msg := range messages {
+		if err := store.AppendTurn(snapshotID, msg); err != nil {
+			return "", err
+		}
+	}
+	if summary != nil {
+		if err := store.SaveSummary(snapshotID, *summary, summarized); err != nil {
+			return "", err
+		}
+	}
+	va.log().Info("对话已另存", logKeySession, snapshotID, "dir", dir, "message_count", len(messages))
+	return snapshotID, nil
+}
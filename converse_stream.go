@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// BedrockLanguageModel 通过 ConverseStream 调用任意 Bedrock 文本模型，实现 LanguageModel
+type BedrockLanguageModel struct {
+	client  *bedrockruntime.Client
+	modelID string
+	// OnMetadata 收到 metadata 事件（token 用量、延迟）时调用，可为空
+	OnMetadata func(types.ConverseStreamMetadataEvent)
+	// Inference 返回当前的推理参数，为空时使用 DefaultInference
+	Inference func() InferenceConfiguration
+}
+
+// NewBedrockLanguageModel 创建 Bedrock 对话模型
+func NewBedrockLanguageModel(client *bedrockruntime.Client, modelID string) *BedrockLanguageModel {
+	return &BedrockLanguageModel{client: client, modelID: modelID}
+}
+
+// StreamReply 发起 ConverseStream 调用并把回复文本片段写入 out
+func (m *BedrockLanguageModel) StreamReply(ctx context.Context, system string, history []ConversationMessage, out chan<- string) error {
+	inference := DefaultInference()
+	if m.Inference != nil {
+		inference = m.Inference()
+	}
+	output, err := m.client.ConverseStream(ctx, &bedrockruntime.ConverseStreamInput{
+		ModelId: aws.String(m.modelID),
+		System: []types.SystemContentBlock{
+			&types.SystemContentBlockMemberText{Value: system},
+		},
+		Messages: converseMessages(history),
+		InferenceConfig: &types.InferenceConfiguration{
+			MaxTokens:   aws.Int32(int32(inference.MaxTokens)),
+			Temperature: aws.Float32(float32(inference.Temperature)),
+			TopP:        aws.Float32(float32(inference.TopP)),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("调用 ConverseStream 失败: %w", err)
+	}
+	return converseDeltas(ctx, output, out, m.OnMetadata)
+}
+
+// converseDeltas 消费 ConverseStream 事件流，把文本增量写入 out
+// MessageStart/MessageStop 只记录日志，Metadata 交给 onMetadata
+func converseDeltas(ctx context.Context, output *bedrockruntime.ConverseStreamOutput, out chan<- string, onMetadata func(types.ConverseStreamMetadataEvent)) error {
+	stream := output.GetStream()
+	defer stream.Close()
+
+	for event := range stream.Events() {
+		switch e := event.(type) {
+		case *types.ConverseStreamOutputMemberMessageStart:
+			slog.Debug("messageStart", logKeyRole, string(e.Value.Role))
+
+		case *types.ConverseStreamOutputMemberContentBlockDelta:
+			delta, ok := e.Value.Delta.(*types.ContentBlockDeltaMemberText)
+			if !ok {
+				continue
+			}
+			select {
+			case out <- delta.Value:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+		case *types.ConverseStreamOutputMemberMessageStop:
+			slog.Debug("messageStop", "stop_reason", string(e.Value.StopReason))
+
+		case *types.ConverseStreamOutputMemberMetadata:
+			if onMetadata != nil {
+				onMetadata(e.Value)
+			}
+		}
+	}
+	return stream.Err()
+}
+
+// converseMessages 把对话历史整理成 Converse 消息
+// Converse 要求以用户消息开头且角色交替，相邻的同角色消息合并为一条
+func converseMessages(history []ConversationMessage) []types.Message {
+	var messages []types.Message
+	for _, msg := range history {
+		if msg.Text == "" {
+			continue
+		}
+		role := types.ConversationRoleUser
+		if msg.Role == RoleAssistant {
+			role = types.ConversationRoleAssistant
+		}
+		block := &types.ContentBlockMemberText{Value: msg.Text}
+		if n := len(messages); n > 0 && messages[n-1].Role == role {
+			messages[n-1].Content = append(messages[n-1].Content, block)
+			continue
+		}
+		if len(messages) == 0 && role != types.ConversationRoleUser {
+			continue
+		}
+		messages = append(messages, types.Message{Role: role, Content: []types.ContentBlock{block}})
+	}
+	return messages
+}
+
+// sentenceEnds 句末标点，级联模式按句送入 TTS
+const sentenceEnds = "。！？；!?;\n"
+
+// splitSentences 从缓冲文本中切出完整的句子，返回句子和剩余的半句
+// 英文句点后面跟空白才算句末，避免把小数和缩写切开
+func splitSentences(text string) ([]string, string) {
+	var sentences []string
+	start := 0
+	runes := []rune(text)
+	for i, r := range runes {
+		end := strings.ContainsRune(sentenceEnds, r) ||
+			(r == '.' && i+1 < len(runes) && (runes[i+1] == ' ' || runes[i+1] == '\n'))
+		if !end {
+			continue
+		}
+		if sentence := strings.TrimSpace(string(runes[start : i+1])); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		start = i + 1
+	}
+	return sentences, string(runes[start:])
+}
+
+// recordConverseUsage 记录 ConverseStream metadata 中的 token 用量和延迟
+func (va *VoiceAgent) recordConverseUsage(meta types.ConverseStreamMetadataEvent) {
+	if usage := meta.Usage; usage != nil {
+		input := int(aws.ToInt32(usage.InputTokens))
+		output := int(aws.ToInt32(usage.OutputTokens))
+		va.usageMu.Lock()
+		va.usage.InputTextTokens += input
+		va.usage.OutputTextTokens += output
+		va.usage.TotalTokens += int(aws.ToInt32(usage.TotalTokens))
+		va.usageMu.Unlock()
+		va.metrics.Tokens.WithLabelValues("input", "text").Add(float64(input))
+		va.metrics.Tokens.WithLabelValues("output", "text").Add(float64(output))
+	}
+	if meta.Metrics != nil {
+		va.log().Debug("ConverseStream 完成", "latency_ms", aws.ToInt64(meta.Metrics.LatencyMs))
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+)
+
+// DefaultEmbeddingModelID 知识库向量检索默认使用的 Bedrock 向量模型
+const DefaultEmbeddingModelID = "amazon.titan-embed-text-v2:0"
+
+// Embedder 文本向量模型，本地知识库用它计算段落和问题的向量
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// BedrockEmbedder 通过 InvokeModel 调用 Titan Text Embeddings
+type BedrockEmbedder struct {
+	client  *bedrockruntime.Client
+	modelID string
+}
+
+// NewBedrockEmbedder 创建 Bedrock 向量模型
+func NewBedrockEmbedder(client *bedrockruntime.Client, modelID string) *BedrockEmbedder {
+	return &BedrockEmbedder{client: client, modelID: modelID}
+}
+
+// titanEmbeddingRequest Titan Text Embeddings V2 的请求
+type titanEmbeddingRequest struct {
+	InputText string `json:"inputText"`
+	Normalize bool   `json:"normalize"`
+}
+
+// titanEmbeddingResponse Titan Text Embeddings V2 的响应
+type titanEmbeddingResponse struct {
+	Embedding []float32 `json:"embedding"`
+}
+
+// Embed 返回文本的向量
+func (e *BedrockEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	body, err := json.Marshal(titanEmbeddingRequest{InputText: text, Normalize: true})
+	if err != nil {
+		return nil, err
+	}
+	output, err := e.client.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
+		ModelId:     aws.String(e.modelID),
+		ContentType: aws.String("application/json"),
+		Accept:      aws.String("application/json"),
+		Body:        body,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("调用向量模型失败: %w", err)
+	}
+	var resp titanEmbeddingResponse
+	if err := json.Unmarshal(output.Body, &resp); err != nil {
+		return nil, fmt.Errorf("解析向量模型响应失败: %w", err)
+	}
+	if len(resp.Embedding) == 0 {
+		return nil, fmt.Errorf("向量模型响应中没有向量")
+	}
+	return resp.Embedding, nil
+}
+
+// cosineSimilarity 两个向量的余弦相似度，维度不同或为零向量时返回 0
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
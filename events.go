@@ -0,0 +1,219 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AgentEvent 语音代理对外发布的事件
+type AgentEvent interface {
+	// EventName 事件名称，如 "speech_started"
+	EventName() string
+	// EventTime 事件发生时间
+	EventTime() time.Time
+}
+
+// SpeechStartedEvent 检测到用户开始说话
+type SpeechStartedEvent struct {
+	At     time.Time
+	TurnID int
+}
+
+// SpeechEndedEvent 用户说话结束
+type SpeechEndedEvent struct {
+	At       time.Time
+	TurnID   int
+	Duration time.Duration
+	// Audio 本次录制的 8kHz mulaw 音频
+	Audio []byte
+}
+
+// TranscriptPartialEvent 中间识别/生成结果（可能被后续结果修正）
+type TranscriptPartialEvent struct {
+	At   time.Time
+	Role string
+	Text string
+}
+
+// TranscriptFinalEvent 最终识别/生成结果
+type TranscriptFinalEvent struct {
+	At   time.Time
+	Role string
+	Text string
+}
+
+// AssistantTextEvent AI 回复文本
+type AssistantTextEvent struct {
+	At   time.Time
+	Text string
+}
+
+// AssistantAudioChunkEvent AI 回复音频块（8kHz mulaw）
+type AssistantAudioChunkEvent struct {
+	At   time.Time
+	Data []byte
+}
+
+// BargeInEvent AI 播放被打断
+type BargeInEvent struct {
+	At time.Time
+	// Source 打断来源: "vad" 本地检测, "model" 模型侧, "text" 文本输入
+	Source string
+	// ContentID 被打断的音频内容块
+	ContentID string
+	// Played 被打断前该内容块实际播放的时长
+	Played time.Duration
+	// HeardText 估算的用户实际听到的回复文本
+	HeardText string
+}
+
+// ToolCallEvent 模型发起工具调用
+type ToolCallEvent struct {
+	At        time.Time
+	ToolName  string
+	ToolUseID string
+	Input     string
+}
+
+// ErrorEvent 运行中的错误
+type ErrorEvent struct {
+	At time.Time
+	// Source 出错的组件，如 "stream"、"recording"
+	Source string
+	Err    error
+}
+
+// AudioLevelEvent 每个录音帧的能量和 VAD 判断，用于电平显示
+type AudioLevelEvent struct {
+	At time.Time
+	// Energy 该帧的 RMS 能量
+	Energy    float64
+	Threshold float64
+	State     VADState
+}
+
+// TurnStateChangedEvent 对话轮次状态转换
+type TurnStateChangedEvent struct {
+	At     time.Time
+	TurnID int
+	From   TurnState
+	To     TurnState
+	// Elapsed 在 From 状态停留的时长
+	Elapsed time.Duration
+	Reason  string
+}
+
+// SessionResetEvent 会话被重置
+type SessionResetEvent struct {
+	At           time.Time
+	OldSessionID string
+	NewSessionID string
+}
+
+func (e SpeechStartedEvent) EventName() string       { return "speech_started" }
+func (e SpeechEndedEvent) EventName() string         { return "speech_ended" }
+func (e TranscriptPartialEvent) EventName() string   { return "transcript_partial" }
+func (e TranscriptFinalEvent) EventName() string     { return "transcript_final" }
+func (e AssistantTextEvent) EventName() string       { return "assistant_text" }
+func (e AssistantAudioChunkEvent) EventName() string { return "assistant_audio_chunk" }
+func (e BargeInEvent) EventName() string             { return "barge_in" }
+func (e ToolCallEvent) EventName() string            { return "tool_call" }
+func (e ErrorEvent) EventName() string               { return "error" }
+func (e SessionResetEvent) EventName() string        { return "session_reset" }
+func (e AudioLevelEvent) EventName() string          { return "audio_level" }
+func (e TurnStateChangedEvent) EventName() string    { return "turn_state_changed" }
+
+func (e SpeechStartedEvent) EventTime() time.Time       { return e.At }
+func (e SpeechEndedEvent) EventTime() time.Time         { return e.At }
+func (e TranscriptPartialEvent) EventTime() time.Time   { return e.At }
+func (e TranscriptFinalEvent) EventTime() time.Time     { return e.At }
+func (e AssistantTextEvent) EventTime() time.Time       { return e.At }
+func (e AssistantAudioChunkEvent) EventTime() time.Time { return e.At }
+func (e BargeInEvent) EventTime() time.Time             { return e.At }
+func (e ToolCallEvent) EventTime() time.Time            { return e.At }
+func (e ErrorEvent) EventTime() time.Time               { return e.At }
+func (e SessionResetEvent) EventTime() time.Time        { return e.At }
+func (e AudioLevelEvent) EventTime() time.Time          { return e.At }
+func (e TurnStateChangedEvent) EventTime() time.Time    { return e.At }
+
+// EventBus 事件总线，订阅者各自拥有带缓冲的通道
+// 发布永不阻塞：订阅者处理不过来时事件会被丢弃并计数，
+// 因此可以在音频回调中安全调用 Publish
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[int]chan AgentEvent
+	nextID      int
+	closed      bool
+	dropped     atomic.Int64
+}
+
+// NewEventBus 创建事件总线
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[int]chan AgentEvent),
+	}
+}
+
+// Subscribe 订阅所有事件，返回事件通道和取消订阅函数
+func (b *EventBus) Subscribe(buffer int) (<-chan AgentEvent, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan AgentEvent, buffer)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = ch
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if sub, ok := b.subscribers[id]; ok {
+				delete(b.subscribers, id)
+				close(sub)
+			}
+		})
+	}
+	return ch, unsubscribe
+}
+
+// Publish 发布事件给所有订阅者
+func (b *EventBus) Publish(event AgentEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			b.dropped.Add(1)
+		}
+	}
+}
+
+// Dropped 获取因订阅者缓冲已满而丢弃的事件数
+func (b *EventBus) Dropped() int64 {
+	return b.dropped.Load()
+}
+
+// Close 关闭事件总线及所有订阅通道
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for id, ch := range b.subscribers {
+		delete(b.subscribers, id)
+		close(ch)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventBusDropsForFullSubscriber(t *testing.T) {
+	bus := NewEventBus()
+	defer bus.Close()
+
+	// slow 从不读取，缓冲只有 1；fast 的缓冲足够
+	slow, unsubscribeSlow := bus.Subscribe(1)
+	defer unsubscribeSlow()
+	fast, unsubscribeFast := bus.Subscribe(10)
+	defer unsubscribeFast()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 5; i++ {
+			bus.Publish(SpeechStartedEvent{At: time.Now(), TurnID: i})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("订阅者缓冲已满时 Publish 阻塞")
+	}
+
+	if got := bus.Dropped(); got != 4 {
+		t.Errorf("Dropped = %d, want 4", got)
+	}
+	if len(slow) != 1 || (<-slow).(SpeechStartedEvent).TurnID != 1 {
+		t.Errorf("慢订阅者应只收到第一个事件")
+	}
+	if len(fast) != 5 {
+		t.Errorf("快订阅者收到 %d 个事件, want 5", len(fast))
+	}
+	for i := 1; i <= 5; i++ {
+		if got := (<-fast).(SpeechStartedEvent).TurnID; got != i {
+			t.Errorf("第 %d 个事件的 TurnID = %d", i, got)
+		}
+	}
+}
+
+func TestEventBusUnsubscribeAndClose(t *testing.T) {
+	bus := NewEventBus()
+	ch, unsubscribe := bus.Subscribe(1)
+	unsubscribe()
+	unsubscribe()
+	if _, ok := <-ch; ok {
+		t.Errorf("取消订阅后通道应关闭")
+	}
+	bus.Publish(SpeechStartedEvent{At: time.Now()})
+	if got := bus.Dropped(); got != 0 {
+		t.Errorf("取消订阅后仍向其投递事件: Dropped = %d", got)
+	}
+
+	open, _ := bus.Subscribe(1)
+	bus.Close()
+	bus.Close()
+	if _, ok := <-open; ok {
+		t.Errorf("Close 后订阅通道应关闭")
+	}
+	bus.Publish(SpeechStartedEvent{At: time.Now()})
+	late, _ := bus.Subscribe(1)
+	if _, ok := <-late; ok {
+		t.Errorf("Close 后订阅得到的通道应已关闭")
+	}
+}
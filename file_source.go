@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fileTrailingSilence 文件结束后补的静音，让 VAD 判定最后一句话结束
+const fileTrailingSilence = 1500 * time.Millisecond
+
+// loadAudioFile 读取音频文件并转换为 8kHz 16-bit PCM
+// 支持 16-bit PCM WAV（任意采样率，多声道取第一个声道）和 8kHz mulaw 裸数据（.ulaw，对话存储的音频格式）
+func loadAudioFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ulaw", ".mulaw":
+		return mulawToPCM(data), nil
+	default:
+		pcmData, rate, err := parsePCMWAV(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return resamplePCM(pcmData, rate, 8000), nil
+	}
+}
+
+// StartFileRecording 用音频文件代替麦克风：按实时节奏把文件送入与麦克风相同的 VAD 流程
+// 便于在没有麦克风的环境中调试和演示，文件送完后录音线程结束
+func (va *VoiceAgent) StartFileRecording(ctx context.Context, path string) error {
+	pcmData, err := loadAudioFile(path)
+	if err != nil {
+		return fmt.Errorf("读取音频文件失败: %w", err)
+	}
+	pcmData = append(pcmData, make([]byte, int(fileTrailingSilence.Seconds()*8000)*2)...)
+
+	va.isRecording.Store(true)
+	processFrame := va.newFrameProcessor(ctx)
+	// 按 VAD 配置的帧长分帧，VAD 的起止帧数以此为单位
+	frameSamples := va.vad.config.FrameSize
+	if frameSamples <= 0 {
+		frameSamples = DefaultVADConfig().FrameSize
+	}
+	frameBytes := frameSamples * 2
+	frameDuration := time.Duration(frameSamples) * time.Second / 8000
+	va.logger.Info("使用音频文件代替麦克风", "file", path, "duration_sec", float64(len(pcmData))/16000.0)
+
+	go func() {
+		defer func() { va.isRecording.Store(false) }()
+		ticker := time.NewTicker(frameDuration)
+		defer ticker.Stop()
+		for len(pcmData) > 0 {
+			select {
+			case <-ctx.Done():
+				va.logger.Info("录音线程已停止")
+				return
+			case <-ticker.C:
+			}
+			n := min(len(pcmData), frameBytes)
+			processFrame(pcmData[:n])
+			pcmData = pcmData[n:]
+		}
+		va.logger.Info("音频文件已送完", "file", path)
+	}()
+	return nil
+}
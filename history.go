@@ -0,0 +1,96 @@
+package main
+
+import (
+	"unicode"
+)
+
+// 对话消息角色
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	// RoleSummary 较早轮次的摘要，重放时作为用户文本发送
+	RoleSummary = "summary"
+)
+
+// DefaultHistoryTokenBudget 新会话重放对话历史的默认 token 预算
+const DefaultHistoryTokenBudget = 2000
+
+// sonicRole 对话消息角色对应的 Sonic 内容角色
+func sonicRole(role string) string {
+	if role == RoleAssistant {
+		return SonicRoleAssistant
+	}
+	return SonicRoleUser
+}
+
+// replayText 消息重放给模型的文本，摘要带上回复语言的前缀以便模型区分
+func replayText(msg ConversationMessage, language string) string {
+	if msg.Role == RoleSummary {
+		return summaryReplayPrefix(language) + msg.Text
+	}
+	return msg.Text
+}
+
+// estimateTokens 粗略估算文本的 token 数：中日韩字符按每字 1 个，其他字符按每 4 个 1 个
+func estimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			cjk++
+		case !unicode.IsSpace(r):
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+// isCJK 判断是否为中日韩文字
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// selectHistory 在 token 预算内选出要重放的消息（按时间顺序）
+// 只有文本的消息才能重放；开头的摘要优先保留，超出预算时先丢弃最早的轮次，
+// 并保证历史从用户发言（或摘要）开始
+func selectHistory(messages []ConversationMessage, budget int) []ConversationMessage {
+	if budget <= 0 {
+		return nil
+	}
+
+	var summary []ConversationMessage
+	if len(messages) > 0 && messages[0].Role == RoleSummary {
+		if tokens := estimateTokens(messages[0].Text); tokens <= budget {
+			summary = messages[:1]
+			budget -= tokens
+		}
+		messages = messages[1:]
+	}
+
+	start := len(messages)
+	used := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Text == "" {
+			continue
+		}
+		tokens := estimateTokens(messages[i].Text)
+		if used+tokens > budget {
+			break
+		}
+		used += tokens
+		start = i
+	}
+
+	selected := append(make([]ConversationMessage, 0, len(summary)+len(messages)-start), summary...)
+	for _, msg := range messages[start:] {
+		if msg.Text == "" {
+			continue
+		}
+		if len(selected) == 0 && msg.Role != RoleUser {
+			continue
+		}
+		selected = append(selected, msg)
+	}
+	return selected
+}
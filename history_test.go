@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"你好", 2},
+		{"hello world", 3},
+		{"こんにちは", 5},
+		{"退货 policy", 4},
+	}
+	for _, tt := range tests {
+		if got := estimateTokens(tt.text); got != tt.want {
+			t.Errorf("estimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSelectHistory(t *testing.T) {
+	user := func(text string) ConversationMessage { return ConversationMessage{Role: RoleUser, Text: text} }
+	assistant := func(text string) ConversationMessage { return ConversationMessage{Role: RoleAssistant, Text: text} }
+	summary := func(text string) ConversationMessage { return ConversationMessage{Role: RoleSummary, Text: text} }
+
+	// 每条消息 2 个 token
+	turns := []ConversationMessage{user("一二"), assistant("三四"), user("五六"), assistant("七八")}
+
+	tests := []struct {
+		name     string
+		messages []ConversationMessage
+		budget   int
+		want     []string
+	}{
+		{"空历史", nil, 100, nil},
+		{"预算为零", turns, 0, nil},
+		{"预算足够时全部保留", turns, 100, []string{"一二", "三四", "五六", "七八"}},
+		{"超出预算时先丢弃最早的轮次", turns, 4, []string{"五六", "七八"}},
+		{"不从 AI 回复开始", turns, 6, []string{"五六", "七八"}},
+		{"预算只够 AI 回复时不重放", turns, 2, nil},
+		{"跳过没有文本的消息", []ConversationMessage{user("一二"), {Role: RoleAssistant}, user("五六")}, 100, []string{"一二", "五六"}},
+		{"始终保留摘要", append([]ConversationMessage{summary("摘要")}, turns...), 6, []string{"摘要", "五六", "七八"}},
+		{"预算只够摘要", append([]ConversationMessage{summary("摘要")}, turns...), 2, []string{"摘要"}},
+		// 摘要以用户身份重放，后面可以直接跟 AI 回复
+		{"摘要后接 AI 回复", append([]ConversationMessage{summary("摘要")}, turns...), 4, []string{"摘要", "七八"}},
+		{"摘要超出预算时丢弃摘要", append([]ConversationMessage{summary("很长很长的摘要")}, turns...), 4, []string{"五六", "七八"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := selectHistory(tt.messages, tt.budget)
+			var texts []string
+			for _, msg := range got {
+				texts = append(texts, msg.Text)
+			}
+			if len(texts) != len(tt.want) {
+				t.Fatalf("selectHistory = %q, want %q", texts, tt.want)
+			}
+			for i := range texts {
+				if texts[i] != tt.want[i] {
+					t.Fatalf("selectHistory = %q, want %q", texts, tt.want)
+				}
+			}
+			if len(got) > 0 && got[0].Role == RoleAssistant {
+				t.Errorf("重放的历史从 AI 回复开始: %q", texts)
+			}
+		})
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// 知识库的默认参数
+const (
+	// maxChunkRunes 每个段落块的最大字数，检索结果会作为 toolResult 发给模型，块太长会拖慢回复
+	maxChunkRunes = 600
+	// defaultRetrieveTopK 每次检索返回的段落数
+	defaultRetrieveTopK = 3
+	// maxRetrieveTopK 模型可以请求的最大段落数
+	maxRetrieveTopK = 8
+)
+
+// knowledgeExtensions 知识库索引的文件类型
+var knowledgeExtensions = map[string]bool{
+	".md":       true,
+	".markdown": true,
+	".txt":      true,
+}
+
+// Passage 检索到的一段文本
+type Passage struct {
+	// Source 来源文件（相对于知识库目录）或外部文档的位置
+	Source string  `json:"source"`
+	Title  string  `json:"title,omitempty"`
+	Text   string  `json:"text"`
+	Score  float64 `json:"score"`
+}
+
+// Retriever 知识库检索，返回与 query 最相关的 topK 段文本
+type Retriever interface {
+	Retrieve(ctx context.Context, query string, topK int) ([]Passage, error)
+}
+
+// KnowledgeBase 本地目录的知识库：Markdown / 文本文件按标题和段落切块
+// 配置了向量模型时按向量相似度检索，向量不可用时退回 BM25，完全离线也能运行
+type KnowledgeBase struct {
+	dir    string
+	chunks []Passage
+	bm25   *BM25Index
+
+	// embedder 为空时只用 BM25，vectors 与 chunks 一一对应
+	embedder Embedder
+	vectors  [][]float32
+
+	logger *slog.Logger
+}
+
+// LoadKnowledgeBase 读取 dir 下的 .md / .markdown / .txt 文件（含子目录，跳过隐藏目录）并建立索引
+// embedder 不为空时为每个块计算向量，失败时记录警告并只用 BM25
+func LoadKnowledgeBase(ctx context.Context, dir string, embedder Embedder, logger *slog.Logger) (*KnowledgeBase, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	var chunks []Passage
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !knowledgeExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		source, err := filepath.Rel(dir, path)
+		if err != nil {
+			source = path
+		}
+		chunks = append(chunks, chunkDocument(filepath.ToSlash(source), string(data))...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取知识库目录失败: %w", err)
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("知识库目录 %s 中没有 Markdown 或文本文件", dir)
+	}
+
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		texts[i] = c.Title + "\n" + c.Text
+	}
+	kb := &KnowledgeBase{
+		dir:    dir,
+		chunks: chunks,
+		bm25:   NewBM25Index(texts),
+		logger: logger,
+	}
+
+	if embedder != nil {
+		vectors := make([][]float32, len(texts))
+		for i, text := range texts {
+			if vectors[i], err = embedder.Embed(ctx, text); err != nil {
+				logger.Warn("计算知识库向量失败，只使用 BM25 检索", "error", err)
+				vectors = nil
+				break
+			}
+		}
+		if vectors != nil {
+			kb.embedder = embedder
+			kb.vectors = vectors
+		}
+	}
+	logger.Info("知识库已加载", "dir", dir, "chunks", len(chunks), "vector", kb.vectors != nil)
+	return kb, nil
+}
+
+// Len 知识库中的块数
+func (kb *KnowledgeBase) Len() int {
+	return len(kb.chunks)
+}
+
+// Retrieve 返回与 query 最相关的 topK 段文本，向量检索失败时退回 BM25
+func (kb *KnowledgeBase) Retrieve(ctx context.Context, query string, topK int) ([]Passage, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("检索内容为空")
+	}
+	if topK <= 0 {
+		topK = defaultRetrieveTopK
+	}
+	if kb.embedder != nil {
+		passages, err := kb.retrieveVector(ctx, query, topK)
+		if err == nil {
+			return passages, nil
+		}
+		kb.logger.Warn("向量检索失败，退回 BM25", "error", err)
+	}
+
+	hits := kb.bm25.Search(query, topK)
+	passages := make([]Passage, 0, len(hits))
+	for _, hit := range hits {
+		p := kb.chunks[hit.doc]
+		p.Score = hit.score
+		passages = append(passages, p)
+	}
+	return passages, nil
+}
+
+// retrieveVector 按余弦相似度检索
+func (kb *KnowledgeBase) retrieveVector(ctx context.Context, query string, topK int) ([]Passage, error) {
+	queryVector, err := kb.embedder.Embed(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	passages := make([]Passage, len(kb.chunks))
+	for i, c := range kb.chunks {
+		c.Score = cosineSimilarity(queryVector, kb.vectors[i])
+		passages[i] = c
+	}
+	sortPassages(passages)
+	if len(passages) > topK {
+		passages = passages[:topK]
+	}
+	return passages, nil
+}
+
+// sortPassages 按得分从高到低排序，得分相同时保持原有顺序
+func sortPassages(passages []Passage) {
+	sort.SliceStable(passages, func(i, j int) bool {
+		return passages[i].Score > passages[j].Score
+	})
+}
+
+// chunkDocument 把文档按 Markdown 标题分节，节内按段落合并成不超过 maxChunkRunes 字的块
+// 每个块的标题为所在节的标题，没有标题时为文件名
+func chunkDocument(source, text string) []Passage {
+	title := strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	var chunks []Passage
+	var current strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			chunks = append(chunks, Passage{Source: source, Title: title, Text: s})
+		}
+		current.Reset()
+	}
+	addParagraph := func(paragraph string) {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			return
+		}
+		for _, piece := range splitLongText(paragraph, maxChunkRunes) {
+			if current.Len() > 0 && utf8.RuneCountInString(current.String())+utf8.RuneCountInString(piece)+1 > maxChunkRunes {
+				flush()
+			}
+			if current.Len() > 0 {
+				current.WriteString("\n")
+			}
+			current.WriteString(piece)
+		}
+	}
+
+	var paragraph strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if heading, ok := markdownHeading(trimmed); ok {
+			addParagraph(paragraph.String())
+			paragraph.Reset()
+			flush()
+			title = heading
+			continue
+		}
+		if trimmed == "" {
+			addParagraph(paragraph.String())
+			paragraph.Reset()
+			continue
+		}
+		if paragraph.Len() > 0 {
+			paragraph.WriteString(" ")
+		}
+		paragraph.WriteString(trimmed)
+	}
+	addParagraph(paragraph.String())
+	flush()
+	return chunks
+}
+
+// markdownHeading 识别 "# 标题" 形式的 Markdown 标题
+func markdownHeading(line string) (string, bool) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || level >= len(line) || line[level] != ' ' {
+		return "", false
+	}
+	return strings.TrimSpace(line[level:]), true
+}
+
+// splitLongText 超过 limit 字的段落按句切开，单句仍然超长时按字数硬切
+func splitLongText(text string, limit int) []string {
+	if utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+	sentences, rest := splitSentences(text)
+	if rest = strings.TrimSpace(rest); rest != "" {
+		sentences = append(sentences, rest)
+	}
+	var pieces []string
+	var current []rune
+	for _, sentence := range sentences {
+		runes := []rune(sentence)
+		if len(current) > 0 && len(current)+len(runes) > limit {
+			pieces = append(pieces, string(current))
+			current = nil
+		}
+		for len(runes) > limit {
+			pieces = append(pieces, string(runes[:limit]))
+			runes = runes[limit:]
+		}
+		current = append(current, runes...)
+	}
+	if len(current) > 0 {
+		pieces = append(pieces, string(current))
+	}
+	return pieces
+}
+
+// KnowledgeBaseToolName 知识库检索工具的名称
+const KnowledgeBaseToolName = "search_knowledge_base"
+
+// knowledgeBaseToolSchema 工具输入的 JSON Schema
+const knowledgeBaseToolSchema = `{
+  "type": "object",
+  "properties": {
+    "query": {"type": "string", "description": "要检索的问题或关键词"},
+    "topK": {"type": "integer", "description": "返回的段落数，默认 3"}
+  },
+  "required": ["query"]
+}`
+
+// KnowledgeBaseTool 把 Retriever 作为工具提供给模型，结果为最相关的几段文本
+type KnowledgeBaseTool struct {
+	retriever   Retriever
+	name        string
+	description string
+}
+
+// NewKnowledgeBaseTool 创建知识库检索工具，name 和 description 为空时使用默认值
+// 同时提供多个知识库时用不同的名称区分
+func NewKnowledgeBaseTool(name, description string, retriever Retriever) *KnowledgeBaseTool {
+	if name == "" {
+		name = KnowledgeBaseToolName
+	}
+	if description == "" {
+		description = "检索公司文档知识库。回答产品、政策、流程等需要依据文档的问题前先调用，" +
+			"并根据返回的段落回答，段落中没有答案时如实告诉用户。"
+	}
+	return &KnowledgeBaseTool{retriever: retriever, name: name, description: description}
+}
+
+// Spec 工具定义
+func (t *KnowledgeBaseTool) Spec() ToolSpec {
+	return ToolSpec{
+		Name:        t.name,
+		Description: t.description,
+		InputSchema: ToolInputSchema{JSON: knowledgeBaseToolSchema},
+	}
+}
+
+// knowledgeBaseInput 工具输入
+type knowledgeBaseInput struct {
+	Query string `json:"query"`
+	TopK  int    `json:"topK"`
+}
+
+// knowledgeBaseResult 工具结果
+type knowledgeBaseResult struct {
+	Passages []Passage `json:"passages"`
+	Message  string    `json:"message,omitempty"`
+}
+
+// Invoke 检索并返回最相关的段落
+func (t *KnowledgeBaseTool) Invoke(ctx context.Context, input json.RawMessage) (interface{}, error) {
+	var in knowledgeBaseInput
+	if err := json.Unmarshal(input, &in); err != nil {
+		return nil, fmt.Errorf("解析工具参数失败: %w", err)
+	}
+	topK := min(in.TopK, maxRetrieveTopK)
+	if topK <= 0 {
+		topK = defaultRetrieveTopK
+	}
+	passages, err := t.retriever.Retrieve(ctx, in.Query, topK)
+	if err != nil {
+		return nil, err
+	}
+	result := knowledgeBaseResult{Passages: passages}
+	if len(passages) == 0 {
+		result.Passages = []Passage{}
+		result.Message = "知识库中没有找到相关内容"
+	}
+	return result, nil
+}
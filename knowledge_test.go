@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunkDocument(t *testing.T) {
+	doc := strings.Join([]string{
+		"开头没有标题的一段。",
+		"",
+		"# 退货政策",
+		"七天无理由退货。",
+		"需要保留发票。",
+		"",
+		"## 运费",
+		"退货运费由商家承担。",
+	}, "\n")
+	chunks := chunkDocument("docs/售后.md", doc)
+	want := []Passage{
+		{Source: "docs/售后.md", Title: "售后", Text: "开头没有标题的一段。"},
+		{Source: "docs/售后.md", Title: "退货政策", Text: "七天无理由退货。 需要保留发票。"},
+		{Source: "docs/售后.md", Title: "运费", Text: "退货运费由商家承担。"},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("切出 %d 块, want %d: %+v", len(chunks), len(want), chunks)
+	}
+	for i := range want {
+		if chunks[i] != want[i] {
+			t.Errorf("第 %d 块 = %+v, want %+v", i+1, chunks[i], want[i])
+		}
+	}
+
+	// 超长的节按 maxChunkRunes 切开，每块都不超过上限，内容不丢失
+	sentence := strings.Repeat("很", 99) + "。"
+	long := "# 长文\n" + strings.Repeat(sentence, 20) + "\n\n" + strings.Repeat("长", maxChunkRunes*2+10)
+	chunks = chunkDocument("long.txt", long)
+	if len(chunks) < 5 {
+		t.Fatalf("超长文本只切出 %d 块", len(chunks))
+	}
+	total := 0
+	for i, c := range chunks {
+		n := utf8.RuneCountInString(c.Text)
+		if n > maxChunkRunes {
+			t.Errorf("第 %d 块有 %d 字，超过 %d", i+1, n, maxChunkRunes)
+		}
+		if c.Title != "长文" {
+			t.Errorf("第 %d 块的标题 = %q", i+1, c.Title)
+		}
+		total += utf8.RuneCountInString(strings.ReplaceAll(c.Text, "\n", ""))
+	}
+	if want := 20*100 + maxChunkRunes*2 + 10; total != want {
+		t.Errorf("切块后共 %d 字, want %d", total, want)
+	}
+}
+
+// failingEmbedder 总是失败，模拟没有网络或没有模型权限
+type failingEmbedder struct {
+	calls int
+}
+
+func (e *failingEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	e.calls++
+	return nil, errors.New("no network")
+}
+
+// flakyEmbedder 建索引时可用，检索时失败
+type flakyEmbedder struct {
+	fail bool
+}
+
+func (e *flakyEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	if e.fail {
+		return nil, errors.New("throttled")
+	}
+	return []float32{float32(len(text)), 1}, nil
+}
+
+// writeKnowledgeDir 创建测试用的知识库目录
+func writeKnowledgeDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"退货.md":             "# 退货政策\n会员可以享受七天无理由退货。",
+		"sub/营业时间.txt":      "营业时间为每天上午九点到晚上九点。",
+		"图片.png":            "不是文本",
+		".hidden/secret.md": "# 退货\n隐藏目录中的退货说明",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadKnowledgeBaseFallsBackToBM25(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.DiscardHandler)
+	dir := writeKnowledgeDir(t)
+
+	// 建索引时向量模型不可用：只用 BM25，检索时不再调用向量模型
+	embedder := &failingEmbedder{}
+	kb, err := LoadKnowledgeBase(ctx, dir, embedder, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kb.Len() != 2 {
+		t.Errorf("知识库有 %d 块, want 2（跳过隐藏目录和非文本文件）", kb.Len())
+	}
+	calls := embedder.calls
+	passages, err := kb.Retrieve(ctx, "怎么退货", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passages) != 1 || passages[0].Source != "退货.md" || passages[0].Title != "退货政策" || passages[0].Score <= 0 {
+		t.Errorf("BM25 检索结果 = %+v", passages)
+	}
+	if embedder.calls != calls {
+		t.Errorf("向量不可用后仍调用了向量模型")
+	}
+
+	// 检索时向量模型失败：退回 BM25
+	flaky := &flakyEmbedder{}
+	kb, err = LoadKnowledgeBase(ctx, dir, flaky, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flaky.fail = true
+	passages, err = kb.Retrieve(ctx, "营业时间", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passages) != 1 || passages[0].Source != "sub/营业时间.txt" {
+		t.Errorf("退回 BM25 后的结果 = %+v", passages)
+	}
+
+	if _, err := kb.Retrieve(ctx, "  ", 3); err == nil {
+		t.Errorf("空的检索内容应报错")
+	}
+	if _, err := LoadKnowledgeBase(ctx, t.TempDir(), nil, logger); err == nil {
+		t.Errorf("空目录应报错")
+	}
+}
+
+// recordingRetriever 记录请求的 topK，返回固定的段落
+type recordingRetriever struct {
+	passages []Passage
+	topK     []int
+}
+
+func (r *recordingRetriever) Retrieve(ctx context.Context, query string, topK int) ([]Passage, error) {
+	r.topK = append(r.topK, topK)
+	if len(r.passages) > topK {
+		return r.passages[:topK], nil
+	}
+	return r.passages, nil
+}
+
+func TestKnowledgeBaseToolInvoke(t *testing.T) {
+	ctx := context.Background()
+	retriever := &recordingRetriever{}
+	tool := NewKnowledgeBaseTool("", "", retriever)
+	if spec := tool.Spec(); spec.Name != KnowledgeBaseToolName || spec.Description == "" {
+		t.Errorf("默认的工具定义 = %+v", spec)
+	}
+
+	// topK 缺省时使用默认值，超过上限时截断
+	for _, input := range []string{`{"query":"退货"}`, `{"query":"退货","topK":0}`, `{"query":"退货","topK":100}`, `{"query":"退货","topK":5}`} {
+		if _, err := tool.Invoke(ctx, json.RawMessage(input)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []int{defaultRetrieveTopK, defaultRetrieveTopK, maxRetrieveTopK, 5}; !equalInts(retriever.topK, want) {
+		t.Errorf("请求的 topK = %v, want %v", retriever.topK, want)
+	}
+
+	// 没有结果时返回空数组和提示，而不是 null
+	result, err := tool.Invoke(ctx, json.RawMessage(`{"query":"退货"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(result)
+	if !strings.Contains(string(data), `"passages":[]`) || !strings.Contains(string(data), "没有找到") {
+		t.Errorf("空结果 = %s", data)
+	}
+
+	retriever.passages = []Passage{{Source: "退货.md", Text: "七天无理由退货", Score: 1.5}}
+	result, err = tool.Invoke(ctx, json.RawMessage(`{"query":"退货"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := result.(knowledgeBaseResult); len(r.Passages) != 1 || r.Message != "" {
+		t.Errorf("检索结果 = %+v", r)
+	}
+
+	if _, err := tool.Invoke(ctx, json.RawMessage(`not json`)); err == nil {
+		t.Errorf("无效的参数应报错")
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
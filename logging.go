@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// 日志属性键
+const (
+	logKeySession    = "session_id"
+	logKeyTurn       = "turn_id"
+	logKeyPrompt     = "prompt_name"
+	logKeyContent    = "content_name"
+	logKeyRole       = "role"
+	logKeyTranscript = "transcript"
+)
+
+// LogConfig 日志配置
+type LogConfig struct {
+	// Level 最低日志级别
+	Level slog.Level
+	// Format 输出格式: "text" 或 "json"
+	Format string
+	// RedactTranscripts 为 true 时日志中不输出识别/回复文本，只保留长度
+	RedactTranscripts bool
+	// Output 日志输出目标，默认 stderr
+	Output io.Writer
+}
+
+// DefaultLogConfig 返回默认的日志配置
+func DefaultLogConfig() LogConfig {
+	return LogConfig{
+		Level:  slog.LevelInfo,
+		Format: "text",
+		Output: os.Stderr,
+	}
+}
+
+// ParseLogLevel 解析日志级别字符串（debug/info/warn/error）
+func ParseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return slog.LevelInfo, fmt.Errorf("无效的日志级别 %q", s)
+	}
+	return level, nil
+}
+
+// NewLogger 根据配置创建 slog 日志器
+func NewLogger(cfg LogConfig) (*slog.Logger, error) {
+	output := cfg.Output
+	if output == nil {
+		output = os.Stderr
+	}
+
+	opts := &slog.HandlerOptions{
+		Level: cfg.Level,
+	}
+	if cfg.RedactTranscripts {
+		opts.ReplaceAttr = redactTranscriptAttr
+	}
+
+	var handler slog.Handler
+	switch cfg.Format {
+	case "", "text":
+		handler = slog.NewTextHandler(output, opts)
+	case "json":
+		handler = slog.NewJSONHandler(output, opts)
+	default:
+		return nil, fmt.Errorf("无效的日志格式 %q（可选 text/json）", cfg.Format)
+	}
+
+	return slog.New(handler), nil
+}
+
+// redactTranscriptAttr 将转写文本替换为长度占位符
+func redactTranscriptAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Key != logKeyTranscript {
+		return a
+	}
+	n := len([]rune(a.Value.String()))
+	return slog.String(logKeyTranscript, fmt.Sprintf("[已隐藏 %d 字]", n))
+}
+
+// transcriptAttr 构造转写文本属性，由 handler 决定是否隐藏
+func transcriptAttr(text string) slog.Attr {
+	return slog.String(logKeyTranscript, text)
+}
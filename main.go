@@ -5,18 +5,21 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
 	"github.com/gen2brain/malgo"
 )
@@ -110,6 +113,21 @@ func mulawToLinear(mulaw byte) int16 {
 	return mulawDecompressTable[mulaw]
 }
 
+// pcm24kToMulaw8k 将 Nova Sonic 输出的 24kHz 16-bit PCM 降采样为 8kHz mulaw
+// 每 3 个样本取平均，兼作简单低通滤波
+func pcm24kToMulaw8k(pcmData []byte) []byte {
+	sampleCount := len(pcmData) / 2
+	mulawData := make([]byte, 0, sampleCount/3)
+	for i := 0; i+2 < sampleCount; i += 3 {
+		var sum int32
+		for j := 0; j < 3; j++ {
+			sum += int32(int16(binary.LittleEndian.Uint16(pcmData[(i+j)*2:])))
+		}
+		mulawData = append(mulawData, linearToMulaw(int16(sum/3)))
+	}
+	return mulawData
+}
+
 // WAV 文件头结构
 type WAVHeader struct {
 	ChunkID       [4]byte // "RIFF"
@@ -183,24 +201,87 @@ func writeMulawWAVFile(filename string, mulawData []byte) error {
 	return nil
 }
 
+// writePCMWAVFile 写入 16-bit 单声道 PCM WAV 文件
+func writePCMWAVFile(filename string, pcmData []byte, sampleRate uint32) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header := WAVHeader{
+		ChunkID:       [4]byte{'R', 'I', 'F', 'F'},
+		ChunkSize:     uint32(len(pcmData)) + 36,
+		Format:        [4]byte{'W', 'A', 'V', 'E'},
+		Subchunk1ID:   [4]byte{'f', 'm', 't', ' '},
+		Subchunk1Size: 16,
+		AudioFormat:   1, // 1 = PCM
+		NumChannels:   1,
+		SampleRate:    sampleRate,
+		ByteRate:      sampleRate * 2,
+		BlockAlign:    2,
+		BitsPerSample: 16,
+		Subchunk2ID:   [4]byte{'d', 'a', 't', 'a'},
+		Subchunk2Size: uint32(len(pcmData)),
+	}
+	if err := binary.Write(file, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	_, err = file.Write(pcmData)
+	return err
+}
+
 // AudioChunk 音频数据块
 type AudioChunk struct {
 	Data      []byte
 	Timestamp time.Time
+	// TraceCtx 携带所属轮次的追踪上下文，随通道在线程间传递
+	TraceCtx context.Context
+	// ContentID AI 音频所属的 Sonic 输出内容块
+	ContentID string
 }
 
-// ConversationMessage 对话消息
+// ConversationMessage 对话消息，一条消息是一轮完整的发言
 type ConversationMessage struct {
-	Role    string // "user" 或 "assistant"
-	Content []byte // 音频数据
+	Role    string // RoleUser 或 RoleAssistant
+	Content []byte // 音频数据（8kHz mulaw）
 	Text    string // 文本内容（可选）
+	// StartTime/EndTime 这一轮发言的起止时间
+	StartTime time.Time
+	EndTime   time.Time
+	// Interrupted AI 回复被用户打断或因连接中断而未说完
+	Interrupted bool
+}
+
+// UsageStats 会话累计 token 用量
+type UsageStats struct {
+	InputSpeechTokens  int
+	InputTextTokens    int
+	OutputSpeechTokens int
+	OutputTextTokens   int
+	TotalTokens        int
 }
 
 // ConversationContext 对话上下文
 type ConversationContext struct {
 	SessionID string
+	// Messages 完整的对话记录，摘要不会改写它
 	Messages  []ConversationMessage
 	StartTime time.Time
+	// Summary 较早轮次的滚动摘要（RoleSummary），为空表示还没有摘要
+	// Summarized 为摘要覆盖的 Messages 前缀长度
+	Summary    *ConversationMessage
+	Summarized int
+}
+
+// replayView 重放给模型的压缩视图：摘要加上摘要之后的轮次
+func (c *ConversationContext) replayView() []ConversationMessage {
+	if c.Summary == nil {
+		return append([]ConversationMessage(nil), c.Messages...)
+	}
+	view := make([]ConversationMessage, 0, 1+len(c.Messages)-c.Summarized)
+	view = append(view, *c.Summary)
+	return append(view, c.Messages[c.Summarized:]...)
 }
 
 // VoiceAgent 语音对话代理（全双工版本）
@@ -211,32 +292,224 @@ type VoiceAgent struct {
 	region        string
 	awsConfig     aws.Config
 
-	// VAD 检测器
-	vad *VADDetector
+	// VAD 检测器，muted 为 true 时丢弃麦克风数据，calibration 为进行中的噪音采样
+	vad         *VADDetector
+	muted       atomic.Bool
+	calibration calibration
 
-	// 通道
-	audioInputChan  chan AudioChunk // 录音 -> 发送
-	audioOutputChan chan AudioChunk // 接收 -> 播放
-	interruptChan   chan struct{}   // 打断信号
+	// 对话轮次状态机
+	turn *TurnStateMachine
+
+	// 事件总线
+	events *EventBus
+
+	// 结构化日志
+	logger *slog.Logger
+
+	// Prometheus 指标
+	metrics *Metrics
+
+	// 可供模型调用的工具
+	tools *ToolRegistry
+
+	// token 用量
+	usageMu sync.Mutex
+	usage   UsageStats
 
-	// 对话上下文
-	context *ConversationContext
+	// 当前 AI 回复的文本和打断位置
+	reply replyTracker
+
+	// 正在拼装的对话轮次，完成后写入对话上下文
+	transcript transcriptBuilder
+
+	// 会话续期配置，新会话重放对话历史的 token 预算
+	renewal            SessionRenewalConfig
+	historyTokenBudget int
+
+	// 连接中断后的重连策略
+	reconnect ReconnectConfig
+
+	// 通道
+	audioInputChan  chan AudioChunk      // 录音 -> 发送
+	textInputChan   chan TextInput       // 文本输入 -> 发送
+	audioOutputChan chan AudioChunk      // 接收 -> 播放
+	interruptChan   chan interruptSignal // 打断信号
+	cueChan         chan []byte          // 提示音 -> 播放
+	renewChan       chan struct{}        // 请求换用新的 Sonic 会话
+
+	// 对话上下文，contextMu 保护指针本身和其中的消息
+	contextMu sync.Mutex
+	context   *ConversationContext
+
+	// 对话持久化，为空时只保存在内存中
+	store SessionStore
+
+	// 级联模式的语音识别、对话模型和 TTS 引擎
+	stt SpeechToText
+	llm LanguageModel
+	tts TextToSpeech
+	// cancelReply 取消正在生成的级联回复，被打断或新的一轮开始时调用
+	// replyDone 在回复线程退出时关闭
+	replyMu     sync.Mutex
+	cancelReply context.CancelFunc
+	replyDone   chan struct{}
+
+	// 滚动摘要：summaryModel 为空时不摘要，summarizing 保证同一时间只有一个摘要任务
+	summaryModel TextModel
+	summary      SummaryConfig
+	summarizing  atomic.Bool
+
+	// 当前人设（音色、系统提示、推理参数、工具）及其系统提示模板，切换后在新会话中生效
+	// personas 为可切换的人设，vars 为创建会话时传入的模板变量
+	personaMu sync.Mutex
+	persona   Persona
+	prompt    *PromptTemplate
+	personas  []Persona
+	vars      SessionVars
 
 	// 双向流
 	httpClient *http.Client
+	endpoint   string
 	streamConn io.ReadWriteCloser
 
-	// 播放控制
-	playbackCtx    context.Context
-	cancelPlayback context.CancelFunc
+	// 播放控制，playbackBuffered 为播放缓冲中的 PCM 字节数，playingContent 为最近开始播放的内容块
+	playbackCtx      context.Context
+	cancelPlayback   context.CancelFunc
+	playbackBuffered atomic.Int64
+	playingContent   atomic.Value
 
-	// 状态标志
-	isPlaying   bool
-	isRecording bool
+	// 状态标志，录音线程和文件输入线程会写入
+	isRecording atomic.Bool
+}
+
+// playbackIdleTimeout 播放缓冲为空且持续这么久没有新音频，视为 AI 回复结束
+const playbackIdleTimeout = 500 * time.Millisecond
+
+// AgentOptions 创建语音代理的可选配置
+type AgentOptions struct {
+	// Logger 日志器，为空时使用 slog.Default()
+	Logger *slog.Logger
+	// Metrics 指标集合，为空时创建新的
+	Metrics *Metrics
+	// Tools 工具注册表，为空时不向模型提供工具
+	Tools *ToolRegistry
+	// Endpoint 双向流服务地址，为空时使用 Bedrock Runtime
+	Endpoint string
+	// Renewal 会话续期配置，零值字段使用默认配置
+	Renewal SessionRenewalConfig
+	// Reconnect 重连策略，为零值时使用默认策略
+	Reconnect ReconnectConfig
+	// HistoryTokenBudget 新会话重放对话历史的 token 预算，0 使用默认值，负数表示不重放
+	HistoryTokenBudget int
+	// Store 对话持久化，为空时不保存
+	Store SessionStore
+	// ResumeSessionID 从 Store 恢复的会话 ID，为空时开始新会话
+	ResumeSessionID string
+	// SummaryModel 摘要较早对话的文本模型，为空时按 SummaryModelID 创建
+	SummaryModel TextModel
+	// SummaryModelID 摘要使用的 Bedrock 模型，SummaryModel 和它都为空时不摘要
+	SummaryModelID string
+	// Summary 滚动摘要阈值，零值使用默认配置
+	Summary SummaryConfig
+	// STT 级联模式的语音识别引擎
+	STT SpeechToText
+	// LLM 级联模式的对话模型，为空时按 TextModelID 创建
+	LLM LanguageModel
+	// TextModelID 级联模式使用的 Bedrock 文本模型
+	TextModelID string
+	// TTS 级联模式朗读回复的引擎，为空时只输出文本
+	TTS TextToSpeech
+	// Personas 可切换的人设，为空时使用内置人设
+	Personas []Persona
+	// Persona 会话使用的人设名称，为空时使用 DefaultPersonaName
+	Persona string
+	// VoiceID 覆盖人设的 Sonic 输出音色，为空时使用人设的音色
+	VoiceID string
+	// PromptFile 覆盖人设的系统提示模板文件
+	PromptFile string
+	// Vars 系统提示模板的会话变量，如来电者、CRM 字段
+	Vars SessionVars
+	// KnowledgeBaseDir 本地知识库目录，不为空时注册 search_knowledge_base 工具
+	KnowledgeBaseDir string
+	// EmbeddingModelID 知识库向量检索使用的 Bedrock 向量模型，为空时只用 BM25
+	EmbeddingModelID string
+	// Bedrock Bedrock 知识库和 Agent 工具
+	Bedrock BedrockToolsConfig
+	// Retriever 知识库检索后端，为空时按 Bedrock.KnowledgeBaseID 创建
+	Retriever Retriever
+	// Answerer 知识库问答后端，为空时按 Bedrock.KnowledgeBaseID 创建（generate 模式）
+	Answerer AnswerGenerator
 }
 
 // NewVoiceAgent 创建新的语音对话代理
-func NewVoiceAgent(ctx context.Context) (*VoiceAgent, error) {
+func NewVoiceAgent(ctx context.Context, opts AgentOptions) (*VoiceAgent, error) {
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	metrics := opts.Metrics
+	if metrics == nil {
+		metrics = NewMetrics()
+	}
+	tools := opts.Tools
+	if tools == nil {
+		tools = NewToolRegistry()
+	}
+	renewal := opts.Renewal.normalize()
+	reconnect := opts.Reconnect
+	if reconnect.InitialBackoff <= 0 {
+		reconnect = DefaultReconnectConfig()
+	}
+	historyTokenBudget := opts.HistoryTokenBudget
+	if historyTokenBudget == 0 {
+		historyTokenBudget = DefaultHistoryTokenBudget
+	}
+	summary := opts.Summary
+	if summary == (SummaryConfig{}) {
+		summary = DefaultSummaryConfig()
+	}
+	if summary.Timeout <= 0 {
+		summary.Timeout = DefaultSummaryConfig().Timeout
+	}
+	personas := opts.Personas
+	if len(personas) == 0 {
+		personas = BuiltinPersonas()
+	}
+	personaName := opts.Persona
+	if personaName == "" {
+		personaName = DefaultPersonaName
+	}
+	persona, err := ResolvePersona(personas, personaName, opts.VoiceID, opts.PromptFile)
+	if err != nil {
+		return nil, err
+	}
+	prompt, err := persona.PromptTemplate()
+	if err != nil {
+		return nil, err
+	}
+
+	// 恢复之前的会话，或开始新会话
+	conversation := &ConversationContext{
+		SessionID: newSessionID(),
+		Messages:  make([]ConversationMessage, 0),
+		StartTime: time.Now(),
+	}
+	if opts.ResumeSessionID != "" {
+		if opts.Store == nil {
+			return nil, fmt.Errorf("恢复会话需要配置对话存储")
+		}
+		loaded, err := opts.Store.LoadSession(opts.ResumeSessionID)
+		if err != nil {
+			return nil, fmt.Errorf("恢复会话失败: %w", err)
+		}
+		conversation = loaded
+		logger.Info("已恢复会话", logKeySession, conversation.SessionID, "message_count", len(conversation.Messages))
+	} else if opts.Store != nil {
+		if err := opts.Store.CreateSession(conversation.SessionID, conversation.StartTime); err != nil {
+			return nil, fmt.Errorf("创建会话记录失败: %w", err)
+		}
+	}
+
 	// 加载 AWS 配置，强制使用 us-east-1
 	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion("us-east-1"))
 	if err != nil {
@@ -245,10 +518,39 @@ func NewVoiceAgent(ctx context.Context) (*VoiceAgent, error) {
 
 	// 创建 Bedrock Runtime 客户端
 	bedrockClient := bedrockruntime.NewFromConfig(cfg)
+	summaryModel := opts.SummaryModel
+	if summaryModel == nil && opts.SummaryModelID != "" {
+		summaryModel = NewBedrockTextModel(bedrockClient, opts.SummaryModelID)
+	}
+	if opts.KnowledgeBaseDir != "" {
+		var embedder Embedder
+		if opts.EmbeddingModelID != "" {
+			embedder = NewBedrockEmbedder(bedrockClient, opts.EmbeddingModelID)
+		}
+		kb, err := LoadKnowledgeBase(ctx, opts.KnowledgeBaseDir, embedder, logger)
+		if err != nil {
+			return nil, err
+		}
+		tools.Register(NewKnowledgeBaseTool("", "", kb))
+	}
+	err = registerBedrockTools(tools, bedrockagentruntime.NewFromConfig(cfg), opts.Bedrock,
+		conversation.SessionID, opts.Retriever, opts.Answerer)
+	if err != nil {
+		return nil, err
+	}
+	if err := tools.checkNames(persona.Tools); err != nil {
+		return nil, fmt.Errorf("人设 %s: %w", persona.Name, err)
+	}
+	var bedrockLLM *BedrockLanguageModel
+	llm := opts.LLM
+	if llm == nil && opts.TextModelID != "" {
+		bedrockLLM = NewBedrockLanguageModel(bedrockClient, opts.TextModelID)
+		llm = bedrockLLM
+	}
 
 	// 初始化音频上下文
 	audioCtx, err := malgo.InitContext(nil, malgo.ContextConfig{}, func(message string) {
-		log.Printf("Malgo: %s", message)
+		logger.Debug("malgo", "message", message)
 	})
 	if err != nil {
 		return nil, fmt.Errorf("初始化音频上下文失败: %w", err)
@@ -261,30 +563,66 @@ func NewVoiceAgent(ctx context.Context) (*VoiceAgent, error) {
 	// 创建播放控制上下文
 	playbackCtx, cancelPlayback := context.WithCancel(ctx)
 
-	// 生成会话 ID
-	sessionID := fmt.Sprintf("session_%d", time.Now().Unix())
-
-	return &VoiceAgent{
-		bedrockClient:   bedrockClient,
-		audioContext:    audioCtx,
-		modelID:         "amazon.nova-sonic-v1:0",
-		region:          "us-east-1",
-		awsConfig:       cfg,
-		vad:             vad,
-		audioInputChan:  make(chan AudioChunk, 10),
-		audioOutputChan: make(chan AudioChunk, 100),
-		interruptChan:   make(chan struct{}, 1),
-		httpClient:      &http.Client{},
-		context: &ConversationContext{
-			SessionID: sessionID,
-			Messages:  make([]ConversationMessage, 0),
-			StartTime: time.Now(),
-		},
-		playbackCtx:    playbackCtx,
-		cancelPlayback: cancelPlayback,
-		isPlaying:      false,
-		isRecording:    false,
-	}, nil
+	va := &VoiceAgent{
+		bedrockClient:      bedrockClient,
+		audioContext:       audioCtx,
+		modelID:            "amazon.nova-sonic-v1:0",
+		region:             "us-east-1",
+		awsConfig:          cfg,
+		vad:                vad,
+		turn:               NewTurnStateMachine(),
+		events:             NewEventBus(),
+		logger:             logger,
+		metrics:            metrics,
+		tools:              tools,
+		renewal:            renewal,
+		reconnect:          reconnect,
+		historyTokenBudget: historyTokenBudget,
+		audioInputChan:     make(chan AudioChunk, 10),
+		textInputChan:      make(chan TextInput, 4),
+		audioOutputChan:    make(chan AudioChunk, 100),
+		interruptChan:      make(chan interruptSignal, 1),
+		cueChan:            make(chan []byte, 4),
+		renewChan:          make(chan struct{}, 1),
+		httpClient:         &http.Client{},
+		endpoint:           opts.Endpoint,
+		context:            conversation,
+		store:              opts.Store,
+		summaryModel:       summaryModel,
+		summary:            summary,
+		stt:                opts.STT,
+		llm:                llm,
+		tts:                opts.TTS,
+		persona:            persona,
+		prompt:             prompt,
+		personas:           personas,
+		vars:               opts.Vars,
+		playbackCtx:        playbackCtx,
+		cancelPlayback:     cancelPlayback,
+	}
+
+	if bedrockLLM != nil {
+		bedrockLLM.OnMetadata = va.recordConverseUsage
+		bedrockLLM.Inference = va.Inference
+	}
+	va.logPersona(persona)
+
+	// 指标由状态转换和事件驱动，状态转换同时作为事件发布
+	va.turn.Subscribe(metrics.observeTransition)
+	va.turn.Subscribe(func(t TurnTransition) {
+		va.events.Publish(TurnStateChangedEvent{
+			At:      t.At,
+			TurnID:  t.TurnID,
+			From:    t.From,
+			To:      t.To,
+			Elapsed: t.Elapsed,
+			Reason:  t.Reason,
+		})
+	})
+	// 恢复的会话可能已经很长，先压缩再重放
+	va.maybeSummarize()
+
+	return va, nil
 }
 
 // Close 清理资源
@@ -294,7 +632,8 @@ func (va *VoiceAgent) Close() {
 		va.cancelPlayback()
 	}
 
-	// 关闭通道
+	// 关闭事件总线和通道
+	va.events.Close()
 	close(va.interruptChan)
 	close(va.audioInputChan)
 	close(va.audioOutputChan)
@@ -307,54 +646,244 @@ func (va *VoiceAgent) Close() {
 }
 
 // AddUserMessage 添加用户消息到对话上下文
-func (va *VoiceAgent) AddUserMessage(audioData []byte) {
-	va.context.Messages = append(va.context.Messages, ConversationMessage{
-		Role:    "user",
-		Content: audioData,
+func (va *VoiceAgent) AddUserMessage(audioData []byte, text string) {
+	now := time.Now()
+	count := va.appendMessage(ConversationMessage{
+		Role:      RoleUser,
+		Content:   audioData,
+		Text:      text,
+		StartTime: now.Add(-mulawDuration(audioData)),
+		EndTime:   now,
 	})
-	fmt.Printf("📝 添加用户消息到上下文 (当前消息数: %d)\n", len(va.context.Messages))
+	va.log().Debug("添加用户消息到上下文", "message_count", count)
 }
 
 // AddAssistantMessage 添加助手消息到对话上下文
 func (va *VoiceAgent) AddAssistantMessage(audioData []byte, text string) {
-	va.context.Messages = append(va.context.Messages, ConversationMessage{
-		Role:    "assistant",
-		Content: audioData,
-		Text:    text,
+	now := time.Now()
+	count := va.appendMessage(ConversationMessage{
+		Role:      RoleAssistant,
+		Content:   audioData,
+		Text:      text,
+		StartTime: now.Add(-mulawDuration(audioData)),
+		EndTime:   now,
 	})
-	fmt.Printf("📝 添加助手消息到上下文 (当前消息数: %d)\n", len(va.context.Messages))
+	va.log().Debug("添加助手消息到上下文", "message_count", count)
 }
 
-// GetConversationHistory 获取对话历史
+// appendMessage 追加消息并写入存储，返回消息总数
+func (va *VoiceAgent) appendMessage(msg ConversationMessage) int {
+	va.contextMu.Lock()
+	va.context.Messages = append(va.context.Messages, msg)
+	sessionID, count := va.context.SessionID, len(va.context.Messages)
+	va.contextMu.Unlock()
+
+	if va.store != nil {
+		if err := va.store.AppendTurn(sessionID, msg); err != nil {
+			va.log().Error("保存对话失败", "error", err)
+			va.publishError("store", err)
+		}
+	}
+	return count
+}
+
+// commitTurn 把拼装完成的一轮写入对话上下文，msg 为 nil 时忽略
+func (va *VoiceAgent) commitTurn(msg *ConversationMessage) {
+	if msg == nil {
+		return
+	}
+	count := va.appendMessage(*msg)
+	va.log().Debug("对话轮次已记录", logKeyRole, msg.Role, "interrupted", msg.Interrupted,
+		"audio_sec", mulawDuration(msg.Content).Seconds(), "message_count", count)
+	va.maybeSummarize()
+}
+
+// historyForReplay 新会话要重放的对话历史，较早的轮次已摘要时用摘要代替
+// 摘要的文本已加上回复语言的前缀，可以直接发送
+func (va *VoiceAgent) historyForReplay() []ConversationMessage {
+	language := va.Persona().Language
+	va.contextMu.Lock()
+	view := va.context.replayView()
+	va.contextMu.Unlock()
+	for i := range view {
+		view[i].Text = replayText(view[i], language)
+	}
+	return selectHistory(view, va.historyTokenBudget)
+}
+
+// ConversationSummary 较早轮次的摘要及其覆盖的轮数，还没有摘要时返回 nil
+func (va *VoiceAgent) ConversationSummary() (*ConversationMessage, int) {
+	va.contextMu.Lock()
+	defer va.contextMu.Unlock()
+	if va.context.Summary == nil {
+		return nil, 0
+	}
+	summary := *va.context.Summary
+	return &summary, va.context.Summarized
+}
+
+// sessionID 当前会话 ID
+func (va *VoiceAgent) sessionID() string {
+	va.contextMu.Lock()
+	defer va.contextMu.Unlock()
+	return va.context.SessionID
+}
+
+// log 返回带当前会话和轮次属性的日志器
+func (va *VoiceAgent) log() *slog.Logger {
+	return va.logger.With(logKeySession, va.sessionID(), logKeyTurn, va.turn.TurnID())
+}
+
+// transitionTurn 转换对话轮次状态，非法转换只记录日志
+func (va *VoiceAgent) transitionTurn(to TurnState, reason string) {
+	if err := va.turn.Transition(to, reason); err != nil {
+		va.log().Warn("对话状态转换被拒绝", "error", err)
+	}
+}
+
+// Subscribe 订阅代理事件，返回事件通道和取消订阅函数
+func (va *VoiceAgent) Subscribe(buffer int) (<-chan AgentEvent, func()) {
+	return va.events.Subscribe(buffer)
+}
+
+// publishError 记录错误指标并发布错误事件
+// 指标直接计数，事件总线在订阅者处理不过来时会丢弃事件
+func (va *VoiceAgent) publishError(source string, err error) {
+	va.metrics.observeBedrockError(source, err)
+	va.events.Publish(ErrorEvent{At: time.Now(), Source: source, Err: err})
+}
+
+// interruptPlayback 打断 AI 播放并清空播放缓冲
+// source: "vad" 本地检测到用户说话, "model" 模型侧报告被打断, "text" 用户输入了文本
+// contentID 为被打断的音频内容块，为空表示当前正在播放的内容
+// 本地 VAD 已经打断过时，模型侧的打断只清空缓冲，不重复计数
+// 指向旧内容块的迟到打断只丢弃该内容块的残余音频，不影响正在播放的新回复
+func (va *VoiceAgent) interruptPlayback(source, contentID string) {
+	playing, _ := va.playingContent.Load().(string)
+	stale := contentID != "" && contentID != playing
+	announce := !stale && va.turn.IsAssistantSpeaking()
+	if announce {
+		va.transitionTurn(TurnInterrupted, "打断 ("+source+")")
+	}
+	if !stale {
+		va.transcript.MarkInterrupted()
+		// 级联模式下还要停止生成和合成后面的句子
+		va.cancelCascadeReply()
+	}
+	select {
+	case va.interruptChan <- interruptSignal{Source: source, ContentID: contentID, Announce: announce}:
+		va.log().Info("打断 AI 播放", "source", source, logKeyContent, contentID)
+	default:
+	}
+}
+
+// playCue 播放提示音（8kHz mulaw），不影响对话状态；播放线程忙不过来时直接丢弃
+func (va *VoiceAgent) playCue(data []byte) {
+	select {
+	case va.cueChan <- data:
+	default:
+	}
+}
+
+// PlaybackBuffered 播放缓冲中尚未播放的音频时长
+func (va *VoiceAgent) PlaybackBuffered() time.Duration {
+	return time.Duration(va.playbackBuffered.Load()/2) * time.Second / 8000
+}
+
+// LastPlaybackCut 获取当前回复最近一次被打断时的播放位置，未被打断返回 nil
+func (va *VoiceAgent) LastPlaybackCut() *PlaybackCut {
+	return va.reply.LastCut()
+}
+
+// recordUsage 累计 usageEvent 中的 token 用量
+func (va *VoiceAgent) recordUsage(e UsageEvent) {
+	delta := e.Details.Delta
+	va.usageMu.Lock()
+	va.usage.InputSpeechTokens += delta.Input.SpeechTokens
+	va.usage.InputTextTokens += delta.Input.TextTokens
+	va.usage.OutputSpeechTokens += delta.Output.SpeechTokens
+	va.usage.OutputTextTokens += delta.Output.TextTokens
+	va.usage.TotalTokens = e.TotalTokens
+	va.usageMu.Unlock()
+
+	va.metrics.Tokens.WithLabelValues("input", "speech").Add(float64(delta.Input.SpeechTokens))
+	va.metrics.Tokens.WithLabelValues("input", "text").Add(float64(delta.Input.TextTokens))
+	va.metrics.Tokens.WithLabelValues("output", "speech").Add(float64(delta.Output.SpeechTokens))
+	va.metrics.Tokens.WithLabelValues("output", "text").Add(float64(delta.Output.TextTokens))
+	va.log().Debug("token 用量", "total_tokens", e.TotalTokens,
+		"input_tokens", e.TotalInputTokens, "output_tokens", e.TotalOutputTokens)
+}
+
+// GetUsage 获取会话累计 token 用量
+func (va *VoiceAgent) GetUsage() UsageStats {
+	va.usageMu.Lock()
+	defer va.usageMu.Unlock()
+	return va.usage
+}
+
+// GetTurnState 获取当前对话轮次状态
+func (va *VoiceAgent) GetTurnState() TurnState {
+	return va.turn.State()
+}
+
+// GetConversationHistory 获取对话历史（副本）
 func (va *VoiceAgent) GetConversationHistory() []ConversationMessage {
-	return va.context.Messages
+	va.contextMu.Lock()
+	defer va.contextMu.Unlock()
+	return append([]ConversationMessage(nil), va.context.Messages...)
 }
 
 // ClearConversationHistory 清除对话历史
 func (va *VoiceAgent) ClearConversationHistory() {
+	va.contextMu.Lock()
 	va.context.Messages = make([]ConversationMessage, 0)
-	fmt.Println("🗑️  对话历史已清除")
+	va.context.Summary = nil
+	va.context.Summarized = 0
+	va.contextMu.Unlock()
+	va.transcript.Reset()
+	va.log().Info("对话历史已清除")
 }
 
 // GetSessionInfo 获取会话信息
 func (va *VoiceAgent) GetSessionInfo() (sessionID string, messageCount int, duration time.Duration) {
+	va.contextMu.Lock()
+	defer va.contextMu.Unlock()
 	return va.context.SessionID, len(va.context.Messages), time.Since(va.context.StartTime)
 }
 
-// ResetSession 重置会话（保留配置，清除历史）
+// ResetSession 重置会话（保留配置，清除历史），并换用新的 Sonic 会话，让模型也忘掉之前的对话
 func (va *VoiceAgent) ResetSession() {
+	va.contextMu.Lock()
 	oldSessionID := va.context.SessionID
 	va.context = &ConversationContext{
-		SessionID: fmt.Sprintf("session_%d", time.Now().Unix()),
+		SessionID: newSessionID(),
 		Messages:  make([]ConversationMessage, 0),
 		StartTime: time.Now(),
 	}
-	fmt.Printf("🔄 会话已重置: %s -> %s\n", oldSessionID, va.context.SessionID)
+	newSessionID, startTime := va.context.SessionID, va.context.StartTime
+	va.contextMu.Unlock()
+	va.transcript.Reset()
+
+	if va.store != nil {
+		if err := va.store.CreateSession(newSessionID, startTime); err != nil {
+			va.logger.Error("创建会话记录失败", logKeySession, newSessionID, "error", err)
+			va.publishError("store", err)
+		}
+	}
+
+	va.turn.Reset("会话重置")
+	va.requestRenewal()
+	va.events.Publish(SessionResetEvent{
+		At:           time.Now(),
+		OldSessionID: oldSessionID,
+		NewSessionID: newSessionID,
+	})
+	va.logger.Info("会话已重置", "old_session_id", oldSessionID, logKeySession, newSessionID)
 }
 
 // StartContinuousRecording 启动连续录音线程（带 VAD 检测）
 func (va *VoiceAgent) StartContinuousRecording(ctx context.Context) error {
-	va.isRecording = true
+	va.isRecording.Store(true)
 
 	// 配置录音设备
 	deviceConfig := malgo.DefaultDeviceConfig(malgo.Capture)
@@ -363,35 +892,100 @@ func (va *VoiceAgent) StartContinuousRecording(ctx context.Context) error {
 	deviceConfig.SampleRate = 8000                // 8000 Hz
 	deviceConfig.Alsa.NoMMap = 1
 
+	// 数据回调函数
+	processFrame := va.newFrameProcessor(ctx)
+	onRecvFrames := func(pOutputSample, pInputSamples []byte, framecount uint32) {
+		processFrame(pInputSamples)
+	}
+
+	// 初始化设备
+	device, err := malgo.InitDevice(va.audioContext.Context, deviceConfig, malgo.DeviceCallbacks{
+		Data: onRecvFrames,
+	})
+	if err != nil {
+		return fmt.Errorf("初始化录音设备失败: %w", err)
+	}
+
+	// 启动录音
+	err = device.Start()
+	if err != nil {
+		device.Uninit()
+		return fmt.Errorf("启动录音失败: %w", err)
+	}
+
+	va.logger.Info("连续录音已启动（使用 VAD 自动检测）")
+
+	// 等待上下文取消
+	go func() {
+		<-ctx.Done()
+		device.Stop()
+		device.Uninit()
+		va.isRecording.Store(false)
+		va.logger.Info("录音线程已停止")
+	}()
+
+	return nil
+}
+
+// newFrameProcessor 创建录音帧（8kHz 16-bit PCM）的处理函数：VAD 检测，缓冲语音，说完后送入发送通道
+// 麦克风和音频文件共用，返回的函数只能在一个线程中调用
+func (va *VoiceAgent) newFrameProcessor(ctx context.Context) func(pInputSamples []byte) {
 	// 语音缓冲区
 	var currentSpeechBuffer []byte
 	var isSpeaking bool = false
+	var currentTrace *turnTrace
 
-	// 数据回调函数
-	onRecvFrames := func(pOutputSample, pInputSamples []byte, framecount uint32) {
+	return func(pInputSamples []byte) {
 		if len(pInputSamples) == 0 {
 			return
 		}
 
+		// 校准期间采集环境噪音，不做语音检测
+		if va.calibration.capture(pInputSamples) {
+			return
+		}
+
+		// 静音时丢弃麦克风数据，说到一半的语音不再发送
+		if va.muted.Load() {
+			if isSpeaking {
+				isSpeaking = false
+				currentSpeechBuffer = nil
+				currentTrace.End("muted")
+				currentTrace = nil
+				va.vad.Reset()
+				va.transitionTurn(TurnListening, "麦克风静音")
+			}
+			return
+		}
+
 		// 检测语音活动
 		vadState := va.vad.Detect(pInputSamples)
+		energy := va.vad.LastEnergy()
+		va.metrics.VADFrameEnergy.WithLabelValues(vadState.String()).Observe(energy)
+		va.events.Publish(AudioLevelEvent{
+			At:        time.Now(),
+			Energy:    energy,
+			Threshold: va.vad.GetEnergyThreshold(),
+			State:     vadState,
+		})
 
 		switch vadState {
 		case StateSpeech:
 			if !isSpeaking {
 				// 语音开始
-				fmt.Println("🎤 检测到语音，开始录音...")
 				isSpeaking = true
 				currentSpeechBuffer = make([]byte, 0)
 
 				// 如果正在播放，触发打断
-				if va.isPlaying {
-					select {
-					case va.interruptChan <- struct{}{}:
-						fmt.Println("⚠️  打断 AI 播放")
-					default:
-					}
+				if va.turn.IsAssistantSpeaking() {
+					va.interruptPlayback("vad", "")
 				}
+				va.transitionTurn(TurnUserSpeaking, "检测到语音")
+				currentTrace.End("superseded")
+				currentTrace = startTurnTrace(va.turn.TurnID(), va.sessionID())
+				va.log().Info("检测到语音，开始录音")
+				va.metrics.VADDecisions.WithLabelValues("speech_start").Inc()
+				va.events.Publish(SpeechStartedEvent{At: time.Now(), TurnID: va.turn.TurnID()})
 			}
 
 			// 将 PCM 数据转换为 mulaw 并添加到缓冲区
@@ -406,13 +1000,25 @@ func (va *VoiceAgent) StartContinuousRecording(ctx context.Context) error {
 		case StateSpeechEnd:
 			if isSpeaking && len(currentSpeechBuffer) > 0 {
 				// 语音结束，发送音频数据
-				fmt.Printf("✓ 语音结束，录制了 %.2f 秒\n", float64(len(currentSpeechBuffer))/8000.0)
+				va.log().Info("语音结束", "duration_sec", float64(len(currentSpeechBuffer))/8000.0)
+				currentTrace.EndCapture(len(currentSpeechBuffer))
+				va.transitionTurn(TurnWaitingModel, "语音结束")
+				duration := time.Duration(len(currentSpeechBuffer)) * time.Second / 8000
+				va.metrics.VADDecisions.WithLabelValues("speech_end").Inc()
+				va.metrics.UtteranceDuration.Observe(duration.Seconds())
+				va.events.Publish(SpeechEndedEvent{
+					At:       time.Now(),
+					TurnID:   va.turn.TurnID(),
+					Duration: duration,
+					Audio:    currentSpeechBuffer,
+				})
 
 				// 发送到输入通道
 				select {
 				case va.audioInputChan <- AudioChunk{
 					Data:      currentSpeechBuffer,
 					Timestamp: time.Now(),
+					TraceCtx:  currentTrace.Context(),
 				}:
 				case <-ctx.Done():
 					return
@@ -427,34 +1033,6 @@ func (va *VoiceAgent) StartContinuousRecording(ctx context.Context) error {
 			// 静音状态，什么都不做
 		}
 	}
-
-	// 初始化设备
-	device, err := malgo.InitDevice(va.audioContext.Context, deviceConfig, malgo.DeviceCallbacks{
-		Data: onRecvFrames,
-	})
-	if err != nil {
-		return fmt.Errorf("初始化录音设备失败: %w", err)
-	}
-
-	// 启动录音
-	err = device.Start()
-	if err != nil {
-		device.Uninit()
-		return fmt.Errorf("启动录音失败: %w", err)
-	}
-
-	fmt.Println("✓ 连续录音已启动（使用 VAD 自动检测）")
-
-	// 等待上下文取消
-	go func() {
-		<-ctx.Done()
-		device.Stop()
-		device.Uninit()
-		va.isRecording = false
-		fmt.Println("✓ 录音线程已停止")
-	}()
-
-	return nil
 }
 
 // RecordAudio 录制音频（保留旧方法用于兼容）
@@ -494,11 +1072,11 @@ func (va *VoiceAgent) RecordAudio(duration time.Duration) ([]byte, error) {
 		return nil, fmt.Errorf("启动录音失败: %w", err)
 	}
 
-	fmt.Printf("🎤 正在录音 (%v)...\n", duration)
+	va.logger.Info("正在录音", "duration", duration)
 	time.Sleep(duration)
 
 	device.Stop()
-	fmt.Printf("✓ 录音完成，共 %.2f 秒\n", float64(len(recordedData))/8000.0)
+	va.logger.Info("录音完成", "duration_sec", float64(len(recordedData))/8000.0)
 
 	return recordedData, nil
 }
@@ -513,8 +1091,10 @@ func (va *VoiceAgent) StartContinuousPlayback(ctx context.Context) error {
 	deviceConfig.Alsa.NoMMap = 1
 
 	// 播放缓冲队列
-	var playbackBuffer []byte
+	var queue playbackQueue
 	var bufferMutex sync.Mutex
+	// starved 回复播放中缓冲曾被耗尽，用于统计中途断流
+	var starved bool
 
 	// 播放回调函数
 	onSendFrames := func(pOutputSample, pInputSamples []byte, framecount uint32) {
@@ -523,24 +1103,14 @@ func (va *VoiceAgent) StartContinuousPlayback(ctx context.Context) error {
 
 		bytesNeeded := int(framecount) * 2 // 16-bit = 2 bytes per sample
 
-		if len(playbackBuffer) == 0 {
-			// 没有数据，输出静音
-			for i := range pOutputSample {
-				pOutputSample[i] = 0
-			}
-			return
+		if queue.Len() < bytesNeeded && va.turn.IsAssistantSpeaking() {
+			starved = true
 		}
 
-		bytesToCopy := bytesNeeded
-		if bytesToCopy > len(playbackBuffer) {
-			bytesToCopy = len(playbackBuffer)
-		}
-
-		copy(pOutputSample, playbackBuffer[:bytesToCopy])
-		playbackBuffer = playbackBuffer[bytesToCopy:]
-
-		// 填充剩余部分为静音
-		for i := bytesToCopy; i < len(pOutputSample); i++ {
+		// 没有数据的部分输出静音
+		copied := queue.Pop(pOutputSample, bytesNeeded)
+		va.playbackBuffered.Store(int64(queue.Len()))
+		for i := copied; i < len(pOutputSample); i++ {
 			pOutputSample[i] = 0
 		}
 	}
@@ -560,32 +1130,136 @@ func (va *VoiceAgent) StartContinuousPlayback(ctx context.Context) error {
 		return fmt.Errorf("启动播放失败: %w", err)
 	}
 
-	fmt.Println("✓ 连续播放已启动")
+	va.logger.Info("连续播放已启动")
 
 	// 播放控制协程
 	go func() {
 		defer device.Stop()
 		defer device.Uninit()
-		defer fmt.Println("✓ 播放线程已停止")
+		defer va.logger.Info("播放线程已停止")
+
+		// 定期检查播放是否已完成
+		idleTicker := time.NewTicker(100 * time.Millisecond)
+		defer idleTicker.Stop()
+		var lastChunkAt time.Time
+		var playbackTrace *turnTrace
+
+		// 按内容块统计已送入缓冲的样本数，被打断的内容块的残余音频会被丢弃
+		var currentContentID string
+		contentSamples := make(map[string]int)
+		droppedContents := make(map[string]bool)
 
 		for {
 			select {
 			case <-ctx.Done():
 				return
 
-			case <-va.interruptChan:
-				// 收到打断信号，清空播放缓冲
+			case sig := <-va.interruptChan:
+				// 只丢弃被打断内容块的音频；没有指定内容块时（本地打断）清空整个缓冲
+				contentID := sig.ContentID
+				if contentID == "" {
+					contentID = currentContentID
+				}
+				droppedContents[contentID] = true
+				bufferMutex.Lock()
+				remaining := queue.Pending(contentID) / 2
+				if sig.ContentID == "" {
+					queue.Clear()
+				} else {
+					queue.Drop(sig.ContentID)
+				}
+				va.playbackBuffered.Store(int64(queue.Len()))
+				bufferMutex.Unlock()
+
+				// 迟到的打断指向已经不在播放的旧内容块，不影响当前回复
+				if contentID != currentContentID {
+					va.log().Debug("忽略旧内容块的打断", "source", sig.Source, logKeyContent, contentID)
+					va.turn.TransitionFrom(TurnInterrupted, TurnWaitingModel, "打断后等待模型回复")
+					continue
+				}
+				if sig.Source != "model" {
+					// 通道中还没取出的音频都属于被打断的回复
+					drainAudio(va.audioOutputChan)
+				}
+				playbackTrace.End("interrupted")
+				playbackTrace = nil
+
+				// 记录用户实际听到的位置，对话记录只保留听到的部分
+				received := contentSamples[contentID]
+				played := max(received-remaining, 0)
+				cut := va.reply.Cut(sig.Source, contentID,
+					time.Duration(played)*time.Second/8000,
+					time.Duration(received)*time.Second/8000)
+				va.commitTurn(va.transcript.Cut(cut))
+				if sig.Announce {
+					va.metrics.BargeIns.WithLabelValues(sig.Source).Inc()
+					va.events.Publish(BargeInEvent{
+						At:        cut.At,
+						Source:    sig.Source,
+						ContentID: contentID,
+						Played:    cut.Played,
+						HeardText: cut.HeardText,
+					})
+				}
+				va.log().Info("播放已中断", "source", sig.Source, logKeyContent, contentID,
+					"played_sec", cut.Played.Seconds(), "received_sec", cut.Received.Seconds())
+
+				// 模型侧的打断说明模型听到了用户说话，接下来等待它的回复
+				// 本地打断时录音线程已经转到用户说话，这里不会重复转换
+				va.turn.TransitionFrom(TurnInterrupted, TurnWaitingModel, "打断后等待模型回复")
+
+			case cue := <-va.cueChan:
+				// 提示音直接追加到缓冲，不改变对话状态
+				pcmData := make([]byte, len(cue)*2)
+				for i, mulaw := range cue {
+					binary.LittleEndian.PutUint16(pcmData[i*2:], uint16(mulawToLinear(mulaw)))
+				}
 				bufferMutex.Lock()
-				playbackBuffer = nil
+				queue.Push("", pcmData)
+				va.playbackBuffered.Store(int64(queue.Len()))
 				bufferMutex.Unlock()
-				va.isPlaying = false
-				fmt.Println("⚠️  播放已中断")
+
+			case <-idleTicker.C:
+				if !va.turn.IsAssistantSpeaking() || time.Since(lastChunkAt) < playbackIdleTimeout {
+					continue
+				}
+				bufferMutex.Lock()
+				drained := queue.Len() == 0
+				bufferMutex.Unlock()
+				if drained {
+					va.transitionTurn(TurnListening, "播放完成")
+					va.commitTurn(va.transcript.Played())
+					playbackTrace.End("completed")
+					playbackTrace = nil
+					va.log().Info("AI 回复播放完成")
+				}
 
 			case chunk := <-va.audioOutputChan:
+				// 用户正在说话、刚打断或内容块已被打断时，丢弃残留的 AI 音频
+				if droppedContents[chunk.ContentID] || !va.turn.CanPlayAssistantAudio() {
+					continue
+				}
+				lastChunkAt = time.Now()
+				if chunk.ContentID != currentContentID {
+					currentContentID = chunk.ContentID
+					va.playingContent.Store(currentContentID)
+					// 只保留最近的内容块统计
+					if len(contentSamples) > 32 {
+						contentSamples = make(map[string]int)
+						droppedContents = make(map[string]bool)
+					}
+				}
+				contentSamples[chunk.ContentID] += len(chunk.Data)
+
 				// 收到音频数据
-				if !va.isPlaying {
-					va.isPlaying = true
-					fmt.Println("🔊 开始播放 AI 回复...")
+				if !va.turn.IsAssistantSpeaking() {
+					bufferMutex.Lock()
+					starved = false
+					bufferMutex.Unlock()
+					va.transitionTurn(TurnAssistantSpeaking, "收到 AI 音频")
+					playbackTrace = turnTraceFrom(chunk.TraceCtx)
+					playbackTrace.StartPlayback()
+					va.log().Info("开始播放 AI 回复")
 				}
 
 				// 将 mulaw 转换为 PCM
@@ -595,9 +1269,14 @@ func (va *VoiceAgent) StartContinuousPlayback(ctx context.Context) error {
 					binary.LittleEndian.PutUint16(pcmData[i*2:i*2+2], uint16(sample))
 				}
 
-				// 添加到播放缓冲
+				// 添加到播放缓冲；缓冲曾耗尽后又来了新音频，说明回复中途断流
 				bufferMutex.Lock()
-				playbackBuffer = append(playbackBuffer, pcmData...)
+				if starved {
+					starved = false
+					va.metrics.PlaybackUnderruns.Inc()
+				}
+				queue.Push(chunk.ContentID, pcmData)
+				va.playbackBuffered.Store(int64(queue.Len()))
 				bufferMutex.Unlock()
 			}
 		}
@@ -606,6 +1285,17 @@ func (va *VoiceAgent) StartContinuousPlayback(ctx context.Context) error {
 	return nil
 }
 
+// drainAudio 丢弃通道中已经排队的音频
+func drainAudio(ch <-chan AudioChunk) {
+	for {
+		select {
+		case <-ch:
+		default:
+			return
+		}
+	}
+}
+
 // PlayAudio 播放音频（保留旧方法用于兼容）
 func (va *VoiceAgent) PlayAudio(mulawData []byte) error {
 	// 将 mulaw 转换为 PCM
@@ -655,84 +1345,116 @@ func (va *VoiceAgent) PlayAudio(mulawData []byte) error {
 		return fmt.Errorf("启动播放失败: %w", err)
 	}
 
-	fmt.Println("🔊 正在播放回复...")
+	va.logger.Info("正在播放回复")
 	<-playbackFinished
 	device.Stop()
-	fmt.Println("✓ 播放完成")
+	va.logger.Info("播放完成")
 
 	return nil
 }
 
-// ReceiveFromNova 流式接收 Nova 响应（占位符，当前集成在发送线程中）
-// 注意：当 AWS SDK 真正支持 ConverseStream 时，这个方法将处理事件流
-func (va *VoiceAgent) ReceiveFromNova(ctx context.Context, eventStream chan *bedrockruntime.ConverseStreamOutput) error {
-	fmt.Println("📥 ConverseStream 接收线程已启动（当前集成在发送线程中）")
-
-	for {
-		select {
-		case <-ctx.Done():
-			fmt.Println("✓ 接收线程已停止")
-			return ctx.Err()
-
-		case event := <-eventStream:
-			if event == nil {
-				continue
-			}
-
-			// 处理不同类型的流式事件
-			// 这里是 ConverseStream API 的事件处理逻辑
-			// 当 AWS SDK 支持时，需要处理以下事件：
-			// - ContentBlockStart
-			// - ContentBlockDelta (音频数据块)
-			// - ContentBlockStop
-			// - MessageStart
-			// - MessageStop
-			// - Metadata
-
-			fmt.Println("📥 收到流式事件（占位符）")
-		}
-	}
-}
-
 // StreamAudioToNova 使用双向流发送音频到 Nova Sonic
 func (va *VoiceAgent) StreamAudioToNova(ctx context.Context, receiveChan chan<- *bedrockruntime.ConverseStreamOutput) error {
-	fmt.Println("📤 Nova Sonic 双向流已启动")
+	va.logger.Info("Nova Sonic 双向流已启动")
 
-	// 创建双向流
-	stream, err := va.NewNovaSonicStream(ctx)
+	// 创建并启动双向流，暂时性错误按退避策略重试
+	stream, err := va.openSonicStream(ctx)
 	if err != nil {
-		return fmt.Errorf("创建流失败: %w", err)
-	}
-	defer stream.Close()
-
-	// 启动流
-	if err := stream.Start(ctx); err != nil {
-		return fmt.Errorf("启动流失败: %w", err)
-	}
-
-	// 启动响应读取线程
-	go func() {
-		if err := stream.ReadResponses(ctx); err != nil && err != context.Canceled {
-			log.Printf("❌ 读取响应错误: %v", err)
+		va.publishError("stream", err)
+		if !isRetryableStreamError(err) {
+			return err
+		}
+		if stream, err = va.reconnectStream(ctx, err); err != nil {
+			return err
 		}
-	}()
-
-	// 开始音频输入
-	if err := stream.StartAudioInput(); err != nil {
-		return fmt.Errorf("开始音频输入失败: %w", err)
 	}
+	defer func() { stream.Close() }()
+
+	// 会话到期前在后台打开新流，就绪后切换音频输入
+	renewTimer := time.NewTimer(time.Until(va.renewal.renewAt(stream.openedAt)))
+	defer renewTimer.Stop()
+	renewed := make(chan renewResult, 1)
+	renewing := false
 
 	// 持续发送音频
 	for {
 		select {
 		case <-ctx.Done():
-			stream.EndAudioInput()
-			fmt.Println("✓ 发送线程已停止")
+			va.logger.Info("发送线程已停止")
 			return ctx.Err()
 
+		case <-stream.Broken():
+			// 连接意外中断：结束当前轮次，重连后重放对话历史
+			err := stream.Failure()
+			va.handleStreamLoss(stream, err)
+			if !isRetryableStreamError(err) {
+				return fmt.Errorf("连接不可恢复: %w", err)
+			}
+			next, err := va.reconnectStream(ctx, err)
+			if err != nil {
+				return err
+			}
+			stream = next
+			renewTimer.Reset(time.Until(va.renewal.renewAt(stream.openedAt)))
+
+		case <-renewTimer.C:
+			if !va.shouldRenew(stream, time.Now()) {
+				renewTimer.Reset(va.renewal.retryDelay(stream.openedAt, time.Now()))
+				continue
+			}
+			stream.log().Info("Sonic 会话即将到期，开始续期", "age", time.Since(stream.openedAt).Round(time.Second))
+			renewing = true
+			go func() {
+				next, err := va.openSonicStream(ctx)
+				renewed <- renewResult{stream: next, err: err}
+			}()
+
+		case <-va.renewChan:
+			// 配置（如音色）改变，等对话空闲时换用新会话
+			if !renewing {
+				renewTimer.Reset(0)
+			}
+
+		case result := <-renewed:
+			renewing = false
+			if result.err != nil {
+				va.metrics.SessionRenewals.WithLabelValues("failed").Inc()
+				stream.log().Error("会话续期失败", "error", result.err)
+				va.publishError("stream", result.err)
+				// 旧流还没到期就稍后重试
+				if time.Now().Before(stream.openedAt.Add(va.renewal.MaxSessionDuration)) {
+					renewTimer.Reset(renewalRetryInterval)
+				}
+				continue
+			}
+			va.metrics.SessionRenewals.WithLabelValues("ok").Inc()
+			old := stream
+			stream = result.stream
+			stream.setTraceCtx(old.currentTraceCtx())
+			go va.retireStream(old)
+			renewTimer.Reset(time.Until(va.renewal.renewAt(stream.openedAt)))
+
+		case input := <-va.textInputChan:
+			// 文字输入作为 USER 的 TEXT 内容块发送，与语音轮次共用同一个会话
+			inputTrace := turnTraceFrom(input.TraceCtx)
+			stream.setTraceCtx(input.TraceCtx)
+			if err := stream.SendText(input.Text); err != nil {
+				stream.log().Error("发送文本失败", "error", err)
+				va.publishError("stream", err)
+				inputTrace.Fail(err)
+				continue
+			}
+			inputTrace.StartModelWait()
+
 		case audioChunk := <-va.audioInputChan:
+			// 工具调用未完成时不发送新音频
+			if !va.turn.CanSendAudio() {
+				va.log().Warn("工具调用进行中，丢弃音频", "duration_sec", float64(len(audioChunk.Data))/8000.0)
+				continue
+			}
+
 			// 收到音频数据
-			fmt.Printf("📤 发送音频 (%.2f 秒)...\n", float64(len(audioChunk.Data))/8000.0)
+			stream.log().Debug("发送音频", "duration_sec", float64(len(audioChunk.Data))/8000.0)
 
 			// mulaw 转 PCM (Nova Sonic 需要 16kHz PCM)
 			pcmData := make([]byte, len(audioChunk.Data)*2)
@@ -741,22 +1463,31 @@ func (va *VoiceAgent) StreamAudioToNova(ctx context.Context, receiveChan chan<-
 				binary.LittleEndian.PutUint16(pcmData[i*2:], uint16(sample))
 			}
 
-			// 发送音频块
-			if err := stream.SendAudioChunk(pcmData); err != nil {
-				log.Printf("❌ 发送音频失败: %v", err)
-				continue
-			}
-
-			// 音频发送完毕，结束并重新开始
-			if err := stream.EndAudioInput(); err != nil {
-				log.Printf("❌ 结束音频输入失败: %v", err)
+			// 每段语音使用一个新的音频内容块：contentStart → audioInput... → contentEnd
+			chunkTrace := turnTraceFrom(audioChunk.TraceCtx)
+			stream.setTraceCtx(audioChunk.TraceCtx)
+			contentName, err := stream.StartAudioInput()
+			if err == nil {
+				sendSpan := chunkTrace.StartSend(contentName)
+				err = stream.SendAudio(pcmData)
+				if err == nil {
+					err = stream.EndAudioInput()
+				}
+				sendSpan.End()
 			}
-
-			// 等待短暂时间后重新开始新的音频输入
-			time.Sleep(100 * time.Millisecond)
-			if err := stream.StartAudioInput(); err != nil {
-				log.Printf("❌ 重新开始音频输入失败: %v", err)
+			if err != nil {
+				stream.log().Error("发送音频失败", logKeyContent, contentName, "error", err)
+				va.publishError("stream", err)
+				chunkTrace.Fail(err)
+				// 不让半截的内容块影响下一段语音
+				if stream.audioContentName != "" {
+					stream.EndAudioInput()
+				}
+				continue
 			}
+			chunkTrace.StartModelWait()
+			va.commitTurn(va.transcript.AddAudio(RoleUser, audioChunk.Data,
+				audioChunk.Timestamp.Add(-mulawDuration(audioChunk.Data))))
 		}
 	}
 }
@@ -797,7 +1528,7 @@ func (va *VoiceAgent) SendToNova(ctx context.Context, audioData []byte) ([]byte,
 		return nil, "", fmt.Errorf("序列化请求失败: %w", err)
 	}
 
-	fmt.Println("📤 正在发送音频到 Nova 模型...")
+	va.log().Info("正在发送音频到 Nova 模型")
 
 	// 调用 Bedrock InvokeModel API
 	output, err := va.bedrockClient.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
@@ -807,6 +1538,7 @@ func (va *VoiceAgent) SendToNova(ctx context.Context, audioData []byte) ([]byte,
 		Body:        requestBody,
 	})
 	if err != nil {
+		va.publishError("bedrock", err)
 		return nil, "", fmt.Errorf("调用 Bedrock API 失败: %w", err)
 	}
 
@@ -816,7 +1548,7 @@ func (va *VoiceAgent) SendToNova(ctx context.Context, audioData []byte) ([]byte,
 		return nil, "", fmt.Errorf("解析响应失败: %w", err)
 	}
 
-	fmt.Println("✓ 收到 Nova 响应")
+	va.log().Info("收到 Nova 响应")
 
 	// 提取文本和音频响应
 	textResponse := ""
@@ -831,7 +1563,7 @@ func (va *VoiceAgent) SendToNova(ctx context.Context, audioData []byte) ([]byte,
 						// 提取文本响应
 						if text, ok := contentItem["text"].(string); ok {
 							textResponse = text
-							fmt.Printf("💬 Nova 回复（文本）: %s\n", text)
+							va.log().Info("Nova 回复（文本）", transcriptAttr(text))
 						}
 						// 提取音频响应
 						if audio, ok := contentItem["audio"].(map[string]interface{}); ok {
@@ -855,43 +1587,221 @@ func (va *VoiceAgent) SendToNova(ctx context.Context, audioData []byte) ([]byte,
 		return audioBytes, textResponse, nil
 	}
 
-	// 如果没有音频但有文本，使用文本转语音（TTS）
-	// 注意：这里简化处理，实际可能需要调用其他TTS服务
+	// 如果没有音频但有文本，用本地 TTS 朗读（音频已交给播放线程），未配置 TTS 时只返回文本
 	if textResponse != "" {
-		// 返回空音频和文本，让调用者处理
-		return nil, textResponse, nil
+		spoken, err := va.speak(ctx, textResponse, nil, false)
+		if err != nil {
+			va.log().Warn("朗读文本回复失败", "error", err)
+			va.publishError("tts", err)
+			return nil, textResponse, nil
+		}
+		return spoken, textResponse, nil
 	}
 
 	return nil, "", fmt.Errorf("响应中未找到音频或文本数据")
 }
 
 func main() {
-	fmt.Println("=== AWS Bedrock Nova 全双工语音对话系统 ===")
-	fmt.Println("模型: Nova Sonic | 采样率: 8000 Hz | 编码: mulaw")
-	fmt.Println("特性: VAD 自动检测 | 实时流式对话 | 支持打断")
-	fmt.Println()
+	logLevel := flag.String("log-level", "info", "日志级别: debug/info/warn/error")
+	logFormat := flag.String("log-format", "text", "日志格式: text/json")
+	logRedact := flag.Bool("log-redact", false, "日志中隐藏识别和回复文本")
+	metricsAddr := flag.String("metrics-addr", "", "Prometheus 指标监听地址，如 :9090（为空则不启用）")
+	traceExporter := flag.String("trace-exporter", "none", "链路追踪导出方式: none/stdout/otlp")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "OTLP/HTTP collector 地址，如 localhost:4318")
+	sonicEndpoint := flag.String("sonic-endpoint", "", "双向流服务地址，为空则使用 Bedrock Runtime")
+	sessionMax := flag.Duration("session-max", 8*time.Minute, "单条 Sonic 会话最长时长，到期前自动续期")
+	historyTokens := flag.Int("history-tokens", DefaultHistoryTokenBudget, "新会话重放对话历史的 token 预算（负数表示不重放）")
+	storeSpec := flag.String("store", "none", "对话存储: none（默认，只保存在内存中）/ file:<目录> / sqlite:<文件>")
+	resume := flag.String("resume", "", "恢复之前的会话 ID，重放其对话历史")
+	summaryModel := flag.String("summary-model", "", "摘要较早对话的 Bedrock 文本模型，如 "+DefaultSummaryModelID+"（为空则不摘要）")
+	summaryTurns := flag.Int("summary-turns", DefaultSummaryConfig().MaxTurns, "对话超过这么多轮时摘要较早的轮次（0 表示不按轮数）")
+	summaryTokens := flag.Int("summary-tokens", DefaultSummaryConfig().MaxTokens, "对话文本超过这么多 token 时摘要较早的轮次（0 表示不按 token）")
+	summaryKeep := flag.Int("summary-keep", DefaultSummaryConfig().KeepRecent, "摘要后保留原文的最近轮数")
+	textModel := flag.String("text-model", "", "级联模式使用的 Bedrock 文本模型，如 us.amazon.nova-lite-v1:0（为空则使用 Nova Sonic）")
+	sttCommand := flag.String("stt-cmd", "", "级联模式的语音识别命令，{wav} 替换为音频文件（为空则只接受文字输入）")
+	voice := flag.String("voice", "", "Sonic 输出音色，为空则使用人设的音色，运行中可用 /voice 切换")
+	personaName := flag.String("persona", DefaultPersonaName, "会话使用的人设，运行中可用 /persona 切换")
+	personasFile := flag.String("personas", "", "自定义人设的 JSON 文件，与内置人设合并")
+	callerSpec := flag.String("caller", "", "来电者信息，供系统提示模板使用，如 name=张三,phone=13800000000")
+	callerID := flag.String("caller-id", "", "来电号码或用户 ID，系统提示模板中的 {{.CallerID}}")
+	locale := flag.String("locale", "", "来电者的语言区域，系统提示模板中的 {{.Locale}}（为空则使用人设的语言）")
+	fieldsFile := flag.String("fields", "", "JSON 对象文件，作为系统提示模板中的 {{.Fields}}（如 CRM 字段）")
+	promptFile := flag.String("prompt-file", "", "系统提示模板文件，覆盖人设的系统提示，修改后自动重新加载")
+	kbDir := flag.String("kb", "", "本地知识库目录（Markdown / 文本），作为 search_knowledge_base 工具提供给模型")
+	kbEmbedModel := flag.String("kb-embed-model", "", "知识库向量检索使用的 Bedrock 向量模型，如 "+DefaultEmbeddingModelID+"（为空则只用 BM25，完全离线）")
+	bedrockKB := flag.String("bedrock-kb", "", "Bedrock 知识库 ID，作为工具提供给模型（需与 Nova Sonic 同在 us-east-1）")
+	bedrockKBMode := flag.String("bedrock-kb-mode", KnowledgeBaseModeRetrieve, "Bedrock 知识库工具的方式: retrieve（返回段落）/ generate（RetrieveAndGenerate 生成回答）")
+	bedrockKBModel := flag.String("bedrock-kb-model", "", "generate 模式生成回答的模型 ARN")
+	bedrockAgent := flag.String("bedrock-agent", "", "Bedrock Agent，格式 <agentId>:<aliasId>，作为 ask_agent 工具提供给模型")
+	printPrompt := flag.Bool("print-prompt", false, "打印渲染后的系统提示后退出（不连接 AWS）")
+	ttsEngine := flag.String("tts", "auto", "模型只返回文本时的 TTS 引擎: none/espeak[:voice]/piper:<model>/auto/fake（调试用提示音）")
+	tuiMode := flag.Bool("tui", false, "终端界面：麦克风电平、VAD 状态、播放缓冲、对话文本和每轮延迟")
+	inputFile := flag.String("input-file", "", "用音频文件（WAV 或 8kHz .ulaw）代替麦克风输入")
+	logFile := flag.String("log-file", "", "日志写入文件（-tui 时默认 voice-agent.log）")
+	flag.Parse()
+
+	// 初始化日志
+	logConfig := DefaultLogConfig()
+	level, err := ParseLogLevel(*logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	logConfig.Level = level
+	logConfig.Format = *logFormat
+	logConfig.RedactTranscripts = *logRedact
+	// 终端界面占用屏幕，日志改写到文件
+	if *tuiMode && *logFile == "" {
+		*logFile = "voice-agent.log"
+	}
+	if *logFile != "" {
+		file, err := os.OpenFile(*logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		defer file.Close()
+		logConfig.Output = file
+	}
+	logger, err := NewLogger(logConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	logger.Info("AWS Bedrock Nova 全双工语音对话系统",
+		"model", "Nova Sonic", "sample_rate", 8000, "encoding", "mulaw",
+		"features", "VAD 自动检测 | 实时流式对话 | 支持打断")
+
+	// 人设和来电者信息
+	personas, err := LoadPersonas(*personasFile)
+	if err != nil {
+		logger.Error("加载人设失败", "error", err)
+		os.Exit(2)
+	}
+	caller, err := ParseCallerInfo(*callerSpec)
+	if err != nil {
+		logger.Error("解析来电者信息失败", "error", err)
+		os.Exit(2)
+	}
+	fields, err := LoadSessionFields(*fieldsFile)
+	if err != nil {
+		logger.Error("加载会话字段失败", "error", err)
+		os.Exit(2)
+	}
+	sessionVars := SessionVars{CallerID: *callerID, Locale: *locale, Caller: caller, Fields: fields}
+	if *printPrompt {
+		if err := printSystemPrompt(os.Stdout, personas, *personaName, *voice, *promptFile, sessionVars); err != nil {
+			logger.Error("渲染系统提示失败", "error", err)
+			os.Exit(2)
+		}
+		return
+	}
 
 	// 创建主上下文
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// 初始化链路追踪
+	shutdownTracing, err := InitTracing(ctx, TracingConfig{
+		Exporter: *traceExporter,
+		Endpoint: *otlpEndpoint,
+	})
+	if err != nil {
+		logger.Error("初始化链路追踪失败", "error", err)
+		os.Exit(2)
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			logger.Warn("刷新追踪数据失败", "error", err)
+		}
+	}()
+
+	// 打开对话存储
+	store, err := OpenSessionStore(*storeSpec)
+	if err != nil {
+		logger.Error("打开对话存储失败", "error", err)
+		os.Exit(2)
+	}
+	if store != nil {
+		defer store.Close()
+	}
+
+	// 级联模式的语音识别和 TTS
+	var stt SpeechToText
+	if *sttCommand != "" {
+		if stt, err = NewCommandSpeechToText(*sttCommand); err != nil {
+			logger.Error("创建语音识别失败", "error", err)
+			os.Exit(2)
+		}
+	}
+	// 离线 TTS 的语音按启动时人设的回复语言选择
+	ttsLanguage := ""
+	if persona, err := FindPersona(personas, *personaName); err == nil {
+		ttsLanguage = persona.Language
+	}
+	tts, err := NewTextToSpeech(*ttsEngine, ttsLanguage)
+	if err != nil {
+		logger.Error("创建 TTS 失败", "error", err)
+		os.Exit(2)
+	}
+
+	// Bedrock 知识库和 Agent 工具
+	bedrockTools := BedrockToolsConfig{KnowledgeBaseID: *bedrockKB, Mode: *bedrockKBMode, ModelARN: *bedrockKBModel}
+	if *bedrockAgent != "" {
+		if bedrockTools.AgentID, bedrockTools.AgentAliasID, err = ParseBedrockAgent(*bedrockAgent); err != nil {
+			logger.Error("解析 Bedrock Agent 失败", "error", err)
+			os.Exit(2)
+		}
+	}
+
 	// 创建语音代理
-	agent, err := NewVoiceAgent(ctx)
+	metrics := NewMetrics()
+	agent, err := NewVoiceAgent(ctx, AgentOptions{
+		Logger:   logger,
+		Metrics:  metrics,
+		Endpoint: *sonicEndpoint,
+		Renewal:  SessionRenewalConfig{MaxSessionDuration: *sessionMax},
+
+		HistoryTokenBudget: *historyTokens,
+		Store:              store,
+		ResumeSessionID:    *resume,
+		SummaryModelID:     *summaryModel,
+		Summary: SummaryConfig{
+			MaxTurns:   *summaryTurns,
+			MaxTokens:  *summaryTokens,
+			KeepRecent: *summaryKeep,
+		},
+		TextModelID: *textModel,
+		STT:         stt,
+		TTS:         tts,
+		Personas:    personas,
+		Persona:     *personaName,
+		VoiceID:     *voice,
+		PromptFile:  *promptFile,
+		Vars:        sessionVars,
+
+		KnowledgeBaseDir: *kbDir,
+		EmbeddingModelID: *kbEmbedModel,
+		Bedrock:          bedrockTools,
+	})
 	if err != nil {
-		log.Fatalf("❌ 创建语音代理失败: %v", err)
+		logger.Error("创建语音代理失败", "error", err)
+		os.Exit(1)
 	}
 	defer agent.Close()
 
-	fmt.Println("✓ 语音代理已初始化")
 	sessionID, _, _ := agent.GetSessionInfo()
-	fmt.Printf("📋 会话 ID: %s\n", sessionID)
-	fmt.Println()
+	logger.Info("语音代理已初始化", logKeySession, sessionID)
 
 	// 创建 output 目录（用于保存录音，可选）
 	outputDir := "output"
 	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
 		if err := os.MkdirAll(outputDir, 0755); err != nil {
-			log.Printf("⚠️  创建 output 目录失败: %v", err)
+			logger.Warn("创建 output 目录失败", "error", err)
 		}
 	}
 
@@ -902,20 +1812,22 @@ func main() {
 	// 创建错误通道
 	errChan := make(chan error, 4)
 
+	// 指标端点（可选）
+	if *metricsAddr != "" {
+		go func() {
+			if err := metrics.ServeMetrics(ctx, *metricsAddr, logger); err != nil {
+				errChan <- fmt.Errorf("指标端点错误: %w", err)
+			}
+		}()
+	}
+
 	// 启动所有线程
-	fmt.Println("🚀 启动全双工语音对话系统...")
-	fmt.Println()
+	logger.Info("启动全双工语音对话系统")
 
-	// 1. 启动连续录音线程（带 VAD 检测）
-	go func() {
-		if err := agent.StartContinuousRecording(ctx); err != nil {
-			if err != context.Canceled {
-				errChan <- fmt.Errorf("录音线程错误: %w", err)
-			}
-		}
-	}()
+	// 系统提示文件修改后自动重新加载
+	go agent.WatchPrompt(ctx, promptReloadInterval)
 
-	// 2. 启动连续播放线程（支持流式播放和打断）
+	// 1. 启动连续播放线程（支持流式播放和打断）
 	go func() {
 		if err := agent.StartContinuousPlayback(ctx); err != nil {
 			if err != context.Canceled {
@@ -924,65 +1836,136 @@ func main() {
 		}
 	}()
 
-	// 3. 启动流式发送线程（ConverseStream）
-	go func() {
-		if err := agent.StreamAudioToNova(ctx, nil); err != nil {
-			if err != context.Canceled {
-				errChan <- fmt.Errorf("发送线程错误: %w", err)
+	streamDone := make(chan error, 1)
+	if *textModel != "" {
+		// 级联模式：配置了语音识别时识别每段语音，标准输入的每一行也作为用户发言
+		if stt != nil {
+			go func() {
+				if err := startCapture(ctx, agent, *inputFile); err != nil {
+					if err != context.Canceled {
+						errChan <- fmt.Errorf("录音线程错误: %w", err)
+					}
+				}
+			}()
+			go func() {
+				if err := agent.RunCascade(ctx); err != nil {
+					if err != context.Canceled {
+						streamDone <- err
+					}
+				}
+			}()
+		}
+		logger.Info("级联模式", "model", *textModel, "voice_input", stt != nil)
+	} else {
+		// 2. 启动连续录音线程（带 VAD 检测）
+		go func() {
+			if err := startCapture(ctx, agent, *inputFile); err != nil {
+				if err != context.Canceled {
+					errChan <- fmt.Errorf("录音线程错误: %w", err)
+				}
 			}
+		}()
+
+		// 3. 启动流式发送线程（双向流），暂时性错误会自动重连，返回即不可恢复
+		go func() {
+			if err := agent.StreamAudioToNova(ctx, nil); err != nil {
+				if err != context.Canceled {
+					streamDone <- err
+				}
+			}
+		}()
+	}
+
+	// 4. 控制台：/ 开头的行是命令，其他行作为文字输入，和语音轮次交替进行
+	quitChan := make(chan struct{})
+	var quitOnce sync.Once
+	var consoleOut io.Writer = os.Stdout
+	if *tuiMode {
+		tui := NewTUI(agent, os.Stdout)
+		consoleOut = tui
+		tuiDone := make(chan struct{})
+		go func() {
+			defer close(tuiDone)
+			tui.Run(ctx)
+		}()
+		// 退出前等界面恢复终端
+		defer func() {
+			cancel()
+			<-tuiDone
+		}()
+	}
+	console := NewConsole(agent, consoleOut, outputDir, func() {
+		quitOnce.Do(func() { close(quitChan) })
+	})
+	go func() {
+		if err := console.Run(ctx, os.Stdin); err != nil && err != context.Canceled {
+			logger.Warn("控制台已停止", "error", err)
 		}
 	}()
 
-	// 4. 启动流式接收线程（占位符，当前集成在发送线程中）
-	// 当真正的 ConverseStream API 可用时，启用此线程
-	// go func() {
-	// 	eventStream := make(chan *bedrockruntime.ConverseStreamOutput, 10)
-	// 	if err := agent.ReceiveFromNova(ctx, eventStream); err != nil {
-	// 		if err != context.Canceled {
-	// 			errChan <- fmt.Errorf("接收线程错误: %w", err)
-	// 		}
-	// 	}
-	// }()
-
-	fmt.Println("✓ 所有线程已启动")
-	fmt.Println()
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Println("系统就绪！开始说话，系统会自动检测并处理。")
-	fmt.Println("按 Ctrl+C 退出程序")
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Println()
+	logger.Info("系统就绪！开始说话，或输入文字后回车发送，输入 /help 查看命令。按 Ctrl+C 或 /quit 退出程序")
 
 	// 定期显示会话信息
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
+	// 退出：停止所有线程并显示最终统计
+	shutdown := func() {
+		cancel()
+
+		// 显示最终统计
+		sessionID, msgCount, duration := agent.GetSessionInfo()
+		logger.Info("会话统计",
+			logKeySession, sessionID,
+			"message_count", msgCount,
+			"duration", duration.Round(time.Second))
+		if store != nil {
+			logger.Info("对话已保存，可用 -resume 恢复", logKeySession, sessionID)
+		}
+		logger.Info("程序已退出")
+	}
+
 	// 主事件循环
 	for {
 		select {
 		case <-sigChan:
 			// 收到退出信号
-			fmt.Println("\n\n🛑 收到退出信号，正在关闭...")
-			cancel()
+			logger.Info("收到退出信号，正在关闭")
+			shutdown()
+			return
 
-			// 显示最终统计
-			sessionID, msgCount, duration := agent.GetSessionInfo()
-			fmt.Printf("\n📊 会话统计:\n")
-			fmt.Printf("   会话 ID: %s\n", sessionID)
-			fmt.Printf("   消息数量: %d\n", msgCount)
-			fmt.Printf("   会话时长: %s\n", duration.Round(time.Second))
-			fmt.Println("\n✓ 程序已退出")
+		case <-quitChan:
+			logger.Info("收到 /quit 命令，正在关闭")
+			shutdown()
+			return
+
+		case err := <-streamDone:
+			logger.Error("Nova Sonic 连接不可恢复，程序退出", "error", err)
+			agent.publishError("main", err)
+			cancel()
 			return
 
 		case err := <-errChan:
 			// 收到线程错误
-			log.Printf("❌ 线程错误: %v", err)
-			log.Println("⚠️  尝试继续运行...")
+			logger.Error("线程错误，尝试继续运行", "error", err)
+			agent.publishError("main", err)
 
 		case <-ticker.C:
 			// 定期显示会话信息
 			sessionID, msgCount, duration := agent.GetSessionInfo()
-			fmt.Printf("\n📊 [会话信息] ID: %s | 消息: %d | 时长: %s\n\n",
-				sessionID, msgCount, duration.Round(time.Second))
+			logger.Info("会话信息",
+				logKeySession, sessionID,
+				"message_count", msgCount,
+				"duration", duration.Round(time.Second),
+				"total_tokens", agent.GetUsage().TotalTokens)
 		}
 	}
 }
+
+// startCapture 启动录音：指定了音频文件时用文件代替麦克风
+func startCapture(ctx context.Context, agent *VoiceAgent, inputFile string) error {
+	if inputFile != "" {
+		return agent.StartFileRecording(ctx, inputFile)
+	}
+	return agent.StartContinuousRecording(ctx)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics Prometheus 指标集合
+type Metrics struct {
+	registry *prometheus.Registry
+
+	// ResponseLatency 用户说完到 AI 第一个音频字节开始播放的延迟
+	ResponseLatency prometheus.Histogram
+	// VADDecisions VAD 状态切换次数（speech_start / speech_end）
+	VADDecisions *prometheus.CounterVec
+	// VADFrameEnergy 每帧 RMS 能量，按 VAD 判定结果分组
+	VADFrameEnergy *prometheus.HistogramVec
+	// UtteranceDuration 每段用户语音的时长
+	UtteranceDuration prometheus.Histogram
+	// BargeIns 打断次数，按来源分组
+	BargeIns *prometheus.CounterVec
+	// PlaybackUnderruns AI 回复中途播放缓冲耗尽、输出静音的次数
+	PlaybackUnderruns prometheus.Counter
+	// StreamBytes 双向流累计收发字节数
+	StreamBytes *prometheus.CounterVec
+	// StreamSessionBytes 每条双向流关闭时的收发字节数
+	StreamSessionBytes *prometheus.HistogramVec
+	// BedrockErrors Bedrock 调用错误，按错误类型分组
+	BedrockErrors *prometheus.CounterVec
+	// ActiveSessions 当前打开的 Sonic 双向流数量
+	ActiveSessions prometheus.Gauge
+	// Tokens 模型 token 用量，按方向和类型分组
+	Tokens *prometheus.CounterVec
+	// SessionRenewals 会话续期次数，按结果分组（ok / failed）
+	SessionRenewals *prometheus.CounterVec
+	// Reconnects 连接中断后的重连尝试，按结果分组（ok / failed / gave_up）
+	Reconnects *prometheus.CounterVec
+
+	// responseStart 本轮开始等待回复的时间（用户说完），第一次播放回复后清零
+	responseMu    sync.Mutex
+	responseStart time.Time
+}
+
+// NewMetrics 创建指标并注册到独立的 registry
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		ResponseLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "voice_agent_response_latency_seconds",
+			Help:    "End of user speech to first assistant audio byte played.",
+			Buckets: []float64{0.1, 0.25, 0.5, 0.75, 1, 1.5, 2, 3, 5, 10},
+		}),
+		VADDecisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "voice_agent_vad_decisions_total",
+			Help: "VAD state changes by decision.",
+		}, []string{"decision"}),
+		VADFrameEnergy: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "voice_agent_vad_frame_energy",
+			Help:    "RMS energy of captured frames by VAD state.",
+			Buckets: prometheus.ExponentialBuckets(50, 2, 10),
+		}, []string{"state"}),
+		UtteranceDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "voice_agent_utterance_duration_seconds",
+			Help:    "Duration of detected user utterances.",
+			Buckets: []float64{0.5, 1, 2, 3, 5, 8, 13, 20, 30},
+		}),
+		BargeIns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "voice_agent_barge_ins_total",
+			Help: "Assistant playback interruptions by source.",
+		}, []string{"source"}),
+		PlaybackUnderruns: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "voice_agent_playback_underruns_total",
+			Help: "Times the playback buffer ran dry in the middle of an assistant reply.",
+		}),
+		StreamBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "voice_agent_stream_bytes_total",
+			Help: "Bytes sent to and received from the Sonic bidirectional stream.",
+		}, []string{"direction"}),
+		StreamSessionBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "voice_agent_stream_session_bytes",
+			Help:    "Bytes transferred over a single Sonic stream, observed when it closes.",
+			Buckets: prometheus.ExponentialBuckets(1024, 4, 10),
+		}, []string{"direction"}),
+		BedrockErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "voice_agent_bedrock_errors_total",
+			Help: "Bedrock errors by type.",
+		}, []string{"type"}),
+		ActiveSessions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "voice_agent_active_sessions",
+			Help: "Currently open Sonic bidirectional streams.",
+		}),
+		Tokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "voice_agent_tokens_total",
+			Help: "Model tokens reported by usageEvent, by direction and modality.",
+		}, []string{"direction", "kind"}),
+		SessionRenewals: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "voice_agent_session_renewals_total",
+			Help: "Sonic stream rollovers before the session time limit, by result.",
+		}, []string{"result"}),
+		Reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "voice_agent_reconnects_total",
+			Help: "Sonic stream reconnect attempts after a failure, by result.",
+		}, []string{"result"}),
+	}
+
+	m.registry.MustRegister(
+		m.ResponseLatency,
+		m.VADDecisions,
+		m.VADFrameEnergy,
+		m.UtteranceDuration,
+		m.BargeIns,
+		m.PlaybackUnderruns,
+		m.StreamBytes,
+		m.StreamSessionBytes,
+		m.BedrockErrors,
+		m.ActiveSessions,
+		m.Tokens,
+		m.SessionRenewals,
+		m.Reconnects,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler 返回 /metrics 的 HTTP 处理器
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ServeMetrics 在 addr 上提供 /metrics 端点，直到 ctx 取消
+func (m *Metrics) ServeMetrics(ctx context.Context, addr string, logger *slog.Logger) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("指标端点已启动", "addr", addr, "path", "/metrics")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// observeTransition 根据对话状态转换记录延迟
+// 从用户说完开始计时，到本轮第一次播放回复为止；工具调用结束后回到等待模型不重新计时
+func (m *Metrics) observeTransition(t TurnTransition) {
+	m.responseMu.Lock()
+	defer m.responseMu.Unlock()
+	switch t.To {
+	case TurnWaitingModel:
+		if t.From != TurnToolPending {
+			m.responseStart = t.At
+		}
+	case TurnAssistantSpeaking:
+		if !m.responseStart.IsZero() {
+			m.ResponseLatency.Observe(t.At.Sub(m.responseStart).Seconds())
+			m.responseStart = time.Time{}
+		}
+	case TurnUserSpeaking, TurnListening:
+		m.responseStart = time.Time{}
+	}
+}
+
+// bedrockErrorSources 调用 Bedrock 的错误来源：Sonic 双向流、级联模式的 ConverseStream 和摘要的 Converse
+var bedrockErrorSources = map[string]bool{
+	"stream":  true,
+	"bedrock": true,
+	"llm":     true,
+	"summary": true,
+}
+
+// observeBedrockError 记录 Bedrock 调用错误，其他来源（存储、语音识别、TTS 等）的错误不计入
+func (m *Metrics) observeBedrockError(source string, err error) {
+	if bedrockErrorSources[source] {
+		m.BedrockErrors.WithLabelValues(bedrockErrorType(err)).Inc()
+	}
+}
+
+// bedrockErrorType 将错误归类为指标标签
+func bedrockErrorType(err error) string {
+	var statusErr *StreamStatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.ErrorType != "" {
+			return statusErr.ErrorType
+		}
+		return "http_" + strconv.Itoa(statusErr.StatusCode)
+	}
+
+	var exceptionErr *StreamExceptionError
+	if errors.As(err, &exceptionErr) {
+		return exceptionErr.Type
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return "network"
+	}
+
+	if strings.Contains(err.Error(), "EOF") {
+		return "connection_closed"
+	}
+	return "unknown"
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// responseLatency 读取延迟直方图的样本数和总和
+func responseLatency(t *testing.T, m *Metrics) (uint64, float64) {
+	t.Helper()
+	families, err := m.registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == "voice_agent_response_latency_seconds" {
+			h := family.GetMetric()[0].GetHistogram()
+			return h.GetSampleCount(), h.GetSampleSum()
+		}
+	}
+	t.Fatal("没有找到延迟直方图")
+	return 0, 0
+}
+
+func mustTransition(t *testing.T, turn *TurnStateMachine, to TurnState, reason string) {
+	t.Helper()
+	if err := turn.Transition(to, reason); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResponseLatencySpansToolCalls(t *testing.T) {
+	m := NewMetrics()
+	turn := NewTurnStateMachine()
+	turn.Subscribe(m.observeTransition)
+
+	start := time.Now()
+	mustTransition(t, turn, TurnUserSpeaking, "检测到语音")
+	mustTransition(t, turn, TurnWaitingModel, "语音结束")
+	time.Sleep(50 * time.Millisecond)
+	mustTransition(t, turn, TurnToolPending, "工具调用")
+	time.Sleep(50 * time.Millisecond)
+	mustTransition(t, turn, TurnWaitingModel, "工具结果已发送")
+	time.Sleep(50 * time.Millisecond)
+	mustTransition(t, turn, TurnAssistantSpeaking, "开始播放")
+	total := time.Since(start)
+
+	count, sum := responseLatency(t, m)
+	if count != 1 {
+		t.Fatalf("样本数 = %d, want 1", count)
+	}
+	// 从用户说完开始计时，包含工具调用的时间
+	if got := sum; got < 0.15 || got > total.Seconds() {
+		t.Errorf("延迟 = %.3fs, want 0.15s ~ %.3fs", got, total.Seconds())
+	}
+
+	// 同一轮后续的播放不重复计入
+	mustTransition(t, turn, TurnToolPending, "工具调用")
+	mustTransition(t, turn, TurnWaitingModel, "工具结果已发送")
+	mustTransition(t, turn, TurnAssistantSpeaking, "开始播放")
+	if n, _ := responseLatency(t, m); n != 1 {
+		t.Errorf("样本数 = %d, want 1", n)
+	}
+}
+
+func TestErrorCounterSkipsEventBus(t *testing.T) {
+	va := newTestAgent(t)
+	// 事件总线没有订阅者，计数不依赖它
+	va.publishError("stream", &StreamExceptionError{Type: "throttlingException"})
+	va.publishError("llm", &StreamExceptionError{Type: "validationException"})
+	va.publishError("summary", context.DeadlineExceeded)
+	va.publishError("store", errors.New("磁盘已满"))
+	va.publishError("tts", errors.New("合成失败"))
+
+	for errType, want := range map[string]float64{
+		"throttlingException": 1,
+		"validationException": 1,
+		"timeout":             1,
+	} {
+		if got := testutil.ToFloat64(va.metrics.BedrockErrors.WithLabelValues(errType)); got != want {
+			t.Errorf("BedrockErrors{%s} = %v, want %v", errType, got, want)
+		}
+	}
+	// 存储和 TTS 的错误不是 Bedrock 错误
+	if got := testutil.CollectAndCount(va.metrics.BedrockErrors); got != 3 {
+		t.Errorf("BedrockErrors 有 %d 个标签组合, want 3", got)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// CommandTextToSpeech 调用本地离线 TTS 程序（espeak-ng、piper 等）合成语音
+// 参数中的 {text} 替换为要朗读的文本；不含 {text} 时文本从标准输入传入
+// 程序的标准输出为 WAV，或 RawSampleRate 指定采样率的 16-bit 单声道 PCM
+type CommandTextToSpeech struct {
+	Command string
+	Args    []string
+	// RawSampleRate 输出为裸 PCM 时的采样率，0 表示输出为 WAV
+	RawSampleRate int
+}
+
+// NewEspeakTextToSpeech 使用 espeak-ng（或旧版 espeak）合成，voice 如 "cmn"、"en-us"
+func NewEspeakTextToSpeech(voice string) (*CommandTextToSpeech, error) {
+	for _, name := range []string{"espeak-ng", "espeak"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return &CommandTextToSpeech{
+				Command: path,
+				Args:    []string{"-v", voice, "-s", "160", "--stdout", "--stdin"},
+			}, nil
+		}
+	}
+	return nil, errors.New("未找到 espeak-ng 或 espeak")
+}
+
+// NewPiperTextToSpeech 使用 piper 和指定的 .onnx 语音模型合成，piper 输出 22050Hz 裸 PCM
+func NewPiperTextToSpeech(model string) (*CommandTextToSpeech, error) {
+	path, err := exec.LookPath("piper")
+	if err != nil {
+		return nil, errors.New("未找到 piper")
+	}
+	return &CommandTextToSpeech{
+		Command:       path,
+		Args:          []string{"--model", model, "--output-raw"},
+		RawSampleRate: 22050,
+	}, nil
+}
+
+// Synthesize 运行合成程序并把输出转换为 8kHz PCM
+func (c *CommandTextToSpeech) Synthesize(ctx context.Context, text string) ([]byte, error) {
+	args := make([]string, len(c.Args))
+	viaStdin := true
+	for i, arg := range c.Args {
+		if strings.Contains(arg, "{text}") {
+			viaStdin = false
+		}
+		args[i] = strings.ReplaceAll(arg, "{text}", text)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Command, args...)
+	if viaStdin {
+		cmd.Stdin = strings.NewReader(text)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s 失败: %w: %s", c.Command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	pcm, rate := stdout.Bytes(), c.RawSampleRate
+	if rate == 0 {
+		var err error
+		if pcm, rate, err = parsePCMWAV(pcm); err != nil {
+			return nil, err
+		}
+	}
+	return resamplePCM(pcm, rate, 8000), nil
+}
+
+// parsePCMWAV 解析 16-bit PCM WAV，多声道时只取第一个声道，返回 PCM 数据和采样率
+// 流式输出的 WAV（如 espeak-ng --stdout）data 块长度可能不准确，以实际数据为准
+func parsePCMWAV(data []byte) ([]byte, int, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, 0, errors.New("不是 WAV 数据")
+	}
+
+	var format, channels, bits uint16
+	var rate uint32
+	pos := 12
+	for pos+8 <= len(data) {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8:]
+		if size >= 0 && size < len(body) {
+			body = body[:size]
+		}
+
+		switch id {
+		case "fmt ":
+			if len(body) < 16 {
+				return nil, 0, errors.New("WAV fmt 块不完整")
+			}
+			format = binary.LittleEndian.Uint16(body[0:2])
+			channels = binary.LittleEndian.Uint16(body[2:4])
+			rate = binary.LittleEndian.Uint32(body[4:8])
+			bits = binary.LittleEndian.Uint16(body[14:16])
+		case "data":
+			if format != 1 || bits != 16 || channels == 0 {
+				return nil, 0, fmt.Errorf("不支持的 WAV 格式 (format=%d bits=%d channels=%d)", format, bits, channels)
+			}
+			if channels == 1 {
+				return body[:len(body)/2*2], int(rate), nil
+			}
+			frame := int(channels) * 2
+			mono := make([]byte, 0, len(body)/frame*2)
+			for i := 0; i+frame <= len(body); i += frame {
+				mono = append(mono, body[i], body[i+1])
+			}
+			return mono, int(rate), nil
+		}
+
+		pos += 8 + size + size%2
+	}
+	return nil, 0, errors.New("WAV 中没有 data 块")
+}
+
+// resamplePCM 16-bit 单声道 PCM 重采样：降采样时对每个输出样本覆盖的输入区间取平均（兼作低通），
+// 升采样时线性插值
+func resamplePCM(pcm []byte, from, to int) []byte {
+	if from == to || from <= 0 || to <= 0 {
+		return pcm
+	}
+	in := len(pcm) / 2
+	sample := func(i int) float64 {
+		return float64(int16(binary.LittleEndian.Uint16(pcm[i*2:])))
+	}
+	outCount := int(int64(in) * int64(to) / int64(from))
+	out := make([]byte, outCount*2)
+	ratio := float64(from) / float64(to)
+
+	for k := 0; k < outCount; k++ {
+		var v float64
+		if ratio > 1 {
+			start := int(float64(k) * ratio)
+			end := min(int(float64(k+1)*ratio), in)
+			if end <= start {
+				end = start + 1
+			}
+			for i := start; i < end; i++ {
+				v += sample(i)
+			}
+			v /= float64(end - start)
+		} else {
+			pos := float64(k) * ratio
+			i := int(pos)
+			frac := pos - float64(i)
+			v = sample(i)
+			if i+1 < in {
+				v += (sample(i+1) - v) * frac
+			}
+		}
+		binary.LittleEndian.PutUint16(out[k*2:], uint16(int16(v)))
+	}
+	return out
+}
+
+// parseTTSEngine 解析 -tts 参数：name 或 name:参数，如 "espeak:cmn"、"piper:zh_CN-huayan-medium.onnx"
+func parseTTSEngine(spec string) (name, arg string) {
+	name, arg, _ = strings.Cut(spec, ":")
+	return name, arg
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sonicVoices Nova Sonic 支持的输出音色及其语言
+var sonicVoices = map[string]string{
+	"matthew":  "en-US",
+	"tiffany":  "en-US",
+	"amy":      "en-GB",
+	"ambre":    "fr-FR",
+	"florian":  "fr-FR",
+	"beatrice": "it-IT",
+	"lorenzo":  "it-IT",
+	"greta":    "de-DE",
+	"lennart":  "de-DE",
+	"lupe":     "es-US",
+	"carlos":   "es-US",
+}
+
+// SonicVoices 按名称排序的可用音色
+func SonicVoices() []string {
+	voices := make([]string, 0, len(sonicVoices))
+	for voice := range sonicVoices {
+		voices = append(voices, voice)
+	}
+	sort.Strings(voices)
+	return voices
+}
+
+// isChineseLanguage 回复语言是否为中文（zh、zh-CN、zh-TW 等）
+func isChineseLanguage(language string) bool {
+	lang, _, _ := strings.Cut(strings.ToLower(language), "-")
+	return lang == "zh"
+}
+
+// normalizeVoiceID 音色 ID 统一为小写
+func normalizeVoiceID(voiceID string) string {
+	return strings.ToLower(strings.TrimSpace(voiceID))
+}
+
+// validateVoiceID 检查音色是否在 Sonic 的音色列表中
+func validateVoiceID(voiceID string) error {
+	if _, ok := sonicVoices[voiceID]; !ok {
+		return fmt.Errorf("未知的音色 %q，可用音色: %s", voiceID, strings.Join(SonicVoices(), ", "))
+	}
+	return nil
+}
+
+// defaultSystemPrompt 默认人设的系统提示，回复语言与默认音色一致
+const defaultSystemPrompt = "You are a friendly assistant. Reply briefly, usually 2-3 sentences. " +
+	"Today is {{.Weekday}}, {{.Date}}."
+
+// chineseSystemPrompt 中文人设的系统提示
+const chineseSystemPrompt = "你是一个友好的中文助手。用简短的中文回复，一般2-3句话。今天是{{.Date}} {{.Weekday}}。"
+
+// DefaultPersonaName 默认人设
+const DefaultPersonaName = "default"
+
+// Persona 人设：音色、语言、系统提示、推理参数和可用工具，每个会话使用一个人设
+type Persona struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	VoiceID     string `json:"voiceId"`
+	// Language 回复语言（BCP 47，如 zh-CN、en-US）
+	Language string `json:"language"`
+	// SystemPrompt 系统提示模板，可以使用 PromptVars 中的变量，如 {{.Date}}、{{.Caller.name}}
+	SystemPrompt string `json:"systemPrompt,omitempty"`
+	// PromptFile 系统提示模板文件，设置时代替 SystemPrompt，文件修改后自动重新加载
+	PromptFile string                 `json:"promptFile,omitempty"`
+	Inference  InferenceConfiguration `json:"inference"`
+	// Tools 可用工具的名称，省略时提供全部已注册的工具，空列表表示不提供工具
+	Tools []string `json:"tools,omitempty"`
+	// AllowVoiceMismatch 允许音色的语言与回复语言不一致（如用英文音色朗读中文），否则校验时报错
+	AllowVoiceMismatch bool `json:"allowVoiceMismatch,omitempty"`
+}
+
+// DefaultInference 默认推理参数
+func DefaultInference() InferenceConfiguration {
+	return InferenceConfiguration{MaxTokens: 1024, TopP: 0.9, Temperature: 0.7}
+}
+
+// BuiltinPersonas 内置人设
+func BuiltinPersonas() []Persona {
+	return []Persona{
+		{
+			Name:         DefaultPersonaName,
+			Description:  "Friendly assistant",
+			VoiceID:      DefaultVoiceID,
+			Language:     "en-US",
+			SystemPrompt: defaultSystemPrompt,
+			Inference:    DefaultInference(),
+		},
+		{
+			// Sonic 没有中文音色，显式允许用英文音色朗读中文回复
+			Name:               "chinese",
+			Description:        "友好的中文助手（英文音色朗读）",
+			VoiceID:            DefaultVoiceID,
+			Language:           "zh-CN",
+			SystemPrompt:       chineseSystemPrompt,
+			Inference:          DefaultInference(),
+			AllowVoiceMismatch: true,
+		},
+		{
+			Name:        "english",
+			Description: "Friendly English assistant",
+			VoiceID:     "tiffany",
+			Language:    "en-US",
+			SystemPrompt: "You are a friendly assistant. Reply briefly in English, usually 2-3 sentences. " +
+				"Today is {{.Weekday}}, {{.Date}}.",
+			Inference: DefaultInference(),
+		},
+		{
+			Name:        "receptionist",
+			Description: "Front desk assistant that greets callers by name",
+			VoiceID:     "matthew",
+			Language:    "en-US",
+			SystemPrompt: "You are the front desk assistant answering a phone call. Be polite and concise. " +
+				"Today is {{.Weekday}}, {{.Date}}, local time {{.Time}}." +
+				"{{with .Caller.name}} The caller is {{.}}.{{end}}" +
+				"{{with .Caller.phone}} Their phone number is {{.}}.{{end}}",
+			Inference: InferenceConfiguration{MaxTokens: 512, TopP: 0.9, Temperature: 0.5},
+		},
+	}
+}
+
+// Validate 检查人设配置，音色必须在 Sonic 的音色列表中，且语言与回复语言一致（除非 AllowVoiceMismatch）
+func (p Persona) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("人设缺少名称")
+	}
+	if err := validateVoiceID(p.VoiceID); err != nil {
+		return fmt.Errorf("人设 %s: %w", p.Name, err)
+	}
+	if p.Language == "" {
+		return fmt.Errorf("人设 %s 缺少语言", p.Name)
+	}
+	if locale := p.VoiceLanguageMismatch(); locale != "" && !p.AllowVoiceMismatch {
+		return fmt.Errorf("人设 %s 的音色 %s（%s）与回复语言 %s 不一致，确实需要时设置 allowVoiceMismatch",
+			p.Name, p.VoiceID, locale, p.Language)
+	}
+	if p.PromptFile == "" && strings.TrimSpace(p.SystemPrompt) == "" {
+		return fmt.Errorf("人设 %s 缺少系统提示", p.Name)
+	}
+	if _, err := p.PromptTemplate(); err != nil {
+		return fmt.Errorf("人设 %s 的系统提示: %w", p.Name, err)
+	}
+	inf := p.Inference
+	if inf.MaxTokens <= 0 || inf.TopP <= 0 || inf.TopP > 1 || inf.Temperature < 0 || inf.Temperature > 1 {
+		return fmt.Errorf("人设 %s 的推理参数无效 (maxTokens=%d topP=%g temperature=%g)",
+			p.Name, inf.MaxTokens, inf.TopP, inf.Temperature)
+	}
+	return nil
+}
+
+// PromptTemplate 创建人设的系统提示模板，PromptFile 优先于 SystemPrompt
+func (p Persona) PromptTemplate() (*PromptTemplate, error) {
+	if p.PromptFile != "" {
+		return LoadPromptFile(p.PromptFile)
+	}
+	return NewPromptTemplate(p.SystemPrompt)
+}
+
+// VoiceLanguageMismatch 音色的语言与回复语言不一致时返回音色的语言，否则返回空串
+// Sonic 用音色的语言发音，不一致时发音可能不自然
+func (p Persona) VoiceLanguageMismatch() string {
+	locale := sonicVoices[p.VoiceID]
+	voiceLang, _, _ := strings.Cut(locale, "-")
+	lang, _, _ := strings.Cut(p.Language, "-")
+	if locale == "" || strings.EqualFold(voiceLang, lang) {
+		return ""
+	}
+	return locale
+}
+
+// LoadPersonas 读取人设文件（JSON 数组），与内置人设合并，同名时文件中的覆盖内置的
+// 文件中省略的推理参数使用默认值，promptFile 的相对路径相对于人设文件所在目录
+func LoadPersonas(path string) ([]Persona, error) {
+	personas := BuiltinPersonas()
+	if path == "" {
+		return personas, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取人设文件失败: %w", err)
+	}
+	var loaded []Persona
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("解析人设文件失败: %w", err)
+	}
+	for _, p := range loaded {
+		if p.Inference == (InferenceConfiguration{}) {
+			p.Inference = DefaultInference()
+		}
+		if p.PromptFile != "" && !filepath.IsAbs(p.PromptFile) {
+			p.PromptFile = filepath.Join(filepath.Dir(path), p.PromptFile)
+		}
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		replaced := false
+		for i := range personas {
+			if personas[i].Name == p.Name {
+				personas[i] = p
+				replaced = true
+			}
+		}
+		if !replaced {
+			personas = append(personas, p)
+		}
+	}
+	return personas, nil
+}
+
+// FindPersona 按名称查找人设
+func FindPersona(personas []Persona, name string) (Persona, error) {
+	names := make([]string, 0, len(personas))
+	for _, p := range personas {
+		if p.Name == name {
+			return p, nil
+		}
+		names = append(names, p.Name)
+	}
+	return Persona{}, fmt.Errorf("未知的人设 %q，可用人设: %s", name, strings.Join(names, ", "))
+}
+
+// ResolvePersona 按名称选择人设，voiceID 和 promptFile 不为空时覆盖人设的音色和系统提示文件
+func ResolvePersona(personas []Persona, name, voiceID, promptFile string) (Persona, error) {
+	persona, err := FindPersona(personas, name)
+	if err != nil {
+		return Persona{}, err
+	}
+	if voiceID != "" {
+		persona.VoiceID = normalizeVoiceID(voiceID)
+	}
+	if promptFile != "" {
+		persona.PromptFile = promptFile
+	}
+	if err := persona.Validate(); err != nil {
+		return Persona{}, err
+	}
+	return persona, nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// promptReloadInterval 检查系统提示文件是否修改的间隔
+const promptReloadInterval = 2 * time.Second
+
+// SessionVars 创建会话时传入的模板变量：来电者、语言区域和 CRM 等外部系统的字段
+type SessionVars struct {
+	// CallerID 来电号码或用户 ID
+	CallerID string
+	// Locale 来电者的语言区域，为空时使用人设的语言
+	Locale string
+	// Caller 来电者信息，如 name、phone
+	Caller map[string]string
+	// Fields 外部系统传入的字段，如 CRM 中的客户等级、最近订单
+	Fields map[string]any
+}
+
+// PromptVars 系统提示模板中可用的变量
+type PromptVars struct {
+	// Date 日期，如 2025-01-31
+	Date string
+	// Time 时间，如 14:05
+	Time string
+	// Weekday 星期，中文人设为“星期五”，其他为 Friday
+	Weekday   string
+	Now       time.Time
+	SessionID string
+	Persona   string
+	Language  string
+	Locale    string
+	CallerID  string
+	// Caller 来电者信息，未提供的键为空串
+	Caller map[string]string
+	// Fields 外部系统传入的字段，模板引用而未提供的键为空串
+	Fields map[string]any
+}
+
+// chineseWeekdays 中文星期
+var chineseWeekdays = [...]string{"星期日", "星期一", "星期二", "星期三", "星期四", "星期五", "星期六"}
+
+// newPromptVars 按当前时间、人设和会话变量生成模板变量
+func newPromptVars(now time.Time, persona Persona, sessionID string, vars SessionVars) PromptVars {
+	weekday := now.Weekday().String()
+	if isChineseLanguage(persona.Language) {
+		weekday = chineseWeekdays[now.Weekday()]
+	}
+	locale := vars.Locale
+	if locale == "" {
+		locale = persona.Language
+	}
+	caller := vars.Caller
+	if caller == nil {
+		caller = map[string]string{}
+	}
+	fields := vars.Fields
+	if fields == nil {
+		fields = map[string]any{}
+	}
+	return PromptVars{
+		Date:      now.Format("2006-01-02"),
+		Time:      now.Format("15:04"),
+		Weekday:   weekday,
+		Now:       now,
+		SessionID: sessionID,
+		Persona:   persona.Name,
+		Language:  persona.Language,
+		Locale:    locale,
+		CallerID:  vars.CallerID,
+		Caller:    caller,
+		Fields:    fields,
+	}
+}
+
+// promptFuncs 模板中可用的函数
+var promptFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	// default 值为空时使用默认值，如 {{.Fields.tier | default "普通"}}
+	"default": func(def, value any) any {
+		if value == nil || value == "" {
+			return def
+		}
+		return value
+	},
+}
+
+// parsePromptTemplate 解析系统提示模板，缺少的 Caller 键渲染为空串
+// Fields 的值是 any，缺少的键取零值 nil 会渲染为 "<no value>"，由 Render 按 templateFieldRefs 预先补齐
+func parsePromptTemplate(text string) (*template.Template, error) {
+	return template.New("system").Funcs(promptFuncs).Option("missingkey=zero").Parse(text)
+}
+
+// PromptTemplate 系统提示模板，来自人设中的文本或外部文件
+// 来自文件时 Reload 检查文件是否修改并重新加载，解析失败时继续使用上一版模板
+type PromptTemplate struct {
+	path string
+
+	mu   sync.Mutex
+	tmpl *template.Template
+	// fieldRefs 模板引用的 Fields 键路径，渲染时补齐缺少的键
+	fieldRefs []fieldRef
+	modTime   time.Time
+	size      int64
+}
+
+// NewPromptTemplate 解析模板文本
+func NewPromptTemplate(text string) (*PromptTemplate, error) {
+	tmpl, err := parsePromptTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+	return &PromptTemplate{tmpl: tmpl, fieldRefs: templateFieldRefs(tmpl)}, nil
+}
+
+// LoadPromptFile 读取并解析模板文件
+func LoadPromptFile(path string) (*PromptTemplate, error) {
+	p := &PromptTemplate{path: path}
+	if _, err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Path 模板文件路径，模板来自文本时为空
+func (p *PromptTemplate) Path() string {
+	return p.path
+}
+
+// Reload 模板文件修改过时重新加载，返回是否重新加载
+func (p *PromptTemplate) Reload() (bool, error) {
+	if p.path == "" {
+		return false, nil
+	}
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return false, fmt.Errorf("读取系统提示文件失败: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tmpl != nil && info.ModTime().Equal(p.modTime) && info.Size() == p.size {
+		return false, nil
+	}
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return false, fmt.Errorf("读取系统提示文件失败: %w", err)
+	}
+	// 先记下修改时间，解析失败的版本不会反复报错
+	p.modTime, p.size = info.ModTime(), info.Size()
+	tmpl, err := parsePromptTemplate(string(data))
+	if err != nil {
+		return false, fmt.Errorf("解析系统提示文件 %s 失败: %w", p.path, err)
+	}
+	p.tmpl, p.fieldRefs = tmpl, templateFieldRefs(tmpl)
+	return true, nil
+}
+
+// Render 用变量渲染模板
+func (p *PromptTemplate) Render(vars PromptVars) (string, error) {
+	p.mu.Lock()
+	tmpl, refs := p.tmpl, p.fieldRefs
+	p.mu.Unlock()
+
+	vars.Fields = fillMissingFields(vars.Fields, refs)
+	var b strings.Builder
+	if err := tmpl.Execute(&b, vars); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// WatchPrompt 定期检查当前人设的系统提示文件，修改后在对话空闲时换用新会话，让新提示生效
+// 级联模式每次回复都重新渲染，无需换会话
+func (va *VoiceAgent) WatchPrompt(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		prompt := va.promptTemplate()
+		reloaded, err := prompt.Reload()
+		if err != nil {
+			va.log().Warn("重新加载系统提示失败，继续使用上一版", "file", prompt.Path(), "error", err)
+			continue
+		}
+		if reloaded {
+			va.log().Info("系统提示文件已重新加载", "file", prompt.Path())
+			va.requestRenewal()
+		}
+	}
+}
+
+// LoadSessionFields 读取 JSON 对象文件作为模板的 Fields 变量
+func LoadSessionFields(path string) (map[string]any, error) {
+	fields := make(map[string]any)
+	if path == "" {
+		return fields, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取会话字段失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("解析会话字段失败: %w", err)
+	}
+	return fields, nil
+}
+
+// ParseCallerInfo 解析 "name=张三,phone=138..." 形式的来电者信息
+func ParseCallerInfo(spec string) (map[string]string, error) {
+	caller := make(map[string]string)
+	if strings.TrimSpace(spec) == "" {
+		return caller, nil
+	}
+	for _, field := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(field, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("无效的来电者信息 %q，应为 key=value", field)
+		}
+		caller[key] = strings.TrimSpace(value)
+	}
+	return caller, nil
+}
+
+// printSystemPrompt 按启动参数渲染系统提示并写入 out，用于检查模板（-print-prompt）
+func printSystemPrompt(out io.Writer, personas []Persona, name, voiceID, promptFile string, vars SessionVars) error {
+	persona, err := ResolvePersona(personas, name, voiceID, promptFile)
+	if err != nil {
+		return err
+	}
+	prompt, err := persona.PromptTemplate()
+	if err != nil {
+		return err
+	}
+	text, err := prompt.Render(newPromptVars(time.Now(), persona, "", vars))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "# 人设 %s，音色 %s，语言 %s\n%s\n", persona.Name, persona.VoiceID, persona.Language, text)
+	return nil
+}
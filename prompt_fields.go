@@ -0,0 +1,257 @@
+package main
+
+import (
+	"maps"
+	"text/template"
+	"text/template/parse"
+)
+
+// eachElement 键路径中表示“每个元素”的段，对应 range 的循环体
+const eachElement = "[]"
+
+// fieldRef 模板引用的 Fields 键路径
+// 前 guard 段由外层 with / range 确认存在，缺少时不补齐，以免让条件由假变真
+type fieldRef struct {
+	path  []string
+	guard int
+}
+
+// fieldDot 遍历模板时 dot 指向的位置：根变量 PromptVars、Fields 中的某个路径，或无法确定
+type fieldDot struct {
+	root   bool
+	fields bool
+	path   []string
+}
+
+// at 返回 with / range 内 dot 指向 Fields 中 ref 的上下文
+func (fieldDot) at(ref fieldRef) fieldDot {
+	return fieldDot{fields: true, path: ref.path}
+}
+
+// fieldRefCollector 收集模板引用的 Fields 键路径
+type fieldRefCollector struct {
+	refs []fieldRef
+}
+
+// templateFieldRefs 找出模板中引用的 .Fields 键路径，渲染前据此补齐缺少的键：
+//
+//	{{.Fields.order.id}} / {{$.Fields.order.id}}  [order id]
+//	{{with .Fields.order}}{{.id}}{{end}}           [order id]
+//	{{range .Fields.orders}}{{.id}}{{end}}         [orders [] id]
+//	{{index .Fields "tier"}}                       [tier]
+//
+// if / with / range 本身的条件不补齐，缺少时仍为假
+func templateFieldRefs(tmpl *template.Template) []fieldRef {
+	c := &fieldRefCollector{}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			c.walk(t.Tree.Root, fieldDot{root: true})
+		}
+	}
+	return c.refs
+}
+
+// add 记录一条路径，复制一份以免与 dot 共用底层数组
+func (c *fieldRefCollector) add(ref fieldRef) {
+	if len(ref.path) > 0 {
+		c.refs = append(c.refs, fieldRef{path: append([]string(nil), ref.path...), guard: ref.guard})
+	}
+}
+
+// walk 遍历节点，dot 为当前 dot 指向的位置
+func (c *fieldRefCollector) walk(node parse.Node, dot fieldDot) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			c.walk(child, dot)
+		}
+	case *parse.ActionNode:
+		c.walkPipe(n.Pipe, dot)
+	case *parse.IfNode:
+		c.walkCondition(n.Pipe, dot)
+		c.walk(n.List, dot)
+		c.walk(n.ElseList, dot)
+	case *parse.WithNode:
+		c.walkCondition(n.Pipe, dot)
+		inner := fieldDot{}
+		if ref, ok := c.resolvePipe(n.Pipe, dot); ok {
+			inner = dot.at(ref)
+		}
+		c.walk(n.List, inner)
+		c.walk(n.ElseList, dot)
+	case *parse.RangeNode:
+		c.walkCondition(n.Pipe, dot)
+		inner := fieldDot{}
+		if ref, ok := c.resolvePipe(n.Pipe, dot); ok {
+			ref.path = append(ref.path[:len(ref.path):len(ref.path)], eachElement)
+			inner = dot.at(ref)
+		}
+		c.walk(n.List, inner)
+		c.walk(n.ElseList, dot)
+	case *parse.TemplateNode:
+		c.walkPipe(n.Pipe, dot)
+	}
+}
+
+// walkCondition if / with / range 的条件：只是单个字段时不补齐，其余按普通管道处理
+func (c *fieldRefCollector) walkCondition(pipe *parse.PipeNode, dot fieldDot) {
+	if _, ok := c.resolvePipe(pipe, dot); ok {
+		return
+	}
+	c.walkPipe(pipe, dot)
+}
+
+// walkPipe 记录管道中各命令引用的字段
+func (c *fieldRefCollector) walkPipe(pipe *parse.PipeNode, dot fieldDot) {
+	if pipe == nil {
+		return
+	}
+	for _, cmd := range pipe.Cmds {
+		if ref, ok := c.resolveIndex(cmd, dot); ok {
+			c.add(ref)
+			continue
+		}
+		for _, arg := range cmd.Args {
+			if sub, ok := arg.(*parse.PipeNode); ok {
+				c.walkPipe(sub, dot)
+				continue
+			}
+			if ref, ok := c.resolve(arg, dot); ok {
+				c.add(ref)
+			}
+		}
+	}
+}
+
+// resolvePipe 管道只有一个命令且结果是 Fields 中的路径时返回该路径
+func (c *fieldRefCollector) resolvePipe(pipe *parse.PipeNode, dot fieldDot) (fieldRef, bool) {
+	if pipe == nil || len(pipe.Cmds) != 1 {
+		return fieldRef{}, false
+	}
+	cmd := pipe.Cmds[0]
+	if ref, ok := c.resolveIndex(cmd, dot); ok {
+		return ref, true
+	}
+	if len(cmd.Args) != 1 {
+		return fieldRef{}, false
+	}
+	if sub, ok := cmd.Args[0].(*parse.PipeNode); ok {
+		return c.resolvePipe(sub, dot)
+	}
+	return c.resolve(cmd.Args[0], dot)
+}
+
+// resolveIndex 解析 index <Fields 路径> "key" ...，数字下标按“每个元素”处理，其他参数无法确定
+func (c *fieldRefCollector) resolveIndex(cmd *parse.CommandNode, dot fieldDot) (fieldRef, bool) {
+	if len(cmd.Args) < 3 {
+		return fieldRef{}, false
+	}
+	if ident, ok := cmd.Args[0].(*parse.IdentifierNode); !ok || ident.Ident != "index" {
+		return fieldRef{}, false
+	}
+	ref, ok := c.resolve(cmd.Args[1], dot)
+	if !ok {
+		return fieldRef{}, false
+	}
+	ref.path = append([]string(nil), ref.path...)
+	for _, arg := range cmd.Args[2:] {
+		switch key := arg.(type) {
+		case *parse.StringNode:
+			ref.path = append(ref.path, key.Text)
+		case *parse.NumberNode:
+			ref.path = append(ref.path, eachElement)
+		default:
+			return fieldRef{}, false
+		}
+	}
+	return ref, true
+}
+
+// resolve 解析字段、$ 变量和 dot，结果在 Fields 中时返回路径（不含 Fields 本身）
+// 相对于 with / range 内 dot 的路径，dot 本身的部分不补齐
+func (c *fieldRefCollector) resolve(node parse.Node, dot fieldDot) (fieldRef, bool) {
+	var ident []string
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		ident = n.Ident
+	case *parse.VariableNode:
+		if n.Ident[0] != "$" {
+			return fieldRef{}, false
+		}
+		ident, dot = n.Ident[1:], fieldDot{root: true}
+	case *parse.DotNode:
+		if dot.fields && len(dot.path) > 0 {
+			return fieldRef{path: dot.path, guard: len(dot.path) - 1}, true
+		}
+		return fieldRef{}, false
+	default:
+		return fieldRef{}, false
+	}
+	switch {
+	case dot.fields:
+		return fieldRef{path: append(dot.path[:len(dot.path):len(dot.path)], ident...), guard: len(dot.path)}, true
+	case dot.root && len(ident) > 0 && ident[0] == "Fields":
+		return fieldRef{path: ident[1:]}, true
+	}
+	return fieldRef{}, false
+}
+
+// fillMissingFields 复制 fields，把模板引用而缺少（或为 null）的键补为空串，中间缺少的层级补为对象
+// 已有的非对象值不改动，原 map 不被修改
+func fillMissingFields(fields map[string]any, refs []fieldRef) map[string]any {
+	out := maps.Clone(fields)
+	if out == nil {
+		out = make(map[string]any)
+	}
+	for _, ref := range refs {
+		out = fillFieldPath(out, ref.path, ref.guard).(map[string]any)
+	}
+	return out
+}
+
+// fillFieldPath 返回补齐 path 后的 value 副本
+// guard 为 path 开头必须已经存在的段数，这些键缺少时原样返回；range 的元素总是补齐
+func fillFieldPath(value any, path []string, guard int) any {
+	if len(path) == 0 {
+		if value == nil {
+			return ""
+		}
+		return value
+	}
+	key, rest := path[0], path[1:]
+	if key == eachElement {
+		switch v := value.(type) {
+		case []any:
+			out := make([]any, len(v))
+			for i, elem := range v {
+				out[i] = fillFieldPath(elem, rest, guard-1)
+			}
+			return out
+		case map[string]any:
+			out := make(map[string]any, len(v))
+			for k, elem := range v {
+				out[k] = fillFieldPath(elem, rest, guard-1)
+			}
+			return out
+		}
+		return value
+	}
+	switch v := value.(type) {
+	case nil:
+		if guard > 0 {
+			return nil
+		}
+		return map[string]any{key: fillFieldPath(nil, rest, guard-1)}
+	case map[string]any:
+		if v[key] == nil && guard > 0 && len(rest) > 0 {
+			return value
+		}
+		out := maps.Clone(v)
+		out[key] = fillFieldPath(v[key], rest, guard-1)
+		return out
+	}
+	return value
+}
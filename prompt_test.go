@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPromptRenderMissingKeys(t *testing.T) {
+	persona := Persona{Name: "test", Language: "en-US"}
+	vars := SessionVars{
+		Caller: map[string]string{"name": "Alice"},
+		Fields: map[string]any{
+			"tier":   "gold",
+			"order":  map[string]any{"id": "A-1"},
+			"note":   nil,
+			"orders": []any{map[string]any{"id": "A-1", "status": "shipped"}, map[string]any{"id": "A-2"}, nil},
+		},
+	}
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"present", "{{.Caller.name}} {{.Fields.tier}} {{.Fields.order.id}}", "Alice gold A-1"},
+		{"missing caller", "[{{.Caller.phone}}]", "[]"},
+		{"missing field", "[{{.Fields.vip}}]", "[]"},
+		{"null field", "[{{.Fields.note}}]", "[]"},
+		{"missing nested", "[{{.Fields.order.status}}][{{.Fields.address.city}}]", "[][]"},
+		{"default", `{{.Fields.vip | default "normal"}} {{.Fields.tier | default "normal"}}`, "normal gold"},
+		{"if", "{{if .Fields.vip}}vip{{else}}regular{{end}}", "regular"},
+		{"root variable", "{{with .Caller.name}}{{.}} [{{$.Fields.vip}}]{{end}}", "Alice []"},
+		{"literal", "keep <no value> as written", "keep <no value> as written"},
+		{"with fields", "{{with .Fields}}{{.tier}}[{{.vip}}]{{end}}", "gold[]"},
+		{"with nested", "{{with .Fields.order}}{{.id}}[{{.status}}]{{end}}", "A-1[]"},
+		{"with missing", "{{with .Fields.address}}{{.city}}{{else}}none{{end}}", "none"},
+		{"index", `{{index .Fields "tier"}}[{{index .Fields "vip"}}][{{index .Fields "order" "status"}}]`, "gold[][]"},
+		{"index default", `{{index .Fields "vip" | default "normal"}}`, "normal"},
+		{"range", "{{range .Fields.orders}}{{.id}}:{{.status}};{{end}}", "A-1:shipped;A-2:;:;"},
+		{"range dot", "{{range .Fields.orders}}[{{.}}]{{end}}", "[map[id:A-1 status:shipped]][map[id:A-2]][]"},
+		{"range index", `{{range $i, $o := .Fields.orders}}{{index . "status"}};{{end}}`, "shipped;;;"},
+		{"range missing", "{{range .Fields.items}}{{.name}}{{else}}empty{{end}}", "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := NewPromptTemplate(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := tmpl.Render(newPromptVars(time.Now(), persona, "session_test", vars))
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+	if _, ok := vars.Fields["vip"]; ok {
+		t.Errorf("渲染修改了传入的 Fields")
+	}
+	if order := vars.Fields["order"].(map[string]any); len(order) != 1 {
+		t.Errorf("渲染修改了传入的嵌套字段: %v", order)
+	}
+	if orders := vars.Fields["orders"].([]any); orders[2] != nil {
+		t.Errorf("渲染修改了传入的列表: %v", orders)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ReconnectConfig 双向流断开后的重连策略
+type ReconnectConfig struct {
+	// InitialBackoff 第一次重连前的等待时间
+	InitialBackoff time.Duration
+	// MaxBackoff 等待时间上限
+	MaxBackoff time.Duration
+	// Multiplier 每次失败后等待时间的增长倍数
+	Multiplier float64
+	// Jitter 随机抖动比例（0-1），避免多个客户端同时重连
+	Jitter float64
+	// MaxAttempts 连续重连的最大次数，0 表示不限
+	MaxAttempts int
+}
+
+// DefaultReconnectConfig 默认重连策略
+func DefaultReconnectConfig() ReconnectConfig {
+	return ReconnectConfig{
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		MaxAttempts:    20,
+	}
+}
+
+// backoff 第 attempt 次（从 1 开始）重连前的等待时间
+func (c ReconnectConfig) backoff(attempt int) time.Duration {
+	delay := float64(c.InitialBackoff) * math.Pow(c.Multiplier, float64(attempt-1))
+	if delay > float64(c.MaxBackoff) {
+		delay = float64(c.MaxBackoff)
+	}
+	if c.Jitter > 0 {
+		delay *= 1 + c.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(delay)
+}
+
+// ErrCredentials 获取或使用 AWS 凭证失败，重连无法恢复
+var ErrCredentials = errors.New("AWS 凭证不可用")
+
+// fatalStreamErrors 重连也无法恢复的服务端错误
+var fatalStreamErrors = map[string]bool{
+	"AccessDeniedException":         true,
+	"ValidationException":           true,
+	"ResourceNotFoundException":     true,
+	"UnrecognizedClientException":   true,
+	"InvalidSignatureException":     true,
+	"ExpiredTokenException":         true,
+	"ServiceQuotaExceededException": true,
+}
+
+// retryableStreamErrors 可以通过重连恢复的服务端错误
+var retryableStreamErrors = map[string]bool{
+	"ThrottlingException":         true,
+	"ModelStreamErrorException":   true,
+	"ModelTimeoutException":       true,
+	"ServiceUnavailableException": true,
+	"InternalServerException":     true,
+	"ModelNotReadyException":      true,
+	"timeout":                     true,
+	"network":                     true,
+	"connection_closed":           true,
+}
+
+// isRetryableStreamError 判断流错误是否值得重连
+func isRetryableStreamError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrCredentials) {
+		return false
+	}
+
+	// 流内异常的事件名首字母小写（如 validationException），与 HTTP 错误类型统一后再查表
+	errType := bedrockErrorType(err)
+	if r, size := utf8.DecodeRuneInString(errType); unicode.IsLower(r) && strings.HasSuffix(errType, "Exception") {
+		errType = string(unicode.ToUpper(r)) + errType[size:]
+	}
+	if fatalStreamErrors[errType] {
+		return false
+	}
+	if retryableStreamErrors[errType] {
+		return true
+	}
+
+	var statusErr *StreamStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == 429 || statusErr.StatusCode >= 500
+	}
+	// 未识别的错误多为连接问题，交给 MaxAttempts 兜底
+	return true
+}
+
+// reconnectStream 按退避策略重新建立流，直到成功、遇到不可恢复的错误或超过最大次数
+// 新流会重放系统提示和最近的对话，对话上下文不会丢失
+func (va *VoiceAgent) reconnectStream(ctx context.Context, cause error) (*NovaSonicStream, error) {
+	va.playCue(reconnectCue)
+
+	for attempt := 1; ; attempt++ {
+		if va.reconnect.MaxAttempts > 0 && attempt > va.reconnect.MaxAttempts {
+			va.metrics.Reconnects.WithLabelValues("gave_up").Inc()
+			return nil, fmt.Errorf("重连 %d 次仍失败: %w", va.reconnect.MaxAttempts, cause)
+		}
+
+		delay := va.reconnect.backoff(attempt)
+		va.log().Warn("Sonic 连接中断，准备重连", "attempt", attempt, "delay", delay.Round(time.Millisecond), "error", cause)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		stream, err := va.openSonicStream(ctx)
+		if err == nil {
+			va.metrics.Reconnects.WithLabelValues("ok").Inc()
+			va.log().Info("Sonic 已重新连接", "attempt", attempt)
+			return stream, nil
+		}
+
+		va.metrics.Reconnects.WithLabelValues("failed").Inc()
+		va.publishError("stream", err)
+		if !isRetryableStreamError(err) {
+			return nil, err
+		}
+		cause = err
+	}
+}
+
+// handleStreamLoss 流意外中断时收尾当前轮次，未完成的回复不会再有后续
+func (va *VoiceAgent) handleStreamLoss(stream *NovaSonicStream, err error) {
+	turnTraceFrom(stream.currentTraceCtx()).Fail(err)
+	va.commitTurn(va.transcript.Flush(true))
+	va.turn.Reset("连接中断")
+	stream.Close()
+}
+
+// reconnectCue 重连提示音：两声短促的 660Hz 提示
+var reconnectCue = append(append(toneMulaw(660, 120*time.Millisecond, 0.25),
+	silenceMulaw(80*time.Millisecond)...), toneMulaw(660, 120*time.Millisecond, 0.25)...)
+
+// silenceMulaw 生成 8kHz mulaw 静音（mulaw 的零电平不是 0x00）
+func silenceMulaw(duration time.Duration) []byte {
+	return bytes.Repeat([]byte{linearToMulaw(0)}, int(duration.Seconds()*8000))
+}
+
+// toneMulaw 生成 8kHz mulaw 正弦提示音，首尾做淡入淡出避免爆音
+func toneMulaw(freq float64, duration time.Duration, volume float64) []byte {
+	n := int(duration.Seconds() * 8000)
+	fade := n / 10
+	out := make([]byte, n)
+	for i := range out {
+		amp := volume
+		if i < fade {
+			amp *= float64(i) / float64(fade)
+		} else if i >= n-fade {
+			amp *= float64(n-1-i) / float64(fade)
+		}
+		sample := amp * 32767 * math.Sin(2*math.Pi*freq*float64(i)/8000)
+		out[i] = linearToMulaw(int16(sample))
+	}
+	return out
+}
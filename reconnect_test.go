@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReconnectBackoff(t *testing.T) {
+	config := DefaultReconnectConfig()
+	config.Jitter = 0
+	want := []time.Duration{
+		500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second,
+		8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second,
+	}
+	for i, w := range want {
+		if got := config.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+
+	// 抖动在 ±Jitter 范围内，且确实会上下浮动
+	config = DefaultReconnectConfig()
+	for _, attempt := range []int{1, 4, 10} {
+		base := min(float64(config.InitialBackoff)*float64(int(1)<<(attempt-1)), float64(config.MaxBackoff))
+		lo, hi := base*(1-config.Jitter), base*(1+config.Jitter)
+		minSeen, maxSeen := hi, lo
+		for range 500 {
+			d := float64(config.backoff(attempt))
+			if d < lo || d > hi {
+				t.Fatalf("backoff(%d) = %v 超出 [%v, %v]", attempt, time.Duration(d), time.Duration(lo), time.Duration(hi))
+			}
+			minSeen, maxSeen = min(minSeen, d), max(maxSeen, d)
+		}
+		if minSeen > base*(1-config.Jitter/2) || maxSeen < base*(1+config.Jitter/2) {
+			t.Errorf("backoff(%d) 的抖动范围过窄: [%v, %v]", attempt, time.Duration(minSeen), time.Duration(maxSeen))
+		}
+	}
+}
+
+func TestIsRetryableStreamError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"限流", &StreamStatusError{StatusCode: 429, ErrorType: "ThrottlingException"}, true},
+		{"服务不可用", &StreamStatusError{StatusCode: 503}, true},
+		{"服务端内部错误", &StreamStatusError{StatusCode: 500, ErrorType: "InternalServerException"}, true},
+		{"参数错误", &StreamStatusError{StatusCode: 400, ErrorType: "ValidationException"}, false},
+		{"没有权限", &StreamStatusError{StatusCode: 403, ErrorType: "AccessDeniedException"}, false},
+		{"签名错误", &StreamStatusError{StatusCode: 403, ErrorType: "InvalidSignatureException"}, false},
+		{"未知的 4xx", &StreamStatusError{StatusCode: 404}, false},
+		{"流内模型错误", &StreamExceptionError{Type: "modelStreamErrorException"}, true},
+		{"流内限流", &StreamExceptionError{Type: "throttlingException"}, true},
+		{"流内参数错误", &StreamExceptionError{Type: "validationException"}, false},
+		{"包装后的参数错误", fmt.Errorf("启动流失败: %w", &StreamStatusError{StatusCode: 400, ErrorType: "ValidationException"}), false},
+		{"连接被关闭", fmt.Errorf("服务端关闭了连接: %w", io.EOF), true},
+		{"超时", context.DeadlineExceeded, true},
+		{"凭证不可用", fmt.Errorf("签名失败: %w", ErrCredentials), false},
+		{"主动取消", context.Canceled, false},
+		{"无错误", nil, false},
+	}
+	for _, tt := range tests {
+		if got := isRetryableStreamError(tt.err); got != tt.want {
+			t.Errorf("%s: isRetryableStreamError(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+// failingSonicServer 前 failures 次连接返回 status，之后交给 next 处理
+type failingSonicServer struct {
+	failures  int
+	status    int
+	errorType string
+	next      http.Handler
+
+	mu       sync.Mutex
+	attempts int
+}
+
+func (s *failingSonicServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.attempts++
+	fail := s.attempts <= s.failures
+	s.mu.Unlock()
+	if !fail {
+		s.next.ServeHTTP(w, r)
+		return
+	}
+	// 与真实服务一样不等请求体结束就返回错误
+	http.NewResponseController(w).EnableFullDuplex()
+	if s.errorType != "" {
+		w.Header().Set("X-Amzn-Errortype", s.errorType+":http://internal.amazon.com/coral/com.amazon.bedrock/")
+	}
+	http.Error(w, `{"message":"injected failure"}`, s.status)
+}
+
+func (s *failingSonicServer) Attempts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts
+}
+
+func TestReconnectStream(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		status    int
+		errorType string
+		// wantErr 重连最终失败
+		wantErr      bool
+		wantAttempts int
+		wantCounts   map[string]float64
+	}{
+		{
+			name:     "重试后成功",
+			failures: 2, status: http.StatusServiceUnavailable,
+			wantAttempts: 3,
+			wantCounts:   map[string]float64{"ok": 1, "failed": 2, "gave_up": 0},
+		},
+		{
+			name:     "超过最大次数后放弃",
+			failures: 100, status: http.StatusTooManyRequests, errorType: "ThrottlingException",
+			wantErr: true, wantAttempts: 3,
+			wantCounts: map[string]float64{"ok": 0, "failed": 3, "gave_up": 1},
+		},
+		{
+			name:     "不可恢复的错误不再重试",
+			failures: 100, status: http.StatusBadRequest, errorType: "ValidationException",
+			wantErr: true, wantAttempts: 1,
+			wantCounts: map[string]float64{"ok": 0, "failed": 1, "gave_up": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &failingSonicServer{
+				failures:  tt.failures,
+				status:    tt.status,
+				errorType: tt.errorType,
+				next:      &fakeSonicServer{limit: time.Minute},
+			}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			va := newTestAgent(t)
+			va.endpoint = ts.URL
+			va.reconnect = ReconnectConfig{
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     5 * time.Millisecond,
+				Multiplier:     2,
+				MaxAttempts:    3,
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			stream, err := va.reconnectStream(ctx, errors.New("连接中断"))
+			if stream != nil {
+				stream.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reconnectStream err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := server.Attempts(); got != tt.wantAttempts {
+				t.Errorf("连接了 %d 次, want %d", got, tt.wantAttempts)
+			}
+			for result, want := range tt.wantCounts {
+				if got := testutil.ToFloat64(va.metrics.Reconnects.WithLabelValues(result)); got != want {
+					t.Errorf("Reconnects{%s} = %v, want %v", result, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReconnectStreamCanceled(t *testing.T) {
+	va := newTestAgent(t)
+	va.endpoint = "http://127.0.0.1:1"
+	va.reconnect.InitialBackoff = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := va.reconnectStream(ctx, errors.New("连接中断")); !errors.Is(err, context.Canceled) {
+		t.Errorf("取消后 reconnectStream err = %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SessionRenewalConfig Sonic 会话续期配置
+// 单条双向流有最长时长限制，到期前打开新流接管音频输入，旧流处理完进行中的回复后关闭
+type SessionRenewalConfig struct {
+	// MaxSessionDuration 单条流的最长时长（Nova Sonic 为 8 分钟）
+	MaxSessionDuration time.Duration
+	// RenewBefore 到期前多久开始续期，只在对话空闲（Listening）时进行
+	RenewBefore time.Duration
+	// ForceBefore 到期前多久无论对话状态如何都强制续期
+	ForceBefore time.Duration
+	// HandoverGrace 切换后旧流最多保留多久，用于播完进行中的回复
+	HandoverGrace time.Duration
+}
+
+// DefaultSessionRenewalConfig 默认续期配置
+func DefaultSessionRenewalConfig() SessionRenewalConfig {
+	return SessionRenewalConfig{
+		MaxSessionDuration: 8 * time.Minute,
+		RenewBefore:        60 * time.Second,
+		ForceBefore:        15 * time.Second,
+		HandoverGrace:      10 * time.Second,
+	}
+}
+
+// normalize 补齐零值，并保证续期时间点落在会话时长之内（便于用很短的时长测试）
+func (c SessionRenewalConfig) normalize() SessionRenewalConfig {
+	def := DefaultSessionRenewalConfig()
+	if c.MaxSessionDuration <= 0 {
+		c.MaxSessionDuration = def.MaxSessionDuration
+	}
+	if c.RenewBefore <= 0 || c.RenewBefore >= c.MaxSessionDuration {
+		c.RenewBefore = min(def.RenewBefore, c.MaxSessionDuration/4)
+	}
+	if c.ForceBefore <= 0 || c.ForceBefore >= c.RenewBefore {
+		c.ForceBefore = min(def.ForceBefore, c.RenewBefore/2)
+	}
+	if c.HandoverGrace <= 0 {
+		c.HandoverGrace = def.HandoverGrace
+	}
+	return c
+}
+
+// renewalRetryInterval 未到强制续期时间且对话不空闲时，重新检查的间隔
+const renewalRetryInterval = time.Second
+
+// renewAt 流开始尝试续期的时间
+func (c SessionRenewalConfig) renewAt(openedAt time.Time) time.Time {
+	return openedAt.Add(c.MaxSessionDuration - c.RenewBefore)
+}
+
+// forceAt 流必须续期的时间
+func (c SessionRenewalConfig) forceAt(openedAt time.Time) time.Time {
+	return openedAt.Add(c.MaxSessionDuration - c.ForceBefore)
+}
+
+// retryDelay 暂不适合续期时下一次检查的间隔，不会错过强制续期时间
+func (c SessionRenewalConfig) retryDelay(openedAt, now time.Time) time.Duration {
+	return max(min(renewalRetryInterval, c.forceAt(openedAt).Sub(now)), 0)
+}
+
+// renewResult 后台打开新流的结果
+type renewResult struct {
+	stream *NovaSonicStream
+	err    error
+}
+
+// openSonicStream 创建并启动一条新流：初始化事件和响应读取线程
+func (va *VoiceAgent) openSonicStream(ctx context.Context) (*NovaSonicStream, error) {
+	stream, err := va.NewNovaSonicStream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("创建流失败: %w", err)
+	}
+
+	if err := stream.Start(ctx); err != nil {
+		stream.Close()
+		return nil, fmt.Errorf("启动流失败: %w", err)
+	}
+
+	// 启动响应读取线程，主动关闭的流不报告错误
+	go func() {
+		err := stream.ReadResponses(stream.ctx)
+		if stream.closed.Load() || stream.ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = fmt.Errorf("服务端关闭了连接: %w", io.EOF)
+		}
+		stream.log().Error("读取响应错误", "error", err)
+		va.publishError("stream", err)
+		stream.fail(err)
+	}()
+
+	stream.log().Info("Sonic 会话已建立", "expires_at", stream.openedAt.Add(va.renewal.MaxSessionDuration))
+	return stream, nil
+}
+
+// shouldRenew 判断当前是否适合续期：对话空闲，或已到强制续期时间
+func (va *VoiceAgent) shouldRenew(stream *NovaSonicStream, now time.Time) bool {
+	if !now.Before(va.renewal.forceAt(stream.openedAt)) {
+		return true
+	}
+	return va.turn.State() == TurnListening
+}
+
+// retireStream 等旧流进行中的回复结束（或宽限期到）后关闭
+func (va *VoiceAgent) retireStream(stream *NovaSonicStream) {
+	deadline := time.Now().Add(va.renewal.HandoverGrace)
+	if hard := stream.openedAt.Add(va.renewal.MaxSessionDuration); hard.Before(deadline) {
+		deadline = hard
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for time.Now().Before(deadline) {
+		state := va.turn.State()
+		if state != TurnWaitingModel && state != TurnAssistantSpeaking && state != TurnToolPending {
+			break
+		}
+		select {
+		case <-stream.ctx.Done():
+			deadline = time.Now()
+		case <-ticker.C:
+		}
+	}
+
+	stream.Close()
+	stream.log().Info("旧 Sonic 会话已关闭", "age", time.Since(stream.openedAt).Round(time.Second))
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newTestAgent 创建不依赖音频设备和 AWS 服务的代理
+func newTestAgent(t *testing.T) *VoiceAgent {
+	t.Helper()
+	persona := BuiltinPersonas()[0]
+	prompt, err := persona.PromptTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	playbackCtx, cancelPlayback := context.WithCancel(context.Background())
+	t.Cleanup(cancelPlayback)
+	return &VoiceAgent{
+		awsConfig: aws.Config{
+			Credentials: credentials.NewStaticCredentialsProvider("AKIDTEST", "SECRET", ""),
+		},
+		modelID:            "amazon.nova-sonic-v1:0",
+		region:             "us-east-1",
+		turn:               NewTurnStateMachine(),
+		events:             NewEventBus(),
+		logger:             slog.New(slog.DiscardHandler),
+		metrics:            NewMetrics(),
+		tools:              NewToolRegistry(),
+		renewal:            DefaultSessionRenewalConfig(),
+		reconnect:          DefaultReconnectConfig(),
+		historyTokenBudget: DefaultHistoryTokenBudget,
+		audioInputChan:     make(chan AudioChunk, 10),
+		textInputChan:      make(chan TextInput, 4),
+		audioOutputChan:    make(chan AudioChunk, 100),
+		interruptChan:      make(chan interruptSignal, 1),
+		cueChan:            make(chan []byte, 4),
+		renewChan:          make(chan struct{}, 1),
+		httpClient:         &http.Client{},
+		context:            &ConversationContext{SessionID: "session_test", StartTime: time.Now()},
+		summary:            DefaultSummaryConfig(),
+		persona:            persona,
+		prompt:             prompt,
+		personas:           BuiltinPersonas(),
+		playbackCtx:        playbackCtx,
+		cancelPlayback:     cancelPlayback,
+	}
+}
+
+// fakeSonicSession 模拟服务端的一条连接
+type fakeSonicSession struct {
+	openedAt time.Time
+	closedAt time.Time
+	events   []SonicInput
+	// ended 客户端发送了 sessionEnd
+	ended bool
+	// expired 连接超过时长限制，被服务端断开
+	expired bool
+}
+
+// fakeSonicServer 模拟 Sonic 双向流服务端：连接超过 limit 仍未结束时发送异常并断开，与真实服务的时长限制一致
+type fakeSonicServer struct {
+	limit time.Duration
+
+	mu       sync.Mutex
+	sessions []*fakeSonicSession
+}
+
+func (s *fakeSonicServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	if err := rc.EnableFullDuplex(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	session := &fakeSonicSession{openedAt: time.Now()}
+	s.mu.Lock()
+	s.sessions = append(s.sessions, session)
+	s.mu.Unlock()
+
+	ended := make(chan struct{})
+	go func() {
+		defer close(ended)
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			event, err := DecodeSonicInput(scanner.Bytes())
+			if err != nil {
+				continue
+			}
+			s.mu.Lock()
+			session.events = append(session.events, event)
+			if _, ok := event.(SessionEndEvent); ok {
+				session.ended = true
+			}
+			s.mu.Unlock()
+		}
+	}()
+
+	timer := time.NewTimer(s.limit)
+	defer timer.Stop()
+	select {
+	case <-ended:
+	case <-r.Context().Done():
+	case <-timer.C:
+		w.Write([]byte(`{"event":{"modelStreamErrorException":{"message":"session duration limit exceeded"}}}` + "\n"))
+		rc.Flush()
+		s.mu.Lock()
+		session.expired = true
+		s.mu.Unlock()
+	}
+	s.mu.Lock()
+	session.closedAt = time.Now()
+	s.mu.Unlock()
+}
+
+// snapshot 复制当前的连接记录
+func (s *fakeSonicServer) snapshot() []fakeSonicSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]fakeSonicSession, len(s.sessions))
+	for i, session := range s.sessions {
+		out[i] = *session
+		out[i].events = append([]SonicInput{}, session.events...)
+	}
+	return out
+}
+
+// waitFor 轮询直到 cond 成立或超时
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return cond()
+}
+
+func TestSessionRenewalBeforeServerLimit(t *testing.T) {
+	const limit = 2 * time.Second
+
+	tests := []struct {
+		name  string
+		state TurnState
+	}{
+		// 对话空闲时在 RenewBefore 续期
+		{"idle", TurnListening},
+		// 回复一直在播放时到 ForceBefore 强制续期，旧流在时长限制前关闭
+		{"busy", TurnAssistantSpeaking},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fakeSonicServer{limit: limit}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			va := newTestAgent(t)
+			va.endpoint = ts.URL
+			va.renewal = SessionRenewalConfig{
+				MaxSessionDuration: limit,
+				RenewBefore:        800 * time.Millisecond,
+				ForceBefore:        400 * time.Millisecond,
+				HandoverGrace:      200 * time.Millisecond,
+			}.normalize()
+			va.appendMessage(ConversationMessage{Role: RoleUser, Text: "我叫小明"})
+			va.transitionTurn(tt.state, "测试")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- va.StreamAudioToNova(ctx, nil) }()
+
+			renewed := waitFor(t, 2*limit, func() bool {
+				sessions := server.snapshot()
+				return len(sessions) >= 2 && !sessions[0].closedAt.IsZero()
+			})
+			cancel()
+			<-done
+			if !renewed {
+				t.Fatalf("会话没有在时长限制内续期: %d 条连接", len(server.snapshot()))
+			}
+
+			sessions := server.snapshot()
+			first, second := sessions[0], sessions[1]
+			if first.expired || !first.ended {
+				t.Errorf("旧连接应由客户端正常结束: expired=%v ended=%v", first.expired, first.ended)
+			}
+			if age := first.closedAt.Sub(first.openedAt); age >= limit {
+				t.Errorf("旧连接存活 %v，超过了服务端限制 %v", age, limit)
+			}
+			if !second.openedAt.Before(first.openedAt.Add(limit)) {
+				t.Errorf("新连接在旧连接到期后才建立")
+			}
+			if got := testutil.ToFloat64(va.metrics.SessionRenewals.WithLabelValues("ok")); got < 1 {
+				t.Errorf("SessionRenewals{ok} = %v, want >= 1", got)
+			}
+
+			// 新会话重新发送初始化事件并重放对话历史
+			if len(second.events) < 2 {
+				t.Fatalf("新连接只收到 %d 个事件", len(second.events))
+			}
+			if _, ok := second.events[0].(SessionStartEvent); !ok {
+				t.Errorf("第一个事件应为 sessionStart，实际 %s", second.events[0].InputType())
+			}
+			if _, ok := second.events[1].(PromptStartEvent); !ok {
+				t.Errorf("第二个事件应为 promptStart，实际 %s", second.events[1].InputType())
+			}
+			replayed := false
+			for _, event := range second.events {
+				if text, ok := event.(TextInputEvent); ok && text.Content == "我叫小明" {
+					replayed = true
+				}
+			}
+			if !replayed {
+				t.Errorf("新会话没有重放对话历史")
+			}
+		})
+	}
+}
@@ -0,0 +1,564 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Nova Sonic 双向流事件模型
+// 每个事件在线路上的格式都是 {"event": {"<类型>": {...}}}，
+// 这里用 SonicInput / SonicOutput 两个接口表示输入、输出事件的联合类型，
+// 由 MarshalSonicInput / DecodeSonicInput / MarshalSonicOutput / DecodeSonicOutput 负责编解码
+
+// 内容类型
+const (
+	ContentTypeText  = "TEXT"
+	ContentTypeAudio = "AUDIO"
+	ContentTypeTool  = "TOOL"
+)
+
+// 内容角色
+const (
+	SonicRoleSystem    = "SYSTEM"
+	SonicRoleUser      = "USER"
+	SonicRoleAssistant = "ASSISTANT"
+	SonicRoleTool      = "TOOL"
+)
+
+// contentEnd / completionEnd 的 stopReason
+const (
+	StopReasonPartialTurn = "PARTIAL_TURN"
+	StopReasonEndTurn     = "END_TURN"
+	StopReasonInterrupted = "INTERRUPTED"
+	StopReasonToolUse     = "TOOL_USE"
+)
+
+// contentStart.additionalModelFields 中的 generationStage
+const (
+	GenerationStageSpeculative = "SPECULATIVE"
+	GenerationStageFinal       = "FINAL"
+)
+
+// ErrInvalidSonicEvent 事件结构不合法
+var ErrInvalidSonicEvent = errors.New("无效的 Sonic 事件")
+
+// ---- 输入事件 ----
+
+// SonicInput 发送给 Nova Sonic 的事件
+type SonicInput interface {
+	// InputType 事件类型名，如 "sessionStart"
+	InputType() string
+	// Validate 校验必填字段
+	Validate() error
+}
+
+// InferenceConfiguration 推理参数
+type InferenceConfiguration struct {
+	MaxTokens   int     `json:"maxTokens"`
+	TopP        float64 `json:"topP"`
+	Temperature float64 `json:"temperature"`
+}
+
+// SessionStartEvent sessionStart
+type SessionStartEvent struct {
+	InferenceConfiguration InferenceConfiguration `json:"inferenceConfiguration"`
+}
+
+// MediaTypeConfiguration 只包含 mediaType 的配置
+type MediaTypeConfiguration struct {
+	MediaType string `json:"mediaType"`
+}
+
+// AudioOutputConfiguration 音频输出配置
+type AudioOutputConfiguration struct {
+	MediaType       string `json:"mediaType"`
+	SampleRateHertz int    `json:"sampleRateHertz"`
+	SampleSizeBits  int    `json:"sampleSizeBits"`
+	ChannelCount    int    `json:"channelCount"`
+	VoiceID         string `json:"voiceId"`
+	Encoding        string `json:"encoding"`
+	AudioType       string `json:"audioType"`
+}
+
+// ToolInputSchema 工具输入的 JSON Schema（以字符串形式传递）
+type ToolInputSchema struct {
+	JSON string `json:"json"`
+}
+
+// ToolSpec 工具定义
+type ToolSpec struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema ToolInputSchema `json:"inputSchema"`
+}
+
+// ToolDefinition tools 数组中的元素
+type ToolDefinition struct {
+	ToolSpec ToolSpec `json:"toolSpec"`
+}
+
+// ToolConfiguration 可用工具列表
+type ToolConfiguration struct {
+	Tools []ToolDefinition `json:"tools"`
+}
+
+// PromptStartEvent promptStart
+type PromptStartEvent struct {
+	PromptName                 string                    `json:"promptName"`
+	TextOutputConfiguration    *MediaTypeConfiguration   `json:"textOutputConfiguration,omitempty"`
+	AudioOutputConfiguration   *AudioOutputConfiguration `json:"audioOutputConfiguration,omitempty"`
+	ToolUseOutputConfiguration *MediaTypeConfiguration   `json:"toolUseOutputConfiguration,omitempty"`
+	ToolConfiguration          *ToolConfiguration        `json:"toolConfiguration,omitempty"`
+}
+
+// AudioInputConfiguration 音频输入配置
+type AudioInputConfiguration struct {
+	MediaType       string `json:"mediaType"`
+	SampleRateHertz int    `json:"sampleRateHertz"`
+	SampleSizeBits  int    `json:"sampleSizeBits"`
+	ChannelCount    int    `json:"channelCount"`
+	AudioType       string `json:"audioType"`
+	Encoding        string `json:"encoding"`
+}
+
+// ToolResultInputConfiguration 工具结果输入配置
+type ToolResultInputConfiguration struct {
+	ToolUseID              string                 `json:"toolUseId"`
+	Type                   string                 `json:"type"`
+	TextInputConfiguration MediaTypeConfiguration `json:"textInputConfiguration"`
+}
+
+// ContentStartEvent 输入侧 contentStart
+type ContentStartEvent struct {
+	PromptName                   string                        `json:"promptName"`
+	ContentName                  string                        `json:"contentName"`
+	Type                         string                        `json:"type"`
+	Interactive                  bool                          `json:"interactive"`
+	Role                         string                        `json:"role"`
+	TextInputConfiguration       *MediaTypeConfiguration       `json:"textInputConfiguration,omitempty"`
+	AudioInputConfiguration      *AudioInputConfiguration      `json:"audioInputConfiguration,omitempty"`
+	ToolResultInputConfiguration *ToolResultInputConfiguration `json:"toolResultInputConfiguration,omitempty"`
+}
+
+// AudioInputEvent audioInput，Content 为 base64 编码的音频
+type AudioInputEvent struct {
+	PromptName  string `json:"promptName"`
+	ContentName string `json:"contentName"`
+	Content     string `json:"content"`
+}
+
+// TextInputEvent textInput
+type TextInputEvent struct {
+	PromptName  string `json:"promptName"`
+	ContentName string `json:"contentName"`
+	Content     string `json:"content"`
+}
+
+// ToolResultEvent toolResult，Content 为 JSON 字符串
+type ToolResultEvent struct {
+	PromptName  string `json:"promptName"`
+	ContentName string `json:"contentName"`
+	Content     string `json:"content"`
+}
+
+// ContentEndEvent 输入侧 contentEnd
+type ContentEndEvent struct {
+	PromptName  string `json:"promptName"`
+	ContentName string `json:"contentName"`
+}
+
+// PromptEndEvent promptEnd
+type PromptEndEvent struct {
+	PromptName string `json:"promptName"`
+}
+
+// SessionEndEvent sessionEnd
+type SessionEndEvent struct{}
+
+func (SessionStartEvent) InputType() string { return "sessionStart" }
+func (PromptStartEvent) InputType() string  { return "promptStart" }
+func (ContentStartEvent) InputType() string { return "contentStart" }
+func (AudioInputEvent) InputType() string   { return "audioInput" }
+func (TextInputEvent) InputType() string    { return "textInput" }
+func (ToolResultEvent) InputType() string   { return "toolResult" }
+func (ContentEndEvent) InputType() string   { return "contentEnd" }
+func (PromptEndEvent) InputType() string    { return "promptEnd" }
+func (SessionEndEvent) InputType() string   { return "sessionEnd" }
+
+// invalidf 构造带事件类型的校验错误
+func invalidf(eventType, format string, args ...interface{}) error {
+	return fmt.Errorf("%w %s: %s", ErrInvalidSonicEvent, eventType, fmt.Sprintf(format, args...))
+}
+
+// Validate 校验 sessionStart
+func (e SessionStartEvent) Validate() error {
+	c := e.InferenceConfiguration
+	if c.MaxTokens <= 0 {
+		return invalidf(e.InputType(), "maxTokens 必须大于 0")
+	}
+	if c.TopP < 0 || c.TopP > 1 {
+		return invalidf(e.InputType(), "topP 超出范围 [0, 1]: %v", c.TopP)
+	}
+	if c.Temperature < 0 || c.Temperature > 1 {
+		return invalidf(e.InputType(), "temperature 超出范围 [0, 1]: %v", c.Temperature)
+	}
+	return nil
+}
+
+// Validate 校验 promptStart
+func (e PromptStartEvent) Validate() error {
+	if e.PromptName == "" {
+		return invalidf(e.InputType(), "缺少 promptName")
+	}
+	if a := e.AudioOutputConfiguration; a != nil {
+		switch a.SampleRateHertz {
+		case 8000, 16000, 24000:
+		default:
+			return invalidf(e.InputType(), "不支持的输出采样率 %d", a.SampleRateHertz)
+		}
+		if a.VoiceID == "" {
+			return invalidf(e.InputType(), "缺少 voiceId")
+		}
+	}
+	if t := e.ToolConfiguration; t != nil {
+		for _, tool := range t.Tools {
+			if tool.ToolSpec.Name == "" {
+				return invalidf(e.InputType(), "工具缺少 name")
+			}
+		}
+	}
+	return nil
+}
+
+// Validate 校验 contentStart，配置必须与内容类型匹配
+func (e ContentStartEvent) Validate() error {
+	if e.PromptName == "" || e.ContentName == "" {
+		return invalidf(e.InputType(), "缺少 promptName 或 contentName")
+	}
+	switch e.Role {
+	case SonicRoleSystem, SonicRoleUser, SonicRoleAssistant, SonicRoleTool:
+	default:
+		return invalidf(e.InputType(), "无效的 role %q", e.Role)
+	}
+	switch e.Type {
+	case ContentTypeText:
+		if e.TextInputConfiguration == nil {
+			return invalidf(e.InputType(), "TEXT 内容缺少 textInputConfiguration")
+		}
+	case ContentTypeAudio:
+		if e.AudioInputConfiguration == nil {
+			return invalidf(e.InputType(), "AUDIO 内容缺少 audioInputConfiguration")
+		}
+	case ContentTypeTool:
+		if e.ToolResultInputConfiguration == nil || e.ToolResultInputConfiguration.ToolUseID == "" {
+			return invalidf(e.InputType(), "TOOL 内容缺少 toolResultInputConfiguration.toolUseId")
+		}
+	default:
+		return invalidf(e.InputType(), "无效的 type %q", e.Type)
+	}
+	return nil
+}
+
+// Validate 校验 audioInput
+func (e AudioInputEvent) Validate() error {
+	if e.PromptName == "" || e.ContentName == "" {
+		return invalidf(e.InputType(), "缺少 promptName 或 contentName")
+	}
+	if e.Content == "" {
+		return invalidf(e.InputType(), "content 为空")
+	}
+	return nil
+}
+
+// Validate 校验 textInput
+func (e TextInputEvent) Validate() error {
+	if e.PromptName == "" || e.ContentName == "" {
+		return invalidf(e.InputType(), "缺少 promptName 或 contentName")
+	}
+	if e.Content == "" {
+		return invalidf(e.InputType(), "content 为空")
+	}
+	return nil
+}
+
+// Validate 校验 toolResult
+func (e ToolResultEvent) Validate() error {
+	if e.PromptName == "" || e.ContentName == "" {
+		return invalidf(e.InputType(), "缺少 promptName 或 contentName")
+	}
+	if !json.Valid([]byte(e.Content)) {
+		return invalidf(e.InputType(), "content 不是合法的 JSON")
+	}
+	return nil
+}
+
+// Validate 校验 contentEnd
+func (e ContentEndEvent) Validate() error {
+	if e.PromptName == "" || e.ContentName == "" {
+		return invalidf(e.InputType(), "缺少 promptName 或 contentName")
+	}
+	return nil
+}
+
+// Validate 校验 promptEnd
+func (e PromptEndEvent) Validate() error {
+	if e.PromptName == "" {
+		return invalidf(e.InputType(), "缺少 promptName")
+	}
+	return nil
+}
+
+// Validate sessionEnd 没有字段
+func (e SessionEndEvent) Validate() error {
+	return nil
+}
+
+// MarshalSonicInput 校验并编码输入事件
+func MarshalSonicInput(event SonicInput) ([]byte, error) {
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+	return marshalEnvelope(event.InputType(), event)
+}
+
+// DecodeSonicInput 解码输入事件（用于测试和本地模拟服务端）
+func DecodeSonicInput(data []byte) (SonicInput, error) {
+	eventType, body, err := unmarshalEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var event SonicInput
+	switch eventType {
+	case "sessionStart":
+		event, err = decodeBody[SessionStartEvent](body)
+	case "promptStart":
+		event, err = decodeBody[PromptStartEvent](body)
+	case "contentStart":
+		event, err = decodeBody[ContentStartEvent](body)
+	case "audioInput":
+		event, err = decodeBody[AudioInputEvent](body)
+	case "textInput":
+		event, err = decodeBody[TextInputEvent](body)
+	case "toolResult":
+		event, err = decodeBody[ToolResultEvent](body)
+	case "contentEnd":
+		event, err = decodeBody[ContentEndEvent](body)
+	case "promptEnd":
+		event, err = decodeBody[PromptEndEvent](body)
+	case "sessionEnd":
+		event, err = decodeBody[SessionEndEvent](body)
+	default:
+		return nil, fmt.Errorf("%w: 未知的输入事件类型 %q", ErrInvalidSonicEvent, eventType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解码 %s 失败: %w", eventType, err)
+	}
+	return event, event.Validate()
+}
+
+// ---- 输出事件 ----
+
+// SonicOutput Nova Sonic 返回的事件
+type SonicOutput interface {
+	// OutputType 事件类型名，如 "textOutput"
+	OutputType() string
+}
+
+// outputIDs 输出事件共有的标识字段
+type outputIDs struct {
+	SessionID    string `json:"sessionId,omitempty"`
+	PromptName   string `json:"promptName,omitempty"`
+	CompletionID string `json:"completionId,omitempty"`
+}
+
+// CompletionStartEvent completionStart
+type CompletionStartEvent struct {
+	outputIDs
+}
+
+// OutputContentStartEvent 输出侧 contentStart
+type OutputContentStartEvent struct {
+	outputIDs
+	ContentID string `json:"contentId"`
+	Type      string `json:"type"`
+	Role      string `json:"role"`
+	// AdditionalModelFields JSON 字符串，如 {"generationStage":"SPECULATIVE"}
+	AdditionalModelFields      string                    `json:"additionalModelFields,omitempty"`
+	TextOutputConfiguration    *MediaTypeConfiguration   `json:"textOutputConfiguration,omitempty"`
+	AudioOutputConfiguration   *AudioOutputConfiguration `json:"audioOutputConfiguration,omitempty"`
+	ToolUseOutputConfiguration *MediaTypeConfiguration   `json:"toolUseOutputConfiguration,omitempty"`
+}
+
+// GenerationStage 解析 additionalModelFields 中的 generationStage，缺省为空
+func (e OutputContentStartEvent) GenerationStage() string {
+	if e.AdditionalModelFields == "" {
+		return ""
+	}
+	var fields struct {
+		GenerationStage string `json:"generationStage"`
+	}
+	if err := json.Unmarshal([]byte(e.AdditionalModelFields), &fields); err != nil {
+		return ""
+	}
+	return fields.GenerationStage
+}
+
+// TextOutputEvent textOutput
+type TextOutputEvent struct {
+	outputIDs
+	ContentID string `json:"contentId"`
+	Role      string `json:"role"`
+	Content   string `json:"content"`
+}
+
+// AudioOutputEvent audioOutput，Content 为 base64 编码的 24kHz PCM
+type AudioOutputEvent struct {
+	outputIDs
+	ContentID string `json:"contentId"`
+	Role      string `json:"role,omitempty"`
+	Content   string `json:"content"`
+}
+
+// ToolUseEvent toolUse，Content 为工具输入的 JSON 字符串
+type ToolUseEvent struct {
+	outputIDs
+	ContentID string `json:"contentId"`
+	Role      string `json:"role,omitempty"`
+	ToolName  string `json:"toolName"`
+	ToolUseID string `json:"toolUseId"`
+	Content   string `json:"content"`
+}
+
+// OutputContentEndEvent 输出侧 contentEnd
+type OutputContentEndEvent struct {
+	outputIDs
+	ContentID  string `json:"contentId"`
+	Type       string `json:"type"`
+	StopReason string `json:"stopReason"`
+}
+
+// CompletionEndEvent completionEnd
+type CompletionEndEvent struct {
+	outputIDs
+	StopReason string `json:"stopReason"`
+}
+
+// TokenCounts 语音/文本 token 数
+type TokenCounts struct {
+	SpeechTokens int `json:"speechTokens"`
+	TextTokens   int `json:"textTokens"`
+}
+
+// TokenUsage 输入/输出 token 数
+type TokenUsage struct {
+	Input  TokenCounts `json:"input"`
+	Output TokenCounts `json:"output"`
+}
+
+// UsageDetails 本次增量和累计用量
+type UsageDetails struct {
+	Delta TokenUsage `json:"delta"`
+	Total TokenUsage `json:"total"`
+}
+
+// UsageEvent usageEvent
+type UsageEvent struct {
+	outputIDs
+	Details           UsageDetails `json:"details"`
+	TotalInputTokens  int          `json:"totalInputTokens"`
+	TotalOutputTokens int          `json:"totalOutputTokens"`
+	TotalTokens       int          `json:"totalTokens"`
+}
+
+// UnknownOutputEvent 未识别的输出事件，保留原始内容
+type UnknownOutputEvent struct {
+	Type string
+	Raw  json.RawMessage
+}
+
+func (CompletionStartEvent) OutputType() string    { return "completionStart" }
+func (OutputContentStartEvent) OutputType() string { return "contentStart" }
+func (TextOutputEvent) OutputType() string         { return "textOutput" }
+func (AudioOutputEvent) OutputType() string        { return "audioOutput" }
+func (ToolUseEvent) OutputType() string            { return "toolUse" }
+func (OutputContentEndEvent) OutputType() string   { return "contentEnd" }
+func (CompletionEndEvent) OutputType() string      { return "completionEnd" }
+func (UsageEvent) OutputType() string              { return "usageEvent" }
+func (e UnknownOutputEvent) OutputType() string    { return e.Type }
+
+// MarshalSonicOutput 编码输出事件（用于测试和本地模拟服务端）
+func MarshalSonicOutput(event SonicOutput) ([]byte, error) {
+	if unknown, ok := event.(UnknownOutputEvent); ok {
+		return marshalEnvelope(unknown.Type, unknown.Raw)
+	}
+	return marshalEnvelope(event.OutputType(), event)
+}
+
+// DecodeSonicOutput 解码输出事件，未知类型返回 UnknownOutputEvent
+func DecodeSonicOutput(data []byte) (SonicOutput, error) {
+	eventType, body, err := unmarshalEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var event SonicOutput
+	switch eventType {
+	case "completionStart":
+		event, err = decodeBody[CompletionStartEvent](body)
+	case "contentStart":
+		event, err = decodeBody[OutputContentStartEvent](body)
+	case "textOutput":
+		event, err = decodeBody[TextOutputEvent](body)
+	case "audioOutput":
+		event, err = decodeBody[AudioOutputEvent](body)
+	case "toolUse":
+		event, err = decodeBody[ToolUseEvent](body)
+	case "contentEnd":
+		event, err = decodeBody[OutputContentEndEvent](body)
+	case "completionEnd":
+		event, err = decodeBody[CompletionEndEvent](body)
+	case "usageEvent":
+		event, err = decodeBody[UsageEvent](body)
+	default:
+		return UnknownOutputEvent{Type: eventType, Raw: body}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解码 %s 失败: %w", eventType, err)
+	}
+	return event, nil
+}
+
+// ---- 信封编解码 ----
+
+// marshalEnvelope 编码为 {"event": {"<eventType>": body}}
+func marshalEnvelope(eventType string, body interface{}) ([]byte, error) {
+	return json.Marshal(map[string]map[string]interface{}{
+		"event": {eventType: body},
+	})
+}
+
+// unmarshalEnvelope 解析信封，要求 event 下恰好有一个事件类型
+func unmarshalEnvelope(data []byte) (string, json.RawMessage, error) {
+	var envelope struct {
+		Event map[string]json.RawMessage `json:"event"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidSonicEvent, err)
+	}
+	if len(envelope.Event) != 1 {
+		return "", nil, fmt.Errorf("%w: event 下应恰好有一个事件，实际 %d 个", ErrInvalidSonicEvent, len(envelope.Event))
+	}
+	for eventType, body := range envelope.Event {
+		return eventType, body, nil
+	}
+	return "", nil, nil
+}
+
+// decodeBody 将事件体解码为具体类型
+func decodeBody[T any](body json.RawMessage) (T, error) {
+	var event T
+	err := json.Unmarshal(body, &event)
+	return event, err
+}
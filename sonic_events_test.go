@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSonicInputRoundTrip(t *testing.T) {
+	events := []SonicInput{
+		SessionStartEvent{InferenceConfiguration: DefaultInference()},
+		PromptStartEvent{
+			PromptName:              "prompt-1",
+			TextOutputConfiguration: &MediaTypeConfiguration{MediaType: "text/plain"},
+			AudioOutputConfiguration: &AudioOutputConfiguration{
+				MediaType:       "audio/lpcm",
+				SampleRateHertz: 24000,
+				SampleSizeBits:  16,
+				ChannelCount:    1,
+				VoiceID:         "matthew",
+				Encoding:        "base64",
+				AudioType:       "SPEECH",
+			},
+			ToolConfiguration: &ToolConfiguration{Tools: []ToolDefinition{
+				{ToolSpec: ToolSpec{Name: "get_time", Description: "当前时间", InputSchema: ToolInputSchema{JSON: `{"type":"object"}`}}},
+			}},
+		},
+		ContentStartEvent{
+			PromptName:             "prompt-1",
+			ContentName:            "system-1",
+			Type:                   ContentTypeText,
+			Role:                   SonicRoleSystem,
+			TextInputConfiguration: &MediaTypeConfiguration{MediaType: "text/plain"},
+		},
+		TextInputEvent{PromptName: "prompt-1", ContentName: "system-1", Content: "你是一个友好的助手"},
+		AudioInputEvent{PromptName: "prompt-1", ContentName: "audio-1", Content: "AAAA"},
+		ContentStartEvent{
+			PromptName:  "prompt-1",
+			ContentName: "tool-1",
+			Type:        ContentTypeTool,
+			Interactive: false,
+			Role:        SonicRoleTool,
+			ToolResultInputConfiguration: &ToolResultInputConfiguration{
+				ToolUseID:              "use-1",
+				Type:                   ContentTypeText,
+				TextInputConfiguration: MediaTypeConfiguration{MediaType: "text/plain"},
+			},
+		},
+		ToolResultEvent{PromptName: "prompt-1", ContentName: "tool-1", Content: `{"time":"10:00"}`},
+		ContentEndEvent{PromptName: "prompt-1", ContentName: "tool-1"},
+		PromptEndEvent{PromptName: "prompt-1"},
+		SessionEndEvent{},
+	}
+
+	for _, event := range events {
+		t.Run(event.InputType(), func(t *testing.T) {
+			data, err := MarshalSonicInput(event)
+			if err != nil {
+				t.Fatalf("MarshalSonicInput: %v", err)
+			}
+			decoded, err := DecodeSonicInput(data)
+			if err != nil {
+				t.Fatalf("DecodeSonicInput(%s): %v", data, err)
+			}
+			if !reflect.DeepEqual(decoded, event) {
+				t.Errorf("往返结果不一致\n got: %#v\nwant: %#v", decoded, event)
+			}
+		})
+	}
+}
+
+func TestSonicInputValidation(t *testing.T) {
+	invalid := []SonicInput{
+		SessionStartEvent{InferenceConfiguration: InferenceConfiguration{MaxTokens: 0, TopP: 0.9}},
+		PromptStartEvent{},
+		PromptStartEvent{PromptName: "p", AudioOutputConfiguration: &AudioOutputConfiguration{SampleRateHertz: 44100, VoiceID: "matthew"}},
+		ContentStartEvent{PromptName: "p", ContentName: "c", Type: ContentTypeAudio, Role: SonicRoleUser},
+		ContentStartEvent{PromptName: "p", ContentName: "c", Type: ContentTypeText, Role: "BOT", TextInputConfiguration: &MediaTypeConfiguration{}},
+		TextInputEvent{PromptName: "p", ContentName: "c"},
+		ToolResultEvent{PromptName: "p", ContentName: "c", Content: "not json"},
+	}
+	for _, event := range invalid {
+		if _, err := MarshalSonicInput(event); !errors.Is(err, ErrInvalidSonicEvent) {
+			t.Errorf("MarshalSonicInput(%#v) = %v, want ErrInvalidSonicEvent", event, err)
+		}
+	}
+
+	// 解码时同样校验，服务端模拟不会接受非法事件
+	data, err := marshalEnvelope("textInput", TextInputEvent{PromptName: "p", ContentName: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeSonicInput(data); !errors.Is(err, ErrInvalidSonicEvent) {
+		t.Errorf("DecodeSonicInput 非法事件 = %v, want ErrInvalidSonicEvent", err)
+	}
+	for _, data := range []string{`{"event":{}}`, `{"event":{"bogus":{}}}`, `not json`} {
+		if _, err := DecodeSonicInput([]byte(data)); !errors.Is(err, ErrInvalidSonicEvent) {
+			t.Errorf("DecodeSonicInput(%s) = %v, want ErrInvalidSonicEvent", data, err)
+		}
+	}
+}
+
+func TestSonicOutputRoundTrip(t *testing.T) {
+	ids := outputIDs{SessionID: "s-1", PromptName: "prompt-1", CompletionID: "c-1"}
+	events := []SonicOutput{
+		CompletionStartEvent{outputIDs: ids},
+		OutputContentStartEvent{
+			outputIDs:               ids,
+			ContentID:               "content-1",
+			Type:                    ContentTypeText,
+			Role:                    SonicRoleAssistant,
+			AdditionalModelFields:   `{"generationStage":"SPECULATIVE"}`,
+			TextOutputConfiguration: &MediaTypeConfiguration{MediaType: "text/plain"},
+		},
+		TextOutputEvent{outputIDs: ids, ContentID: "content-1", Role: SonicRoleAssistant, Content: "你好"},
+		AudioOutputEvent{outputIDs: ids, ContentID: "content-2", Content: "AAAA"},
+		ToolUseEvent{outputIDs: ids, ContentID: "content-3", ToolName: "get_time", ToolUseID: "use-1", Content: `{}`},
+		OutputContentEndEvent{outputIDs: ids, ContentID: "content-1", Type: ContentTypeText, StopReason: StopReasonInterrupted},
+		CompletionEndEvent{outputIDs: ids, StopReason: StopReasonEndTurn},
+		UsageEvent{
+			outputIDs: ids,
+			Details: UsageDetails{
+				Delta: TokenUsage{Input: TokenCounts{SpeechTokens: 10}, Output: TokenCounts{TextTokens: 3}},
+				Total: TokenUsage{Input: TokenCounts{SpeechTokens: 20, TextTokens: 5}, Output: TokenCounts{SpeechTokens: 7, TextTokens: 3}},
+			},
+			TotalInputTokens:  25,
+			TotalOutputTokens: 10,
+			TotalTokens:       35,
+		},
+		UnknownOutputEvent{Type: "futureEvent", Raw: json.RawMessage(`{"x":1}`)},
+	}
+
+	for _, event := range events {
+		t.Run(event.OutputType(), func(t *testing.T) {
+			data, err := MarshalSonicOutput(event)
+			if err != nil {
+				t.Fatalf("MarshalSonicOutput: %v", err)
+			}
+			decoded, err := DecodeSonicOutput(data)
+			if err != nil {
+				t.Fatalf("DecodeSonicOutput(%s): %v", data, err)
+			}
+			if !reflect.DeepEqual(decoded, event) {
+				t.Errorf("往返结果不一致\n got: %#v\nwant: %#v", decoded, event)
+			}
+		})
+	}
+}
+
+func TestOutputContentStartGenerationStage(t *testing.T) {
+	tests := []struct {
+		fields string
+		want   string
+	}{
+		{`{"generationStage":"SPECULATIVE"}`, GenerationStageSpeculative},
+		{`{"generationStage":"FINAL"}`, GenerationStageFinal},
+		{"", ""},
+		{"not json", ""},
+	}
+	for _, tt := range tests {
+		e := OutputContentStartEvent{AdditionalModelFields: tt.fields}
+		if got := e.GenerationStage(); got != tt.want {
+			t.Errorf("GenerationStage(%q) = %q, want %q", tt.fields, got, tt.want)
+		}
+	}
+}
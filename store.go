@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSessionNotFound 存储中没有该会话
+var ErrSessionNotFound = errors.New("会话不存在")
+
+// newSessionID 生成会话 ID：纳秒时间戳加随机数，同一秒内多次重置或多个进程共用存储也不会重复
+func newSessionID() string {
+	var b [4]byte
+	rand.Read(b[:])
+	return fmt.Sprintf("session_%d_%s", time.Now().UnixNano(), hex.EncodeToString(b[:]))
+}
+
+// SessionStore 对话持久化：每轮对话完成时写入，进程重启后可按会话 ID 恢复
+type SessionStore interface {
+	// CreateSession 登记一个新会话，会话已存在时不做任何事
+	CreateSession(sessionID string, startTime time.Time) error
+	// AppendTurn 追加一轮完成的对话
+	AppendTurn(sessionID string, msg ConversationMessage) error
+	// SaveSummary 保存会话最新的滚动摘要，summarized 为摘要覆盖的轮数
+	SaveSummary(sessionID string, summary ConversationMessage, summarized int) error
+	// LoadSession 按时间顺序读取会话的全部轮次和最新的摘要，不存在返回 ErrSessionNotFound
+	LoadSession(sessionID string) (*ConversationContext, error)
+	Close() error
+}
+
+// OpenSessionStore 按 "file:<目录>" 或 "sqlite:<文件>" 打开存储，"none" 或空串表示不持久化
+func OpenSessionStore(spec string) (SessionStore, error) {
+	if spec == "" || spec == "none" {
+		return nil, nil
+	}
+	kind, path, ok := strings.Cut(spec, ":")
+	if !ok || path == "" {
+		return nil, fmt.Errorf("无效的存储配置 %q，应为 file:<目录> 或 sqlite:<文件>", spec)
+	}
+	var store SessionStore
+	var err error
+	switch kind {
+	case "file":
+		store, err = NewFileSessionStore(path)
+	case "sqlite":
+		store, err = NewSQLiteSessionStore(path)
+	default:
+		return nil, fmt.Errorf("未知的存储类型 %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// validSessionID 会话 ID 会用作目录名，不能包含路径分隔符
+func validSessionID(sessionID string) error {
+	if sessionID == "" || sessionID == "." || sessionID == ".." || strings.ContainsAny(sessionID, `/\`) {
+		return fmt.Errorf("无效的会话 ID %q", sessionID)
+	}
+	return nil
+}
+
+// FileSessionStore 基于文件的存储，每个会话一个目录：
+//
+//	<dir>/<session>/session.json        会话元信息
+//	<dir>/<session>/turns.jsonl         每行一轮对话
+//	<dir>/<session>/summary.json        最新的滚动摘要（有摘要时）
+//	<dir>/<session>/audio/000001-user.ulaw  该轮的 8kHz mulaw 音频
+type FileSessionStore struct {
+	dir string
+	// mu 保证同一会话的轮次按顺序写入，seq 缓存各会话已写入的轮数
+	mu  sync.Mutex
+	seq map[string]int
+}
+
+// fileSessionMeta session.json 的内容
+type fileSessionMeta struct {
+	SessionID string    `json:"sessionId"`
+	StartTime time.Time `json:"startTime"`
+}
+
+// fileTurn turns.jsonl 中的一行
+type fileTurn struct {
+	Seq         int       `json:"seq"`
+	Role        string    `json:"role"`
+	Text        string    `json:"text,omitempty"`
+	Audio       string    `json:"audio,omitempty"`
+	StartTime   time.Time `json:"startTime"`
+	EndTime     time.Time `json:"endTime"`
+	Interrupted bool      `json:"interrupted,omitempty"`
+}
+
+// fileSummary summary.json 的内容
+type fileSummary struct {
+	Text       string    `json:"text"`
+	StartTime  time.Time `json:"startTime"`
+	EndTime    time.Time `json:"endTime"`
+	Summarized int       `json:"summarized"`
+}
+
+// NewFileSessionStore 创建文件存储，目录不存在时自动创建
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建存储目录失败: %w", err)
+	}
+	return &FileSessionStore{dir: dir, seq: make(map[string]int)}, nil
+}
+
+func (f *FileSessionStore) sessionDir(sessionID string) string {
+	return filepath.Join(f.dir, sessionID)
+}
+
+// CreateSession 创建会话目录并写入元信息
+func (f *FileSessionStore) CreateSession(sessionID string, startTime time.Time) error {
+	if err := validSessionID(sessionID); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	dir := f.sessionDir(sessionID)
+	metaPath := filepath.Join(dir, "session.json")
+	if _, err := os.Stat(metaPath); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "audio"), 0755); err != nil {
+		return fmt.Errorf("创建会话目录失败: %w", err)
+	}
+	data, err := json.Marshal(fileSessionMeta{SessionID: sessionID, StartTime: startTime})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metaPath, data, 0644)
+}
+
+// AppendTurn 先写音频再追加一行记录，记录存在即音频完整
+func (f *FileSessionStore) AppendTurn(sessionID string, msg ConversationMessage) error {
+	if err := validSessionID(sessionID); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	dir := f.sessionDir(sessionID)
+	if _, err := os.Stat(filepath.Join(dir, "session.json")); err != nil {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	seq, ok := f.seq[sessionID]
+	if !ok {
+		n, err := countLines(filepath.Join(dir, "turns.jsonl"))
+		if err != nil {
+			return err
+		}
+		seq = n
+	}
+	seq++
+
+	turn := fileTurn{
+		Seq:         seq,
+		Role:        msg.Role,
+		Text:        msg.Text,
+		StartTime:   msg.StartTime,
+		EndTime:     msg.EndTime,
+		Interrupted: msg.Interrupted,
+	}
+	if len(msg.Content) > 0 {
+		turn.Audio = filepath.Join("audio", fmt.Sprintf("%06d-%s.ulaw", seq, msg.Role))
+		if err := os.WriteFile(filepath.Join(dir, turn.Audio), msg.Content, 0644); err != nil {
+			return fmt.Errorf("写入音频失败: %w", err)
+		}
+	}
+
+	line, err := json.Marshal(turn)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, "turns.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("打开对话记录失败: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("写入对话记录失败: %w", err)
+	}
+	f.seq[sessionID] = seq
+	return nil
+}
+
+// SaveSummary 先写临时文件再重命名，读取时不会看到写了一半的摘要
+func (f *FileSessionStore) SaveSummary(sessionID string, summary ConversationMessage, summarized int) error {
+	if err := validSessionID(sessionID); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	dir := f.sessionDir(sessionID)
+	if _, err := os.Stat(filepath.Join(dir, "session.json")); err != nil {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	data, err := json.Marshal(fileSummary{
+		Text:       summary.Text,
+		StartTime:  summary.StartTime,
+		EndTime:    summary.EndTime,
+		Summarized: summarized,
+	})
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, "summary.json.tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("写入摘要失败: %w", err)
+	}
+	return os.Rename(tmp, filepath.Join(dir, "summary.json"))
+}
+
+// LoadSession 读取会话元信息、对话记录、音频和摘要
+func (f *FileSessionStore) LoadSession(sessionID string) (*ConversationContext, error) {
+	if err := validSessionID(sessionID); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	dir := f.sessionDir(sessionID)
+	data, err := os.ReadFile(filepath.Join(dir, "session.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var meta fileSessionMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("解析会话元信息失败: %w", err)
+	}
+
+	conv := &ConversationContext{
+		SessionID: sessionID,
+		Messages:  make([]ConversationMessage, 0),
+		StartTime: meta.StartTime,
+	}
+	if err := f.loadSummary(dir, conv); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filepath.Join(dir, "turns.jsonl"))
+	if errors.Is(err, os.ErrNotExist) {
+		return conv, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var turn fileTurn
+		if err := json.Unmarshal(scanner.Bytes(), &turn); err != nil {
+			return nil, fmt.Errorf("解析对话记录失败: %w", err)
+		}
+		msg := ConversationMessage{
+			Role:        turn.Role,
+			Text:        turn.Text,
+			StartTime:   turn.StartTime,
+			EndTime:     turn.EndTime,
+			Interrupted: turn.Interrupted,
+		}
+		if turn.Audio != "" {
+			if msg.Content, err = os.ReadFile(filepath.Join(dir, turn.Audio)); err != nil {
+				return nil, fmt.Errorf("读取音频失败: %w", err)
+			}
+		}
+		conv.Messages = append(conv.Messages, msg)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取对话记录失败: %w", err)
+	}
+	conv.Summarized = min(conv.Summarized, len(conv.Messages))
+	return conv, nil
+}
+
+// loadSummary 读取 summary.json，没有摘要时不做任何事
+func (f *FileSessionStore) loadSummary(dir string, conv *ConversationContext) error {
+	data, err := os.ReadFile(filepath.Join(dir, "summary.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var summary fileSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return fmt.Errorf("解析摘要失败: %w", err)
+	}
+	conv.Summary = &ConversationMessage{
+		Role:      RoleSummary,
+		Text:      summary.Text,
+		StartTime: summary.StartTime,
+		EndTime:   summary.EndTime,
+	}
+	conv.Summarized = summary.Summarized
+	return nil
+}
+
+// Close 文件存储没有需要释放的资源
+func (f *FileSessionStore) Close() error {
+	return nil
+}
+
+// countLines 统计文件中的非空行数，文件不存在返回 0
+func countLines(path string) (int, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	n := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			n++
+		}
+	}
+	return n, scanner.Err()
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchema 会话表和对话轮次表，时间以 Unix 纳秒保存
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	id         TEXT PRIMARY KEY,
+	start_time INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS turns (
+	session_id  TEXT    NOT NULL REFERENCES sessions(id),
+	seq         INTEGER NOT NULL,
+	role        TEXT    NOT NULL,
+	text        TEXT    NOT NULL DEFAULT '',
+	audio       BLOB,
+	start_time  INTEGER NOT NULL,
+	end_time    INTEGER NOT NULL,
+	interrupted INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (session_id, seq)
+);
+CREATE TABLE IF NOT EXISTS summaries (
+	session_id TEXT    PRIMARY KEY REFERENCES sessions(id),
+	text       TEXT    NOT NULL,
+	start_time INTEGER NOT NULL,
+	end_time   INTEGER NOT NULL,
+	summarized INTEGER NOT NULL
+);`
+
+// SQLiteSessionStore 基于 SQLite 的存储，音频以 BLOB 保存在 turns 表中
+type SQLiteSessionStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteSessionStore 打开（或创建）数据库文件并建表
+func NewSQLiteSessionStore(path string) (*SQLiteSessionStore, error) {
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=on")
+	if err != nil {
+		return nil, fmt.Errorf("打开数据库失败: %w", err)
+	}
+	// SQLite 同一时间只允许一个写入者
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化数据库失败: %w", err)
+	}
+	return &SQLiteSessionStore{db: db}, nil
+}
+
+// CreateSession 插入会话记录，已存在时忽略
+// 会话 ID 与文件存储使用同样的校验，两种存储之间可以互相导出
+func (s *SQLiteSessionStore) CreateSession(sessionID string, startTime time.Time) error {
+	if err := validSessionID(sessionID); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO sessions (id, start_time) VALUES (?, ?)`,
+		sessionID, unixNano(startTime))
+	if err != nil {
+		return fmt.Errorf("创建会话记录失败: %w", err)
+	}
+	return nil
+}
+
+// AppendTurn 以会话内下一个序号插入一轮对话
+func (s *SQLiteSessionStore) AppendTurn(sessionID string, msg ConversationMessage) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := sessionExists(tx, sessionID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO turns (session_id, seq, role, text, audio, start_time, end_time, interrupted)
+		SELECT ?, COALESCE(MAX(seq), 0) + 1, ?, ?, ?, ?, ?, ? FROM turns WHERE session_id = ?`,
+		sessionID, msg.Role, msg.Text, msg.Content,
+		unixNano(msg.StartTime), unixNano(msg.EndTime), msg.Interrupted, sessionID)
+	if err != nil {
+		return fmt.Errorf("写入对话记录失败: %w", err)
+	}
+	return tx.Commit()
+}
+
+// SaveSummary 保存（或替换）会话的摘要
+func (s *SQLiteSessionStore) SaveSummary(sessionID string, summary ConversationMessage, summarized int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := sessionExists(tx, sessionID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT OR REPLACE INTO summaries (session_id, text, start_time, end_time, summarized)
+		VALUES (?, ?, ?, ?, ?)`,
+		sessionID, summary.Text, unixNano(summary.StartTime), unixNano(summary.EndTime), summarized)
+	if err != nil {
+		return fmt.Errorf("写入摘要失败: %w", err)
+	}
+	return tx.Commit()
+}
+
+// sessionExists 会话不存在时返回 ErrSessionNotFound
+func sessionExists(tx *sql.Tx, sessionID string) error {
+	var exists int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM sessions WHERE id = ?`, sessionID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	return nil
+}
+
+// LoadSession 按序号读取会话的全部轮次和摘要
+func (s *SQLiteSessionStore) LoadSession(sessionID string) (*ConversationContext, error) {
+	var startTime int64
+	err := s.db.QueryRow(`SELECT start_time FROM sessions WHERE id = ?`, sessionID).Scan(&startTime)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT role, text, audio, start_time, end_time, interrupted
+		FROM turns WHERE session_id = ? ORDER BY seq`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("读取对话记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	conv := &ConversationContext{
+		SessionID: sessionID,
+		Messages:  make([]ConversationMessage, 0),
+		StartTime: fromUnixNano(startTime),
+	}
+	for rows.Next() {
+		var msg ConversationMessage
+		var start, end int64
+		if err := rows.Scan(&msg.Role, &msg.Text, &msg.Content, &start, &end, &msg.Interrupted); err != nil {
+			return nil, fmt.Errorf("解析对话记录失败: %w", err)
+		}
+		msg.StartTime = fromUnixNano(start)
+		msg.EndTime = fromUnixNano(end)
+		conv.Messages = append(conv.Messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取对话记录失败: %w", err)
+	}
+
+	var summary ConversationMessage
+	var start, end int64
+	err = s.db.QueryRow(`SELECT text, start_time, end_time, summarized FROM summaries WHERE session_id = ?`,
+		sessionID).Scan(&summary.Text, &start, &end, &conv.Summarized)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return nil, fmt.Errorf("读取摘要失败: %w", err)
+	default:
+		summary.Role = RoleSummary
+		summary.StartTime = fromUnixNano(start)
+		summary.EndTime = fromUnixNano(end)
+		conv.Summary = &summary
+		conv.Summarized = min(conv.Summarized, len(conv.Messages))
+	}
+	return conv, nil
+}
+
+// Close 关闭数据库
+func (s *SQLiteSessionStore) Close() error {
+	return s.db.Close()
+}
+
+// unixNano 时间的 Unix 纳秒表示，零值保存为 0
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano unixNano 的逆运算
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
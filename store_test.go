@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// storeBackends 两种存储，open 在同一位置重新打开存储，模拟进程重启
+var storeBackends = []struct {
+	name string
+	open func(t *testing.T, dir string) SessionStore
+}{
+	{"file", func(t *testing.T, dir string) SessionStore {
+		store, err := NewFileSessionStore(filepath.Join(dir, "sessions"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}},
+	{"sqlite", func(t *testing.T, dir string) SessionStore {
+		store, err := NewSQLiteSessionStore(filepath.Join(dir, "voice-agent.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}},
+}
+
+// testTurn 第 i 轮对话，音频内容各不相同
+func testTurn(i int, role string, start time.Time) ConversationMessage {
+	at := start.Add(time.Duration(i) * time.Second)
+	return ConversationMessage{
+		Role:        role,
+		Text:        strings.Repeat("轮", i+1),
+		Content:     bytes.Repeat([]byte{byte(i + 1)}, 80*(i+1)),
+		StartTime:   at,
+		EndTime:     at.Add(time.Second),
+		Interrupted: role == RoleAssistant && i%2 == 1,
+	}
+}
+
+func TestSessionStores(t *testing.T) {
+	for _, backend := range storeBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			dir := t.TempDir()
+			start := time.Now()
+			sessionID := newSessionID()
+
+			t.Run("round trip", func(t *testing.T) {
+				store := backend.open(t, dir)
+				defer store.Close()
+				if err := store.CreateSession(sessionID, start); err != nil {
+					t.Fatal(err)
+				}
+				// 重复创建不清空已有记录
+				if err := store.CreateSession(sessionID, start.Add(time.Hour)); err != nil {
+					t.Fatal(err)
+				}
+				for i, role := range []string{RoleUser, RoleAssistant} {
+					if err := store.AppendTurn(sessionID, testTurn(i, role, start)); err != nil {
+						t.Fatal(err)
+					}
+				}
+				summary := ConversationMessage{Role: RoleSummary, Text: "用户问了天气", StartTime: start, EndTime: start.Add(2 * time.Second)}
+				if err := store.SaveSummary(sessionID, summary, 1); err != nil {
+					t.Fatal(err)
+				}
+
+				conv, err := store.LoadSession(sessionID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if conv.SessionID != sessionID || !conv.StartTime.Equal(start) {
+					t.Errorf("会话 = %s %v, want %s %v", conv.SessionID, conv.StartTime, sessionID, start)
+				}
+				if len(conv.Messages) != 2 {
+					t.Fatalf("读取到 %d 轮, want 2", len(conv.Messages))
+				}
+				for i, role := range []string{RoleUser, RoleAssistant} {
+					want, got := testTurn(i, role, start), conv.Messages[i]
+					if got.Role != want.Role || got.Text != want.Text || !bytes.Equal(got.Content, want.Content) ||
+						!got.StartTime.Equal(want.StartTime) || !got.EndTime.Equal(want.EndTime) || got.Interrupted != want.Interrupted {
+						t.Errorf("第 %d 轮 = %s %q (%d 字节) interrupted=%v", i+1, got.Role, got.Text, len(got.Content), got.Interrupted)
+					}
+				}
+				if conv.Summary == nil || conv.Summary.Text != summary.Text || conv.Summary.Role != RoleSummary ||
+					!conv.Summary.EndTime.Equal(summary.EndTime) || conv.Summarized != 1 {
+					t.Errorf("摘要 = %+v 覆盖 %d 轮", conv.Summary, conv.Summarized)
+				}
+			})
+
+			t.Run("reopen continues", func(t *testing.T) {
+				// 重新打开存储后继续追加，序号接着之前的轮次，不覆盖已有音频
+				store := backend.open(t, dir)
+				defer store.Close()
+				if err := store.AppendTurn(sessionID, testTurn(2, RoleUser, start)); err != nil {
+					t.Fatal(err)
+				}
+				conv, err := store.LoadSession(sessionID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(conv.Messages) != 3 {
+					t.Fatalf("读取到 %d 轮, want 3", len(conv.Messages))
+				}
+				for i, msg := range conv.Messages {
+					if want := testTurn(i, msg.Role, start); msg.Text != want.Text || !bytes.Equal(msg.Content, want.Content) {
+						t.Errorf("第 %d 轮 = %q (%d 字节), want %q (%d 字节)", i+1, msg.Text, len(msg.Content), want.Text, len(want.Content))
+					}
+				}
+				if conv.Summary == nil || conv.Summarized != 1 {
+					t.Errorf("重新打开后摘要 = %+v 覆盖 %d 轮", conv.Summary, conv.Summarized)
+				}
+			})
+
+			t.Run("not found", func(t *testing.T) {
+				store := backend.open(t, dir)
+				defer store.Close()
+				missing := newSessionID()
+				if _, err := store.LoadSession(missing); !errors.Is(err, ErrSessionNotFound) {
+					t.Errorf("LoadSession = %v, want ErrSessionNotFound", err)
+				}
+				if err := store.AppendTurn(missing, testTurn(0, RoleUser, start)); !errors.Is(err, ErrSessionNotFound) {
+					t.Errorf("AppendTurn = %v, want ErrSessionNotFound", err)
+				}
+				if err := store.SaveSummary(missing, ConversationMessage{Role: RoleSummary, Text: "x"}, 1); !errors.Is(err, ErrSessionNotFound) {
+					t.Errorf("SaveSummary = %v, want ErrSessionNotFound", err)
+				}
+			})
+
+			t.Run("invalid session id", func(t *testing.T) {
+				store := backend.open(t, dir)
+				defer store.Close()
+				for _, id := range []string{"", ".", "..", "../escape", "a/b", `a\b`} {
+					if err := store.CreateSession(id, start); err == nil {
+						t.Errorf("CreateSession(%q) 应报错", id)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestOpenSessionStore(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"none", "", false},
+		{"file:" + filepath.Join(dir, "sessions"), "*main.FileSessionStore", false},
+		{"sqlite:" + filepath.Join(dir, "voice-agent.db"), "*main.SQLiteSessionStore", false},
+		{"file:", "", true},
+		{"sessions", "", true},
+		{"redis:localhost", "", true},
+	}
+	for _, tt := range tests {
+		store, err := OpenSessionStore(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("OpenSessionStore(%q) err = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		got := ""
+		if store != nil {
+			got = fmt.Sprintf("%T", store)
+			store.Close()
+		}
+		if got != tt.want {
+			t.Errorf("OpenSessionStore(%q) = %s, want %s", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestNewSessionIDUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id := newSessionID()
+		if seen[id] {
+			t.Fatalf("会话 ID 重复: %s", id)
+		}
+		if err := validSessionID(id); err != nil {
+			t.Fatal(err)
+		}
+		seen[id] = true
+	}
+}
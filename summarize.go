@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// DefaultSummaryModelID 默认的摘要模型（跨区域推理配置）
+const DefaultSummaryModelID = "us.amazon.nova-lite-v1:0"
+
+// summarySystemPrompt 摘要模型的系统提示，摘要使用人设的回复语言，重放时与对话的语言一致
+func summarySystemPrompt(language string) string {
+	if isChineseLanguage(language) {
+		return "你负责压缩语音助手的对话记录。把给出的对话总结成一段简洁的中文摘要，" +
+			"保留用户的身份信息、偏好、提出过的问题和助手给出的关键结论，不要编造内容，不超过 300 字。"
+	}
+	if language == "" {
+		language = "en-US"
+	}
+	return "You compress the transcript of a voice assistant conversation. Summarize it as one concise paragraph " +
+		"written in the language with BCP 47 tag " + language + ". Keep the user's identity, preferences, " +
+		"the questions they asked and the assistant's key conclusions. Do not invent anything. Stay under 150 words."
+}
+
+// summaryReplayPrefix 摘要重放给模型时的前缀，与回复语言一致
+func summaryReplayPrefix(language string) string {
+	if isChineseLanguage(language) {
+		return "（之前对话的摘要）"
+	}
+	return "(Summary of the earlier conversation) "
+}
+
+// TextModel 文本大模型，用于摘要等辅助任务
+type TextModel interface {
+	Complete(ctx context.Context, system, prompt string) (string, error)
+}
+
+// BedrockTextModel 通过 Converse API 调用 Bedrock 文本模型
+type BedrockTextModel struct {
+	client    *bedrockruntime.Client
+	modelID   string
+	maxTokens int32
+}
+
+// NewBedrockTextModel 创建 Bedrock 文本模型
+func NewBedrockTextModel(client *bedrockruntime.Client, modelID string) *BedrockTextModel {
+	return &BedrockTextModel{client: client, modelID: modelID, maxTokens: 1024}
+}
+
+// Complete 发送单轮请求，返回模型回复的文本
+func (m *BedrockTextModel) Complete(ctx context.Context, system, prompt string) (string, error) {
+	output, err := m.client.Converse(ctx, &bedrockruntime.ConverseInput{
+		ModelId: aws.String(m.modelID),
+		System: []types.SystemContentBlock{
+			&types.SystemContentBlockMemberText{Value: system},
+		},
+		Messages: []types.Message{{
+			Role:    types.ConversationRoleUser,
+			Content: []types.ContentBlock{&types.ContentBlockMemberText{Value: prompt}},
+		}},
+		InferenceConfig: &types.InferenceConfiguration{
+			MaxTokens:   aws.Int32(m.maxTokens),
+			Temperature: aws.Float32(0.2),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("调用 Converse 失败: %w", err)
+	}
+
+	message, ok := output.Output.(*types.ConverseOutputMemberMessage)
+	if !ok {
+		return "", fmt.Errorf("Converse 响应中没有消息")
+	}
+	var text strings.Builder
+	for _, block := range message.Value.Content {
+		if t, ok := block.(*types.ContentBlockMemberText); ok {
+			text.WriteString(t.Value)
+		}
+	}
+	if text.Len() == 0 {
+		return "", fmt.Errorf("Converse 响应中没有文本")
+	}
+	return text.String(), nil
+}
+
+// SummaryConfig 滚动摘要配置
+type SummaryConfig struct {
+	// MaxTurns 对话超过这么多轮时开始摘要，0 表示不按轮数触发
+	MaxTurns int
+	// MaxTokens 对话文本估算超过这么多 token 时开始摘要，0 表示不按 token 触发
+	MaxTokens int
+	// KeepRecent 摘要后保留原文的最近轮数
+	KeepRecent int
+	// Timeout 单次摘要请求的超时
+	Timeout time.Duration
+}
+
+// DefaultSummaryConfig 默认摘要配置：超过 40 轮或 1500 token 时摘要，保留最近 10 轮
+func DefaultSummaryConfig() SummaryConfig {
+	return SummaryConfig{
+		MaxTurns:   40,
+		MaxTokens:  1500,
+		KeepRecent: 10,
+		Timeout:    30 * time.Second,
+	}
+}
+
+// needsSummary 判断对话是否超过摘要阈值
+func (c SummaryConfig) needsSummary(messages []ConversationMessage) bool {
+	if len(messages) <= c.KeepRecent {
+		return false
+	}
+	if c.MaxTurns > 0 && len(messages) > c.MaxTurns {
+		return true
+	}
+	if c.MaxTokens > 0 {
+		tokens := 0
+		for _, msg := range messages {
+			tokens += estimateTokens(msg.Text)
+		}
+		return tokens > c.MaxTokens
+	}
+	return false
+}
+
+// summarySplit 计算要被摘要替换的前缀长度：保留最近 KeepRecent 轮，
+// 并让保留部分从用户发言开始，返回 0 表示没有可摘要的内容
+func (c SummaryConfig) summarySplit(messages []ConversationMessage) int {
+	n := len(messages) - c.KeepRecent
+	for n > 0 && n < len(messages) && messages[n].Role != RoleUser {
+		n++
+	}
+	if n >= len(messages) {
+		return 0
+	}
+	// 只有一条旧摘要时不需要重新摘要
+	if n == 1 && messages[0].Role == RoleSummary {
+		return 0
+	}
+	return n
+}
+
+// summaryLabels 摘要请求中的说话人标签
+type summaryLabels struct {
+	summary, assistant, user, interrupted string
+}
+
+var (
+	chineseSummaryLabels = summaryLabels{"此前的摘要：", "助手：", "用户：", "（被打断）"}
+	englishSummaryLabels = summaryLabels{"Previous summary: ", "Assistant: ", "User: ", " (interrupted)"}
+)
+
+// summaryPrompt 把要压缩的对话（可能以旧摘要开头）整理成摘要请求，标签使用回复语言
+func summaryPrompt(messages []ConversationMessage, language string) string {
+	labels := englishSummaryLabels
+	if isChineseLanguage(language) {
+		labels = chineseSummaryLabels
+	}
+	var b strings.Builder
+	for _, msg := range messages {
+		if msg.Text == "" {
+			continue
+		}
+		switch msg.Role {
+		case RoleSummary:
+			b.WriteString(labels.summary)
+		case RoleAssistant:
+			b.WriteString(labels.assistant)
+		default:
+			b.WriteString(labels.user)
+		}
+		b.WriteString(msg.Text)
+		if msg.Interrupted {
+			b.WriteString(labels.interrupted)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// summarize 调用模型把对话压缩为一条摘要消息，摘要使用 language 书写
+func summarize(ctx context.Context, model TextModel, messages []ConversationMessage, language string) (ConversationMessage, error) {
+	text, err := model.Complete(ctx, summarySystemPrompt(language), summaryPrompt(messages, language))
+	if err != nil {
+		return ConversationMessage{}, err
+	}
+	return ConversationMessage{
+		Role:      RoleSummary,
+		Text:      strings.TrimSpace(text),
+		StartTime: messages[0].StartTime,
+		EndTime:   messages[len(messages)-1].EndTime,
+	}, nil
+}
+
+// maybeSummarize 对话超过阈值时在后台摘要较早的轮次，同一时间只运行一个摘要任务
+// 摘要只替换重放给模型的历史，完整的对话记录保留在 Messages 中，摘要随会话一起保存
+func (va *VoiceAgent) maybeSummarize() {
+	if va.summaryModel == nil || !va.summarizing.CompareAndSwap(false, true) {
+		return
+	}
+
+	va.contextMu.Lock()
+	conversation := va.context
+	view := conversation.replayView()
+	summarized := conversation.Summarized
+	hasSummary := conversation.Summary != nil
+	va.contextMu.Unlock()
+
+	language := va.Persona().Language
+	n := 0
+	if va.summary.needsSummary(view) {
+		n = va.summary.summarySplit(view)
+	}
+	if n == 0 {
+		va.summarizing.Store(false)
+		return
+	}
+	// view[:n] 中除旧摘要外的都是新被摘要的轮次
+	covered := summarized + n
+	if hasSummary {
+		covered--
+	}
+
+	go func() {
+		defer va.summarizing.Store(false)
+
+		ctx, cancel := context.WithTimeout(va.playbackCtx, va.summary.Timeout)
+		defer cancel()
+		start := time.Now()
+		summary, err := summarize(ctx, va.summaryModel, view[:n], language)
+		if err != nil {
+			va.log().Warn("对话摘要失败", "error", err)
+			va.publishError("summary", err)
+			return
+		}
+
+		// 摘要期间会话被重置或历史被清除时放弃结果
+		va.contextMu.Lock()
+		valid := va.context == conversation && conversation.Summarized == summarized &&
+			len(conversation.Messages) >= covered
+		if valid {
+			conversation.Summary = &summary
+			conversation.Summarized = covered
+		}
+		sessionID, count := conversation.SessionID, len(conversation.Messages)
+		va.contextMu.Unlock()
+		if !valid {
+			return
+		}
+
+		if va.store != nil {
+			if err := va.store.SaveSummary(sessionID, summary, covered); err != nil {
+				va.log().Error("保存对话摘要失败", "error", err)
+				va.publishError("store", err)
+			}
+		}
+		va.log().Info("已摘要较早的对话", "summarized", covered, "message_count", count,
+			"summary_tokens", estimateTokens(summary.Text), "elapsed", time.Since(start).Round(time.Millisecond))
+	}()
+}
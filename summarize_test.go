@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTextModel 记录收到的请求，按顺序返回 "摘要1"、"摘要2"……
+type fakeTextModel struct {
+	mu      sync.Mutex
+	systems []string
+	prompts []string
+}
+
+func (m *fakeTextModel) Complete(ctx context.Context, system, prompt string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.systems = append(m.systems, system)
+	m.prompts = append(m.prompts, prompt)
+	return fmt.Sprintf(" 摘要%d ", len(m.prompts)), nil
+}
+
+func (m *fakeTextModel) Prompts() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.prompts...)
+}
+
+func (m *fakeTextModel) Systems() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.systems...)
+}
+
+// usePersona 切换测试代理的人设
+func usePersona(t *testing.T, va *VoiceAgent, name string) {
+	t.Helper()
+	if err := va.SetPersona(name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// commitTurns 依次提交 from..to-1 轮对话，用户和助手交替，文本为 format 格式化的轮次号
+func commitTurns(va *VoiceAgent, from, to int, format string) {
+	start := time.Now()
+	for i := from; i < to; i++ {
+		role := RoleUser
+		if i%2 == 1 {
+			role = RoleAssistant
+		}
+		at := start.Add(time.Duration(i) * time.Second)
+		va.commitTurn(&ConversationMessage{
+			Role:      role,
+			Text:      fmt.Sprintf(format, i+1),
+			Content:   []byte{byte(i)},
+			StartTime: at,
+			EndTime:   at.Add(time.Second),
+		})
+	}
+}
+
+func TestSummarizeKeepsTranscriptAndPersistsSummary(t *testing.T) {
+	store, err := NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := &fakeTextModel{}
+	va := newTestAgent(t)
+	usePersona(t, va, "chinese")
+	va.store = store
+	va.summaryModel = model
+	va.summary = SummaryConfig{MaxTurns: 4, KeepRecent: 2, Timeout: time.Second}
+	if err := store.CreateSession(va.sessionID(), va.context.StartTime); err != nil {
+		t.Fatal(err)
+	}
+
+	commitTurns(va, 0, 5, "第%d轮")
+
+	if !waitFor(t, time.Second, func() bool { summary, _ := va.ConversationSummary(); return summary != nil }) {
+		t.Fatal("超过阈值后没有生成摘要")
+	}
+
+	// 保留最近 2 轮，并让保留部分从用户发言开始：前 4 轮被摘要
+	summary, summarized := va.ConversationSummary()
+	if summary.Text != "摘要1" || summary.Role != RoleSummary || summarized != 4 {
+		t.Errorf("摘要 = %q (%s) 覆盖 %d 轮，want 摘要1 覆盖 4 轮", summary.Text, summary.Role, summarized)
+	}
+	if systems := model.Systems(); len(systems) != 1 || !strings.Contains(systems[0], "中文摘要") {
+		t.Errorf("中文人设的摘要系统提示 = %q", systems)
+	}
+	if prompts := model.Prompts(); len(prompts) != 1 || !strings.Contains(prompts[0], "用户：第1轮") ||
+		!strings.Contains(prompts[0], "助手：第4轮") || strings.Contains(prompts[0], "第5轮") {
+		t.Errorf("摘要请求 = %q", prompts)
+	}
+
+	// 完整记录不受摘要影响
+	history := va.GetConversationHistory()
+	if len(history) != 5 || history[0].Text != "第1轮" || len(history[0].Content) != 1 {
+		t.Errorf("完整对话记录被改写: %+v", history)
+	}
+
+	// 重放时摘要代替前 4 轮
+	replay := va.historyForReplay()
+	if len(replay) != 2 || replay[0].Role != RoleSummary || replay[0].Text != "（之前对话的摘要）摘要1" || replay[1].Text != "第5轮" {
+		t.Errorf("重放历史 = %+v", replay)
+	}
+
+	// 摘要随会话保存，恢复后重放视图相同
+	loaded, err := store.LoadSession(va.sessionID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Messages) != 5 || loaded.Summary == nil || loaded.Summary.Text != "摘要1" || loaded.Summarized != 4 {
+		t.Errorf("恢复的会话 = %d 轮, 摘要 %+v 覆盖 %d 轮", len(loaded.Messages), loaded.Summary, loaded.Summarized)
+	}
+	if view := loaded.replayView(); len(view) != 2 || view[0].Role != RoleSummary {
+		t.Errorf("恢复后的重放视图 = %+v", view)
+	}
+
+	// 再次超过阈值时，新摘要包含旧摘要
+	commitTurns(va, 5, 9, "第%d轮")
+	if !waitFor(t, time.Second, func() bool { _, n := va.ConversationSummary(); return n > 4 }) {
+		t.Fatal("没有生成第二次摘要")
+	}
+	prompts := model.Prompts()
+	if !strings.Contains(prompts[len(prompts)-1], "此前的摘要：摘要1") {
+		t.Errorf("第二次摘要请求没有包含旧摘要: %q", prompts[len(prompts)-1])
+	}
+	if n := len(va.GetConversationHistory()); n != 9 {
+		t.Errorf("完整记录有 %d 轮，want 9", n)
+	}
+}
+
+func TestSummarizeFollowsPersonaLanguage(t *testing.T) {
+	model := &fakeTextModel{}
+	va := newTestAgent(t)
+	va.summaryModel = model
+	va.summary = SummaryConfig{MaxTurns: 4, KeepRecent: 2, Timeout: time.Second}
+	if language := va.Persona().Language; language != "en-US" {
+		t.Fatalf("默认人设的语言 = %s", language)
+	}
+
+	commitTurns(va, 0, 5, "turn %d")
+	if !waitFor(t, time.Second, func() bool { summary, _ := va.ConversationSummary(); return summary != nil }) {
+		t.Fatal("超过阈值后没有生成摘要")
+	}
+
+	// 英文人设的摘要用英文书写，请求中不出现中文标签
+	systems, prompts := model.Systems(), model.Prompts()
+	if len(systems) != 1 || !strings.Contains(systems[0], "en-US") || strings.Contains(systems[0], "中文") {
+		t.Errorf("摘要系统提示 = %q", systems)
+	}
+	if len(prompts) != 1 || !strings.Contains(prompts[0], "User: turn 1") ||
+		!strings.Contains(prompts[0], "Assistant: turn 4") || strings.Contains(prompts[0], "用户") {
+		t.Errorf("摘要请求 = %q", prompts)
+	}
+
+	// 重放给英文会话的摘要使用英文前缀
+	replay := va.historyForReplay()
+	if len(replay) != 2 || replay[0].Text != "(Summary of the earlier conversation) 摘要1" {
+		t.Errorf("重放历史 = %+v", replay)
+	}
+}
+
+func TestSummarizeDisabledWithoutModel(t *testing.T) {
+	va := newTestAgent(t)
+	va.summary = SummaryConfig{MaxTurns: 2, KeepRecent: 1, Timeout: time.Second}
+	for i := 0; i < 6; i++ {
+		role := RoleUser
+		if i%2 == 1 {
+			role = RoleAssistant
+		}
+		va.commitTurn(&ConversationMessage{Role: role, Text: fmt.Sprintf("第%d轮", i+1)})
+	}
+	if summary, _ := va.ConversationSummary(); summary != nil {
+		t.Errorf("没有配置摘要模型时不应摘要: %+v", summary)
+	}
+	if n := len(va.historyForReplay()); n != 6 {
+		t.Errorf("重放历史有 %d 轮，want 6", n)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TextInput 用户输入的一段文字，随通道交给发送线程
+type TextInput struct {
+	Text string
+	// TraceCtx 所属轮次的追踪上下文
+	TraceCtx context.Context
+}
+
+// ErrToolPending 工具调用进行中，暂时不能开始新的一轮
+var ErrToolPending = errors.New("工具调用进行中，请稍后再输入")
+
+// SendText 以一段文字开始新的一轮，与语音轮次交替进行，回复仍然用语音播放
+// Sonic 模式下作为 USER 的 textInput 发送到当前会话，级联模式下直接交给对话模型
+func (va *VoiceAgent) SendText(ctx context.Context, text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	if va.llm != nil {
+		return va.RespondText(ctx, text)
+	}
+	if va.turn.State() == TurnToolPending {
+		return ErrToolPending
+	}
+
+	traceCtx := va.beginTextTurn()
+	va.reply.Reset()
+	now := time.Now()
+	va.commitTurn(va.transcript.AddText(RoleUser, text, now))
+	va.events.Publish(TranscriptFinalEvent{At: now, Role: SonicRoleUser, Text: text})
+	va.log().Info("用户输入", transcriptAttr(text))
+
+	select {
+	case va.textInputChan <- TextInput{Text: text, TraceCtx: traceCtx}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// beginTextTurn 文字输入和一段语音一样开始新的一轮，正在播放的回复被打断
+// 返回新轮次的追踪上下文
+func (va *VoiceAgent) beginTextTurn() context.Context {
+	if va.turn.IsAssistantSpeaking() {
+		va.interruptPlayback("text", "")
+	}
+	va.transitionTurn(TurnUserSpeaking, "文本输入")
+	trace := startTurnTrace(va.turn.TurnID(), va.sessionID())
+	trace.EndCapture(0)
+	va.transitionTurn(TurnWaitingModel, "文本输入完成")
+	return trace.Context()
+}
+
+// maxTypedEcho 最多记住的未回显文字输入条数
+const maxTypedEcho = 8
+
+// typedEcho 记录已发送的文字输入：Sonic 把它作为 USER 文本回显时不再重复记录
+type typedEcho struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+// add 记录一条已发送的文字
+func (t *typedEcho) add(text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.texts = append(t.texts, text)
+	if len(t.texts) > maxTypedEcho {
+		t.texts = t.texts[len(t.texts)-maxTypedEcho:]
+	}
+}
+
+// consume 文本是已发送文字的回显时返回 true，并移除该条记录
+func (t *typedEcho) consume(text string) bool {
+	text = strings.TrimSpace(text)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, typed := range t.texts {
+		if typed == text {
+			t.texts = append(t.texts[:i], t.texts[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// SendText 以交互式 TEXT 内容块发送一段用户文字（contentStart / textInput / contentEnd）
+func (s *NovaSonicStream) SendText(text string) error {
+	contentName := s.contents.NewName("text")
+	// 先记录再发送，回显可能在发送返回前就到达
+	s.typed.add(text)
+	err := s.sendEvents(
+		ContentStartEvent{
+			PromptName:  s.promptName,
+			ContentName: contentName,
+			Type:        ContentTypeText,
+			Interactive: true,
+			Role:        SonicRoleUser,
+			TextInputConfiguration: &MediaTypeConfiguration{
+				MediaType: "text/plain",
+			},
+		},
+		TextInputEvent{
+			PromptName:  s.promptName,
+			ContentName: contentName,
+			Content:     text,
+		},
+		ContentEndEvent{
+			PromptName:  s.promptName,
+			ContentName: contentName,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	s.log().Debug("发送文本输入", logKeyContent, contentName)
+	return nil
+}
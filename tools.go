@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Tool 可供 Nova Sonic 调用的工具
+type Tool interface {
+	// Spec 工具定义，会在 promptStart 的 toolConfiguration 中发送给模型
+	Spec() ToolSpec
+	// Invoke 执行工具，input 为模型给出的 JSON 参数，返回值会被编码为 JSON 作为 toolResult
+	Invoke(ctx context.Context, input json.RawMessage) (interface{}, error)
+}
+
+// ToolRegistry 工具注册表
+type ToolRegistry struct {
+	mu    sync.RWMutex
+	tools map[string]Tool
+}
+
+// NewToolRegistry 创建空的工具注册表
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{
+		tools: make(map[string]Tool),
+	}
+}
+
+// Register 注册工具，同名工具会被替换
+func (r *ToolRegistry) Register(tool Tool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tools[tool.Spec().Name] = tool
+}
+
+// Len 已注册的工具数
+func (r *ToolRegistry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.tools)
+}
+
+// Definitions 返回按名称排序的工具定义
+func (r *ToolRegistry) Definitions() []ToolDefinition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	defs := make([]ToolDefinition, 0, len(r.tools))
+	for _, tool := range r.tools {
+		defs = append(defs, ToolDefinition{ToolSpec: tool.Spec()})
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].ToolSpec.Name < defs[j].ToolSpec.Name
+	})
+	return defs
+}
+
+// DefinitionsFor 返回 names 中列出的工具定义，names 为 nil 时返回全部工具
+func (r *ToolRegistry) DefinitionsFor(names []string) []ToolDefinition {
+	defs := r.Definitions()
+	if names == nil {
+		return defs
+	}
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		allowed[name] = true
+	}
+	filtered := defs[:0]
+	for _, def := range defs {
+		if allowed[def.ToolSpec.Name] {
+			filtered = append(filtered, def)
+		}
+	}
+	return filtered
+}
+
+// checkNames 检查 names 中的工具是否都已注册
+func (r *ToolRegistry) checkNames(names []string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, name := range names {
+		if _, ok := r.tools[name]; !ok {
+			return fmt.Errorf("未注册的工具 %q", name)
+		}
+	}
+	return nil
+}
+
+// Invoke 调用工具并返回 JSON 结果
+// 工具不存在或执行失败时返回 {"error": "..."}，让模型能够据此回复用户
+func (r *ToolRegistry) Invoke(ctx context.Context, name, input string) (string, error) {
+	r.mu.RLock()
+	tool, ok := r.tools[name]
+	r.mu.RUnlock()
+
+	if !ok {
+		err := fmt.Errorf("未知的工具 %q", name)
+		return toolErrorResult(err), err
+	}
+
+	if input == "" {
+		input = "{}"
+	}
+	result, err := tool.Invoke(ctx, json.RawMessage(input))
+	if err != nil {
+		return toolErrorResult(err), err
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		err = fmt.Errorf("编码工具结果失败: %w", err)
+		return toolErrorResult(err), err
+	}
+	return string(data), nil
+}
+
+// toolErrorResult 构造错误结果
+func toolErrorResult(err error) string {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(data)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName OTel instrumentation 名称
+const tracerName = "voice-agent"
+
+// TracingConfig 链路追踪配置
+type TracingConfig struct {
+	// Exporter 导出方式: "" 或 "none" 不导出, "stdout" 输出到 Writer, "otlp" 发送到 OTLP/HTTP collector
+	Exporter string
+	// Endpoint OTLP collector 地址（host:port），为空时使用 OTEL_EXPORTER_OTLP_ENDPOINT 或 localhost:4318
+	Endpoint string
+	// Writer stdout 导出器的输出目标，默认 os.Stdout
+	Writer io.Writer
+	// ServiceName 服务名称
+	ServiceName string
+}
+
+// InitTracing 初始化全局 TracerProvider，返回关闭函数（会刷新未导出的 span）
+func InitTracing(ctx context.Context, cfg TracingConfig) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch cfg.Exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		writer := cfg.Writer
+		if writer == nil {
+			writer = os.Stdout
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(writer), stdouttrace.WithPrettyPrint())
+	case "otlp":
+		opts := []otlptracehttp.Option{}
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint), otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("无效的追踪导出方式 %q（可选 none/stdout/otlp）", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("创建追踪导出器失败: %w", err)
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = "voice-agent"
+	}
+	res := resource.NewSchemaless(semconv.ServiceName(serviceName))
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// turnTraceKey 在 context 中保存 *turnTrace 的键
+type turnTraceKey struct{}
+
+// turnTrace 一个对话轮次的追踪状态
+// 根 span "turn" 下依次有 capture、send_audio、model_wait、playback 子 span，
+// 其 context 随 AudioChunk.TraceCtx 经 audioInputChan / audioOutputChan 在各线程间传递
+type turnTrace struct {
+	mu         sync.Mutex
+	ctx        context.Context
+	root       trace.Span
+	capture    trace.Span
+	modelWait  trace.Span
+	playback   trace.Span
+	firstText  bool
+	firstAudio bool
+	ended      bool
+}
+
+// startTurnTrace 开始新轮次的追踪，同时开始 capture 阶段
+func startTurnTrace(turnID int, sessionID string) *turnTrace {
+	tracer := otel.Tracer(tracerName)
+	ctx, root := tracer.Start(context.Background(), "turn",
+		trace.WithAttributes(
+			attribute.Int(logKeyTurn, turnID),
+			attribute.String(logKeySession, sessionID),
+		))
+
+	t := &turnTrace{root: root}
+	t.ctx = context.WithValue(ctx, turnTraceKey{}, t)
+	_, t.capture = tracer.Start(t.ctx, "capture")
+	return t
+}
+
+// turnTraceFrom 从 context 中取出轮次追踪，不存在时返回 nil（所有方法对 nil 安全）
+func turnTraceFrom(ctx context.Context) *turnTrace {
+	if ctx == nil {
+		return nil
+	}
+	t, _ := ctx.Value(turnTraceKey{}).(*turnTrace)
+	return t
+}
+
+// Context 返回携带本轮追踪的 context，用于跨通道传递
+func (t *turnTrace) Context() context.Context {
+	if t == nil {
+		return nil
+	}
+	return t.ctx
+}
+
+// EndCapture VAD 判定语音结束
+func (t *turnTrace) EndCapture(audioBytes int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.capture != nil {
+		t.capture.SetAttributes(attribute.Int("audio.bytes", audioBytes))
+		t.capture.AddEvent("vad_end")
+		t.capture.End()
+		t.capture = nil
+	}
+}
+
+// StartSend 开始发送音频阶段，返回的 span 由调用方在发送完成后结束
+// 发送完成后进入 model_wait 阶段
+func (t *turnTrace) StartSend(contentName string) trace.Span {
+	if t == nil {
+		return trace.SpanFromContext(context.Background())
+	}
+	_, span := otel.Tracer(tracerName).Start(t.ctx, "send_audio",
+		trace.WithAttributes(attribute.String(logKeyContent, contentName)))
+	return span
+}
+
+// StartModelWait 音频已发出，开始等待模型输出
+func (t *turnTrace) StartModelWait() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.modelWait == nil && !t.firstAudio && !t.ended {
+		_, t.modelWait = otel.Tracer(tracerName).Start(t.ctx, "model_wait")
+	}
+}
+
+// MarkFirstText 收到模型第一个 textOutput
+func (t *turnTrace) MarkFirstText(role string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.firstText {
+		return
+	}
+	t.firstText = true
+	t.root.AddEvent("first_text_output", trace.WithAttributes(attribute.String(logKeyRole, role)))
+	if t.modelWait != nil {
+		t.modelWait.AddEvent("first_text_output")
+	}
+}
+
+// MarkFirstAudio 收到模型第一个 audioOutput，结束 model_wait 阶段
+func (t *turnTrace) MarkFirstAudio() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.firstAudio {
+		return
+	}
+	t.firstAudio = true
+	t.root.AddEvent("first_audio_output")
+	if t.modelWait != nil {
+		t.modelWait.End()
+		t.modelWait = nil
+	}
+}
+
+// StartPlayback 开始播放 AI 回复
+func (t *turnTrace) StartPlayback() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.playback == nil && !t.ended {
+		_, t.playback = otel.Tracer(tracerName).Start(t.ctx, "playback")
+	}
+}
+
+// End 结束本轮所有未结束的 span，reason 记录在根 span 上
+func (t *turnTrace) End(reason string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ended {
+		return
+	}
+	t.ended = true
+	for _, span := range []trace.Span{t.capture, t.modelWait, t.playback} {
+		if span != nil {
+			span.End()
+		}
+	}
+	t.root.SetAttributes(attribute.String("turn.end_reason", reason))
+	t.root.End()
+}
+
+// Fail 记录错误并结束本轮
+func (t *turnTrace) Fail(err error) {
+	if t == nil {
+		return
+	}
+	t.root.RecordError(err)
+	t.root.SetStatus(codes.Error, err.Error())
+	t.End("error")
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// transcriptBuilder 把最终识别/回复文本和对应的音频拼装成完整的对话轮次
+// 同一角色连续到达的文本和音频属于同一轮，角色切换或轮次显式结束时提交
+// AI 回复在生成完后等播放结束再提交，被打断时截断到用户实际听到的位置
+type transcriptBuilder struct {
+	mu      sync.Mutex
+	pending *ConversationMessage
+	// audioOffsets 正在进行的 AI 回复中各音频内容块在 Content 中的起始位置
+	audioOffsets map[string]int
+	// finished AI 回复已生成完，等待播放结束
+	finished bool
+	// cut AI 回复已被打断并截断，同一轮后续的文本和音频不再记录
+	cut bool
+}
+
+// AddText 追加一段最终阶段的文本，返回因角色切换而结束的上一轮（没有则为 nil）
+func (b *transcriptBuilder) AddText(role, text string, at time.Time) *ConversationMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.isCut(role) {
+		return nil
+	}
+	done := b.switchRole(role, at)
+	b.pending.Text = joinTranscript(b.pending.Text, text)
+	b.pending.EndTime = at
+	return done
+}
+
+// AddAudio 追加一段 8kHz mulaw 音频，start 为这段音频开始的时间
+func (b *transcriptBuilder) AddAudio(role string, audio []byte, start time.Time) *ConversationMessage {
+	return b.AddContentAudio(role, "", audio, start)
+}
+
+// AddContentAudio 追加属于某个音频内容块的一段音频，打断时按内容块定位播放位置
+func (b *transcriptBuilder) AddContentAudio(role, contentID string, audio []byte, start time.Time) *ConversationMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.isCut(role) {
+		return nil
+	}
+	done := b.switchRole(role, start)
+	if contentID != "" {
+		if b.audioOffsets == nil {
+			b.audioOffsets = make(map[string]int)
+		}
+		if _, ok := b.audioOffsets[contentID]; !ok {
+			b.audioOffsets[contentID] = len(b.pending.Content)
+		}
+	}
+	b.pending.Content = append(b.pending.Content, audio...)
+	if end := start.Add(mulawDuration(audio)); end.After(b.pending.EndTime) {
+		b.pending.EndTime = end
+	}
+	return done
+}
+
+// MarkInterrupted 标记正在进行的 AI 回复被打断
+func (b *transcriptBuilder) MarkInterrupted() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pending != nil && b.pending.Role == RoleAssistant {
+		b.pending.Interrupted = true
+	}
+}
+
+// Commit 结束指定角色正在进行的一轮，角色不符或没有进行中的轮次时返回 nil
+func (b *transcriptBuilder) Commit(role string) *ConversationMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pending == nil || b.pending.Role != role {
+		return nil
+	}
+	return b.take()
+}
+
+// Finish AI 回复生成完毕：回复还在播放时等 Played 或 Cut 再提交，否则立即提交
+// 其他角色与 Commit 相同
+func (b *transcriptBuilder) Finish(role string, playing bool) *ConversationMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pending == nil || b.pending.Role != role {
+		return nil
+	}
+	if role == RoleAssistant && playing && !b.cut && len(b.pending.Content) > 0 {
+		b.finished = true
+		return nil
+	}
+	return b.take()
+}
+
+// Played AI 回复播放完毕，提交已生成完的回复；回复还没生成完时返回 nil
+func (b *transcriptBuilder) Played() *ConversationMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pending == nil || b.pending.Role != RoleAssistant || !b.finished {
+		return nil
+	}
+	return b.take()
+}
+
+// Cut 把被打断的 AI 回复截断到用户实际听到的位置：
+// 音频只保留被打断内容块中已播放的部分，文本换成估算的用户听到的部分
+// 已生成完的回复立即返回以便提交，否则等这一轮结束
+func (b *transcriptBuilder) Cut(cut PlaybackCut) *ConversationMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pending == nil || b.pending.Role != RoleAssistant {
+		return nil
+	}
+	if offset, ok := b.audioOffsets[cut.ContentID]; ok {
+		keep := offset + int(cut.Played*8000/time.Second)
+		if keep < len(b.pending.Content) {
+			b.pending.Content = b.pending.Content[:keep]
+			b.pending.EndTime = b.pending.StartTime.Add(mulawDuration(b.pending.Content))
+		}
+	}
+	if cut.FullText != "" {
+		b.pending.Text = cut.HeardText
+	}
+	b.pending.Interrupted = true
+	b.cut = true
+	if b.finished {
+		return b.take()
+	}
+	return nil
+}
+
+// Flush 结束正在进行的一轮（不论角色），interrupted 表示该轮被意外截断
+func (b *transcriptBuilder) Flush(interrupted bool) *ConversationMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pending == nil {
+		return nil
+	}
+	if interrupted && b.pending.Role == RoleAssistant {
+		b.pending.Interrupted = true
+	}
+	return b.take()
+}
+
+// Reset 丢弃正在进行的一轮
+func (b *transcriptBuilder) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.take()
+}
+
+// isCut 判断 role 的文本和音频是否属于已被截断的 AI 回复，调用方持有锁
+func (b *transcriptBuilder) isCut(role string) bool {
+	return b.cut && role == RoleAssistant && b.pending != nil && b.pending.Role == RoleAssistant
+}
+
+// switchRole 角色变化时结束上一轮并开始新的一轮，调用方持有锁
+func (b *transcriptBuilder) switchRole(role string, at time.Time) *ConversationMessage {
+	var done *ConversationMessage
+	if b.pending != nil && b.pending.Role != role {
+		done = b.take()
+	}
+	if b.pending == nil {
+		b.pending = &ConversationMessage{Role: role, StartTime: at, EndTime: at}
+	}
+	return done
+}
+
+// take 取出正在进行的一轮，调用方持有锁
+func (b *transcriptBuilder) take() *ConversationMessage {
+	msg := b.pending
+	b.pending = nil
+	b.audioOffsets = nil
+	b.finished = false
+	b.cut = false
+	return msg
+}
+
+// mulawDuration 8kHz mulaw 音频的时长
+func mulawDuration(audio []byte) time.Duration {
+	return time.Duration(len(audio)) * time.Second / 8000
+}
+
+// joinTranscript 拼接同一轮的多段文本：中日韩文字之间直接相连，其他文字之间补一个空格
+func joinTranscript(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	last, _ := utf8.DecodeLastRuneInString(a)
+	first, _ := utf8.DecodeRuneInString(b)
+	if unicode.IsSpace(last) || unicode.IsSpace(first) || isCJK(last) || isCJK(first) {
+		return a + b
+	}
+	return a + " " + b
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// TextToSpeech 文本转语音引擎
+type TextToSpeech interface {
+	// Synthesize 合成一段文本，返回 8kHz 16-bit 单声道 PCM
+	Synthesize(ctx context.Context, text string) ([]byte, error)
+}
+
+// pcm8kToMulaw 8kHz 16-bit PCM 转 8kHz mulaw
+func pcm8kToMulaw(pcmData []byte) []byte {
+	mulawData := make([]byte, len(pcmData)/2)
+	for i := range mulawData {
+		sample := int16(binary.LittleEndian.Uint16(pcmData[i*2:]))
+		mulawData[i] = linearToMulaw(sample)
+	}
+	return mulawData
+}
+
+// mulawToPCM 8kHz mulaw 转 8kHz 16-bit PCM
+func mulawToPCM(mulawData []byte) []byte {
+	pcmData := make([]byte, len(mulawData)*2)
+	for i, mulaw := range mulawData {
+		binary.LittleEndian.PutUint16(pcmData[i*2:], uint16(mulawToLinear(mulaw)))
+	}
+	return pcmData
+}
+
+// ttsContentSeq 本地合成音频的内容块编号，播放线程按内容块处理打断
+var ttsContentSeq atomic.Int64
+
+// speak 合成一段文本并交给播放线程，返回合成的 8kHz mulaw 音频
+// 没有配置 TTS 引擎时只记录文本；record 为 true 时在交给播放线程前把音频记入 AI 回复，
+// 这样打断时能按内容块截断
+func (va *VoiceAgent) speak(ctx context.Context, text string, traceCtx context.Context, record bool) ([]byte, error) {
+	if va.tts == nil {
+		va.log().Info("无 TTS 引擎，跳过朗读", transcriptAttr(text))
+		return nil, nil
+	}
+
+	pcmData, err := va.tts.Synthesize(ctx, text)
+	if err != nil {
+		return nil, fmt.Errorf("语音合成失败: %w", err)
+	}
+	if len(pcmData) == 0 {
+		return nil, nil
+	}
+
+	mulawData := pcm8kToMulaw(pcmData)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	contentID := fmt.Sprintf("tts-%d", ttsContentSeq.Add(1))
+	if record {
+		va.commitTurn(va.transcript.AddContentAudio(RoleAssistant, contentID, mulawData, time.Now()))
+	}
+	turnTraceFrom(traceCtx).MarkFirstAudio()
+	va.events.Publish(AssistantAudioChunkEvent{At: time.Now(), Data: mulawData})
+	select {
+	case va.audioOutputChan <- AudioChunk{
+		Data:      mulawData,
+		Timestamp: time.Now(),
+		TraceCtx:  traceCtx,
+		ContentID: contentID,
+	}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return mulawData, nil
+}
+
+// NewTextToSpeech 按名称创建 TTS 引擎，返回 nil 表示不朗读：
+//
+//	none                不朗读，只输出文本
+//	fake                用提示音代替语音，只用于调试
+//	espeak[:<voice>]    本地 espeak-ng，默认按 language（人设的回复语言）选择语音
+//	piper:<model.onnx>  本地 piper
+//	auto                有 espeak-ng 时使用它，否则不朗读并给出警告
+func NewTextToSpeech(spec, language string) (TextToSpeech, error) {
+	name, arg := parseTTSEngine(spec)
+	switch name {
+	case "", "none":
+		return nil, nil
+	case "fake":
+		return FakeTextToSpeech{}, nil
+	case "espeak":
+		if arg == "" {
+			arg = espeakVoice(language)
+		}
+		tts, err := NewEspeakTextToSpeech(arg)
+		if err != nil {
+			return nil, err
+		}
+		return tts, nil
+	case "piper":
+		if arg == "" {
+			return nil, fmt.Errorf("piper 需要指定语音模型，如 piper:zh_CN-huayan-medium.onnx")
+		}
+		tts, err := NewPiperTextToSpeech(arg)
+		if err != nil {
+			return nil, err
+		}
+		return tts, nil
+	case "auto":
+		tts, err := NewEspeakTextToSpeech(espeakVoice(language))
+		if err == nil {
+			return tts, nil
+		}
+		slog.Warn("未找到离线 TTS，文本回复将不朗读；可以用 -tts 指定 espeak 或 piper", "error", err)
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("未知的 TTS 引擎 %q", spec)
+	}
+}
+
+// espeakVoice 按回复语言（BCP 47）选择 espeak-ng 语音：中文为普通话 cmn，英语区分美式和英式，
+// 其他语言使用主语言代码（如 fr、de），为空时使用美式英语
+func espeakVoice(language string) string {
+	lang, region, _ := strings.Cut(strings.ToLower(language), "-")
+	switch lang {
+	case "":
+		return "en-us"
+	case "zh":
+		return "cmn"
+	case "en":
+		if region == "gb" {
+			return "en-gb"
+		}
+		return "en-us"
+	}
+	return lang
+}
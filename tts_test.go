@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestEspeakVoiceFollowsLanguage(t *testing.T) {
+	tests := []struct {
+		language string
+		want     string
+	}{
+		{"zh-CN", "cmn"},
+		{"zh-TW", "cmn"},
+		{"en-US", "en-us"},
+		{"en-GB", "en-gb"},
+		{"en", "en-us"},
+		{"fr-FR", "fr"},
+		{"de-DE", "de"},
+		{"", "en-us"},
+	}
+	for _, tt := range tests {
+		if got := espeakVoice(tt.language); got != tt.want {
+			t.Errorf("espeakVoice(%q) = %q, want %q", tt.language, got, tt.want)
+		}
+	}
+}
+
+func TestNewTextToSpeechExplicitFake(t *testing.T) {
+	tts, err := NewTextToSpeech("fake", "en-US")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tts.(FakeTextToSpeech); !ok {
+		t.Errorf("-tts fake = %T, want FakeTextToSpeech", tts)
+	}
+	// auto 找不到离线 TTS 时不朗读，绝不退回提示音
+	if tts, err := NewTextToSpeech("auto", "en-US"); err != nil {
+		t.Fatal(err)
+	} else if _, ok := tts.(FakeTextToSpeech); ok {
+		t.Errorf("-tts auto 不应使用提示音")
+	}
+	if _, err := NewTextToSpeech("tone", "en-US"); err == nil {
+		t.Errorf("未知的 TTS 引擎应报错")
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/width"
+)
+
+// TUI 参数
+const (
+	// tuiRefreshInterval 界面刷新间隔
+	tuiRefreshInterval = 100 * time.Millisecond
+	// tuiMaxTranscript 保留的对话行数
+	tuiMaxTranscript = 200
+	// tuiMaxLatencies 保留的延迟记录数
+	tuiMaxLatencies = 20
+	// tuiMaxNotices 控制台输出最多显示的行数
+	tuiMaxNotices = 12
+	// tuiNoticeTTL 控制台输出显示多久
+	tuiNoticeTTL = 20 * time.Second
+	// tuiErrorTTL 最近一次错误显示多久
+	tuiErrorTTL = 30 * time.Second
+)
+
+// TUI 终端界面：麦克风电平和阈值、VAD 状态、播放缓冲、滚动的对话文本和每轮延迟
+// 由代理事件驱动；最后一行留给控制台输入，控制台的输出写入 TUI 显示
+type TUI struct {
+	agent *VoiceAgent
+	out   io.Writer
+
+	mu         sync.Mutex
+	level      float64
+	threshold  float64
+	vadState   VADState
+	turnState  TurnState
+	turnID     int
+	transcript []tuiLine
+	partial    tuiLine
+	latencies  []turnLatency
+	notices    []string
+	noticeAt   time.Time
+	lastError  string
+	errorAt    time.Time
+
+	// rows/cols 上次绘制时的终端大小，改变时重新设置输入行
+	rows, cols int
+}
+
+// tuiLine 对话区的一行：一轮发言或一条提示
+type tuiLine struct {
+	At     time.Time
+	Role   string
+	Text   string
+	TurnID int
+}
+
+// turnLatency 一轮的响应延迟：用户说完到 AI 开始说话
+type turnLatency struct {
+	TurnID  int
+	Latency time.Duration
+}
+
+// NewTUI 创建终端界面，out 通常是 os.Stdout
+func NewTUI(agent *VoiceAgent, out io.Writer) *TUI {
+	return &TUI{
+		agent:     agent,
+		out:       out,
+		threshold: agent.EnergyThreshold(),
+		turnState: agent.GetTurnState(),
+	}
+}
+
+// Run 订阅代理事件并定时重绘，直到 ctx 取消
+func (t *TUI) Run(ctx context.Context) error {
+	events, unsubscribe := t.agent.Subscribe(512)
+	defer unsubscribe()
+
+	// 备用屏幕，退出后恢复原来的终端内容
+	fmt.Fprint(t.out, "\x1b[?1049h\x1b[2J")
+	defer fmt.Fprint(t.out, "\x1b[r\x1b[?1049l")
+
+	ticker := time.NewTicker(tuiRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			t.handle(event)
+		case <-ticker.C:
+			t.draw()
+		}
+	}
+}
+
+// Write 接收控制台输出，显示在对话区下方
+func (t *TUI) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if time.Since(t.noticeAt) > tuiNoticeTTL {
+		t.notices = nil
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		t.notices = append(t.notices, line)
+	}
+	if len(t.notices) > tuiMaxNotices {
+		t.notices = t.notices[len(t.notices)-tuiMaxNotices:]
+	}
+	t.noticeAt = time.Now()
+	return len(p), nil
+}
+
+// handle 根据事件更新界面状态
+func (t *TUI) handle(event AgentEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch e := event.(type) {
+	case AudioLevelEvent:
+		t.level = e.Energy
+		t.threshold = e.Threshold
+		t.vadState = e.State
+
+	case TurnStateChangedEvent:
+		t.turnState = e.To
+		t.turnID = e.TurnID
+		if e.From == TurnWaitingModel && e.To == TurnAssistantSpeaking {
+			t.latencies = append(t.latencies, turnLatency{TurnID: e.TurnID, Latency: e.Elapsed})
+			if len(t.latencies) > tuiMaxLatencies {
+				t.latencies = t.latencies[1:]
+			}
+		}
+
+	case TranscriptPartialEvent:
+		t.partial = tuiLine{At: e.At, Role: e.Role, Text: t.partialText(e.Role) + e.Text, TurnID: t.turnID}
+
+	case TranscriptFinalEvent:
+		if t.partial.Role == e.Role {
+			t.partial = tuiLine{}
+		}
+		// 同一轮中同一角色的多段文本合并为一行
+		if n := len(t.transcript); n > 0 && t.transcript[n-1].Role == e.Role && t.transcript[n-1].TurnID == t.turnID {
+			t.transcript[n-1].Text = joinTranscript(t.transcript[n-1].Text, e.Text)
+			return
+		}
+		t.addLine(tuiLine{At: e.At, Role: e.Role, Text: e.Text, TurnID: t.turnID})
+
+	case BargeInEvent:
+		t.addLine(tuiLine{At: e.At, Text: fmt.Sprintf("-- 打断 (%s)，已播放 %.1f 秒", e.Source, e.Played.Seconds())})
+
+	case ToolCallEvent:
+		t.addLine(tuiLine{At: e.At, Text: "-- 调用工具 " + e.ToolName})
+
+	case ErrorEvent:
+		t.lastError = fmt.Sprintf("%s: %v", e.Source, e.Err)
+		t.errorAt = e.At
+
+	case SessionResetEvent:
+		t.transcript = nil
+		t.partial = tuiLine{}
+		t.latencies = nil
+		t.addLine(tuiLine{At: e.At, Text: "-- 新会话 " + e.NewSessionID})
+	}
+}
+
+// partialText 同一角色未完成的预测文本，后续片段接在后面
+func (t *TUI) partialText(role string) string {
+	if t.partial.Role == role && t.partial.TurnID == t.turnID {
+		return t.partial.Text
+	}
+	return ""
+}
+
+func (t *TUI) addLine(line tuiLine) {
+	t.transcript = append(t.transcript, line)
+	if len(t.transcript) > tuiMaxTranscript {
+		t.transcript = t.transcript[len(t.transcript)-tuiMaxTranscript:]
+	}
+}
+
+// draw 重绘界面：保存光标，逐行覆盖，再回到最后一行的输入位置
+func (t *TUI) draw() {
+	rows, cols := terminalSize()
+	if rows < 8 || cols < 40 {
+		return
+	}
+	lines := t.render(rows-1, cols)
+
+	var b strings.Builder
+	if rows != t.rows || cols != t.cols {
+		// 只让最后一行滚动，控制台输入换行时不会把界面顶上去
+		t.rows, t.cols = rows, cols
+		fmt.Fprintf(&b, "\x1b[2J\x1b[%d;%dr\x1b[%d;1H", rows, rows, rows)
+	}
+	b.WriteString("\x1b7")
+	for i, line := range lines {
+		fmt.Fprintf(&b, "\x1b[%d;1H%s\x1b[K", i+1, line)
+	}
+	b.WriteString("\x1b8")
+	io.WriteString(t.out, b.String())
+}
+
+// render 生成界面的 rows 行文本，每行不超过 cols 列
+func (t *TUI) render(rows, cols int) []string {
+	sessionID, messageCount, duration := t.agent.GetSessionInfo()
+	voice, muted := t.agent.Voice(), t.agent.Muted()
+	buffered := t.agent.PlaybackBuffered()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var header []string
+	status := fmt.Sprintf(" voice-agent | %s | %d 条消息 | %s | 音色 %s", sessionID, messageCount,
+		duration.Round(time.Second), voice)
+	if muted {
+		status += " | 麦克风静音"
+	}
+	header = append(header, status)
+	header = append(header, t.levelMeter(cols))
+	header = append(header, fmt.Sprintf(" VAD %-10s | 状态 %-17s | 轮次 #%d | 播放缓冲 %.1fs",
+		t.vadState, t.turnState, t.turnID, buffered.Seconds()))
+	header = append(header, t.latencyLine())
+	header = append(header, strings.Repeat("-", cols))
+
+	var footer []string
+	if time.Since(t.noticeAt) < tuiNoticeTTL {
+		for _, notice := range t.notices {
+			footer = append(footer, " "+notice)
+		}
+	}
+	if t.lastError != "" && time.Since(t.errorAt) < tuiErrorTTL {
+		footer = append(footer, " 错误 "+t.errorAt.Format("15:04:05")+" "+t.lastError)
+	}
+	footer = append(footer, strings.Repeat("-", max(0, cols-34))+" 输入文字回车发送，/help 查看命令")
+
+	// 对话区从底部往上填，最新的在最下面
+	available := rows - len(header) - len(footer)
+	var body []string
+	lines := t.transcript
+	if t.partial.Text != "" {
+		lines = append(append([]tuiLine(nil), lines...), t.partial)
+	}
+	for i := len(lines) - 1; i >= 0 && len(body) < available; i-- {
+		wrapped := wrapDisplay(formatTUILine(lines[i], i == len(lines)-1 && t.partial.Text != ""), cols)
+		for j := len(wrapped) - 1; j >= 0 && len(body) < available; j-- {
+			body = append(body, wrapped[j])
+		}
+	}
+	for len(body) < available {
+		body = append(body, "")
+	}
+	for i, j := 0, len(body)-1; i < j; i, j = i+1, j-1 {
+		body[i], body[j] = body[j], body[i]
+	}
+
+	out := append(append(header, body...), footer...)
+	for i := range out {
+		out[i] = truncateDisplay(out[i], cols)
+	}
+	return out
+}
+
+// levelMeter 麦克风电平条，按对数刻度显示，| 为 VAD 阈值
+func (t *TUI) levelMeter(cols int) string {
+	label := fmt.Sprintf(" %5.0f / 阈值 %-5.0f", t.level, t.threshold)
+	barWidth := cols - displayWidth(label) - 10
+	if barWidth < 10 {
+		return " 麦克风" + label
+	}
+	scale := func(energy float64) int {
+		pos := int(math.Log10(1+energy) / math.Log10(32768) * float64(barWidth))
+		return max(0, min(pos, barWidth-1))
+	}
+	bar := []byte(strings.Repeat(" ", barWidth))
+	for i := 0; i <= scale(t.level) && t.level > 0; i++ {
+		bar[i] = '='
+	}
+	bar[scale(t.threshold)] = '|'
+	return " 麦克风 [" + string(bar) + "]" + label
+}
+
+// latencyLine 最近几轮的响应延迟，最新的在前
+func (t *TUI) latencyLine() string {
+	if len(t.latencies) == 0 {
+		return " 延迟 -"
+	}
+	var total time.Duration
+	for _, l := range t.latencies {
+		total += l.Latency
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, " 延迟 平均 %.2fs |", (total / time.Duration(len(t.latencies))).Seconds())
+	for i := len(t.latencies) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, " #%d %.2fs", t.latencies[i].TurnID, t.latencies[i].Latency.Seconds())
+	}
+	return b.String()
+}
+
+// formatTUILine 格式化对话行，partial 为尚未说出的预测文本
+func formatTUILine(line tuiLine, partial bool) string {
+	prefix := " " + line.At.Format("15:04:05") + " "
+	switch line.Role {
+	case "":
+		return prefix + line.Text
+	case SonicRoleUser:
+		prefix += "USER      "
+	default:
+		prefix += "ASSISTANT "
+	}
+	if partial {
+		return prefix + line.Text + " ..."
+	}
+	return prefix + line.Text
+}
+
+// runeWidth 字符在终端中占的列数，中日韩等宽字符占两列
+func runeWidth(r rune) int {
+	if r < 0x20 || r == 0x7f {
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// displayWidth 字符串在终端中占的列数
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// truncateDisplay 按显示宽度截断
+func truncateDisplay(s string, cols int) string {
+	n := 0
+	for i, r := range s {
+		w := runeWidth(r)
+		if n+w > cols {
+			return s[:i]
+		}
+		n += w
+	}
+	return s
+}
+
+// wrapDisplay 按显示宽度折行，续行缩进与时间戳对齐
+func wrapDisplay(s string, cols int) []string {
+	const indent = "          "
+	var lines []string
+	var line strings.Builder
+	n := 0
+	for _, r := range s {
+		w := runeWidth(r)
+		if n+w > cols {
+			lines = append(lines, line.String())
+			line.Reset()
+			line.WriteString(indent)
+			n = len(indent)
+		}
+		if w > 0 {
+			line.WriteRune(r)
+			n += w
+		}
+	}
+	return append(lines, line.String())
+}
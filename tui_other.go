@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// terminalSize 非 Unix 平台无法查询终端大小，固定为 24x80
+func terminalSize() (rows, cols int) {
+	return 24, 80
+}
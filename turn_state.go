@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TurnState 对话轮次状态
+type TurnState int
+
+const (
+	// TurnListening 空闲监听，等待用户开口
+	TurnListening TurnState = iota
+	// TurnUserSpeaking 用户正在说话
+	TurnUserSpeaking
+	// TurnWaitingModel 用户说完，等待模型回复
+	TurnWaitingModel
+	// TurnAssistantSpeaking AI 回复正在播放
+	TurnAssistantSpeaking
+	// TurnInterrupted AI 回复被打断（过渡状态）
+	TurnInterrupted
+	// TurnToolPending 模型发起了工具调用，等待工具结果
+	TurnToolPending
+)
+
+// String 返回状态名称
+func (s TurnState) String() string {
+	switch s {
+	case TurnListening:
+		return "listening"
+	case TurnUserSpeaking:
+		return "user_speaking"
+	case TurnWaitingModel:
+		return "waiting_model"
+	case TurnAssistantSpeaking:
+		return "assistant_speaking"
+	case TurnInterrupted:
+		return "interrupted"
+	case TurnToolPending:
+		return "tool_pending"
+	}
+	return fmt.Sprintf("TurnState(%d)", int(s))
+}
+
+// turnTransitions 合法的状态转换表
+var turnTransitions = map[TurnState][]TurnState{
+	TurnListening:         {TurnUserSpeaking, TurnWaitingModel, TurnAssistantSpeaking, TurnToolPending},
+	TurnUserSpeaking:      {TurnWaitingModel, TurnListening},
+	TurnWaitingModel:      {TurnAssistantSpeaking, TurnToolPending, TurnUserSpeaking, TurnListening},
+	TurnAssistantSpeaking: {TurnInterrupted, TurnToolPending, TurnListening},
+	TurnInterrupted:       {TurnUserSpeaking, TurnWaitingModel, TurnListening},
+	TurnToolPending:       {TurnWaitingModel, TurnAssistantSpeaking, TurnListening},
+}
+
+// TurnTransition 一次状态转换记录
+type TurnTransition struct {
+	From   TurnState
+	To     TurnState
+	TurnID int
+	At     time.Time
+	// Elapsed 在 From 状态停留的时长
+	Elapsed time.Duration
+	Reason  string
+}
+
+// TurnStateMachine 对话轮次状态机
+// 录音、播放和 Sonic 流都通过它协调当前谁在说话
+type TurnStateMachine struct {
+	mu          sync.Mutex
+	state       TurnState
+	enteredAt   time.Time
+	turnID      int
+	history     []TurnTransition
+	subscribers []func(TurnTransition)
+}
+
+// maxTurnHistory 保留的最近转换记录数
+const maxTurnHistory = 64
+
+// NewTurnStateMachine 创建状态机，初始状态为 TurnListening
+func NewTurnStateMachine() *TurnStateMachine {
+	return &TurnStateMachine{
+		state:     TurnListening,
+		enteredAt: time.Now(),
+	}
+}
+
+// State 获取当前状态
+func (m *TurnStateMachine) State() TurnState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Since 获取进入当前状态以来的时长
+func (m *TurnStateMachine) Since() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return time.Since(m.enteredAt)
+}
+
+// TurnID 获取当前轮次编号（每次用户开始说话时递增）
+func (m *TurnStateMachine) TurnID() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.turnID
+}
+
+// CanTransition 判断是否允许从当前状态转换到 to
+func (m *TurnStateMachine) CanTransition(to TurnState) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return canTransition(m.state, to)
+}
+
+func canTransition(from, to TurnState) bool {
+	for _, s := range turnTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition 转换到新状态，非法转换返回错误
+// 转换到当前状态视为无操作
+func (m *TurnStateMachine) Transition(to TurnState, reason string) error {
+	m.mu.Lock()
+	if m.state == to {
+		m.mu.Unlock()
+		return nil
+	}
+	if !canTransition(m.state, to) {
+		from := m.state
+		m.mu.Unlock()
+		return fmt.Errorf("非法状态转换 %s -> %s (%s)", from, to, reason)
+	}
+
+	t, subscribers := m.commitLocked(to, reason)
+	m.mu.Unlock()
+
+	// 在锁外通知订阅者，允许回调中查询状态
+	for _, fn := range subscribers {
+		fn(t)
+	}
+	return nil
+}
+
+// TransitionFrom 仅当前状态为 from 时转换到 to，返回是否发生了转换
+// 用于不应覆盖其他线程刚做出的转换的场景（检查和转换在同一把锁内完成）
+func (m *TurnStateMachine) TransitionFrom(from, to TurnState, reason string) bool {
+	m.mu.Lock()
+	if m.state != from || !canTransition(from, to) {
+		m.mu.Unlock()
+		return false
+	}
+	t, subscribers := m.commitLocked(to, reason)
+	m.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(t)
+	}
+	return true
+}
+
+// Subscribe 订阅状态转换，回调在执行转换的 goroutine 中同步调用，不应阻塞
+func (m *TurnStateMachine) Subscribe(fn func(TurnTransition)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscribers = append(m.subscribers, fn)
+}
+
+// History 获取最近的状态转换记录
+func (m *TurnStateMachine) History() []TurnTransition {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]TurnTransition{}, m.history...)
+}
+
+// CanSendAudio 守卫：工具调用未完成时不向模型发送新音频
+func (m *TurnStateMachine) CanSendAudio() bool {
+	return m.State() != TurnToolPending
+}
+
+// IsAssistantSpeaking 判断 AI 回复是否正在播放
+func (m *TurnStateMachine) IsAssistantSpeaking() bool {
+	return m.State() == TurnAssistantSpeaking
+}
+
+// CanPlayAssistantAudio 守卫：用户正在说话或刚打断时不播放 AI 音频
+func (m *TurnStateMachine) CanPlayAssistantAudio() bool {
+	switch m.State() {
+	case TurnUserSpeaking, TurnInterrupted:
+		return false
+	}
+	return true
+}
+
+// Reset 强制回到监听状态（用于会话重置），会通知订阅者
+func (m *TurnStateMachine) Reset(reason string) {
+	m.mu.Lock()
+	if m.state == TurnListening {
+		m.mu.Unlock()
+		return
+	}
+	t, subscribers := m.commitLocked(TurnListening, reason)
+	m.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(t)
+	}
+}
+
+// commitLocked 记录一次转换并返回需要通知的订阅者，调用方需持有锁
+func (m *TurnStateMachine) commitLocked(to TurnState, reason string) (TurnTransition, []func(TurnTransition)) {
+	now := time.Now()
+	if to == TurnUserSpeaking {
+		m.turnID++
+	}
+	t := TurnTransition{
+		From:    m.state,
+		To:      to,
+		TurnID:  m.turnID,
+		At:      now,
+		Elapsed: now.Sub(m.enteredAt),
+		Reason:  reason,
+	}
+	m.state = to
+	m.enteredAt = now
+	m.history = append(m.history, t)
+	if len(m.history) > maxTurnHistory {
+		m.history = m.history[len(m.history)-maxTurnHistory:]
+	}
+	return t, append([]func(TurnTransition){}, m.subscribers...)
+}
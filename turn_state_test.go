@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTurnStateMachineTransitions(t *testing.T) {
+	tests := []struct {
+		name string
+		path []TurnState
+		to   TurnState
+		ok   bool
+	}{
+		{"开始说话", nil, TurnUserSpeaking, true},
+		{"说完等待回复", []TurnState{TurnUserSpeaking}, TurnWaitingModel, true},
+		{"回复被打断", []TurnState{TurnUserSpeaking, TurnWaitingModel, TurnAssistantSpeaking}, TurnInterrupted, true},
+		{"工具结果后继续回复", []TurnState{TurnUserSpeaking, TurnWaitingModel, TurnToolPending}, TurnAssistantSpeaking, true},
+		{"转换到当前状态是无操作", []TurnState{TurnUserSpeaking}, TurnUserSpeaking, true},
+		{"监听中不能被打断", nil, TurnInterrupted, false},
+		{"用户说话时不能直接播放回复", []TurnState{TurnUserSpeaking}, TurnAssistantSpeaking, false},
+		{"播放时不能跳过打断直接说话", []TurnState{TurnUserSpeaking, TurnWaitingModel, TurnAssistantSpeaking}, TurnUserSpeaking, false},
+		{"工具调用中不能开始说话", []TurnState{TurnToolPending}, TurnUserSpeaking, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewTurnStateMachine()
+			for _, s := range tt.path {
+				mustTransition(t, m, s, "准备")
+			}
+			var notified []TurnTransition
+			m.Subscribe(func(tr TurnTransition) { notified = append(notified, tr) })
+			before, turnID, history := m.State(), m.TurnID(), len(m.History())
+
+			if got := m.CanTransition(tt.to); got != tt.ok && before != tt.to {
+				t.Errorf("CanTransition(%s) = %v, want %v", tt.to, got, tt.ok)
+			}
+			err := m.Transition(tt.to, "测试")
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("Transition(%s -> %s): %v", before, tt.to, err)
+				}
+				if m.State() != tt.to {
+					t.Errorf("状态 = %s, want %s", m.State(), tt.to)
+				}
+				return
+			}
+
+			// 非法转换报错，状态、轮次和记录都不变，也不通知订阅者
+			if err == nil {
+				t.Fatalf("Transition(%s -> %s) 应报错", before, tt.to)
+			}
+			if m.State() != before {
+				t.Errorf("非法转换后状态 = %s, want %s", m.State(), before)
+			}
+			if m.TurnID() != turnID || len(m.History()) != history {
+				t.Errorf("非法转换后轮次或记录被修改: turnID %d -> %d, history %d -> %d", turnID, m.TurnID(), history, len(m.History()))
+			}
+			if len(notified) != 0 {
+				t.Errorf("非法转换通知了订阅者: %+v", notified)
+			}
+			if m.TransitionFrom(before, tt.to, "测试") || m.State() != before {
+				t.Errorf("TransitionFrom 执行了非法转换")
+			}
+		})
+	}
+}
+
+func TestTurnStateMachineTurnID(t *testing.T) {
+	m := NewTurnStateMachine()
+	mustTransition(t, m, TurnUserSpeaking, "第一轮")
+	mustTransition(t, m, TurnWaitingModel, "说完")
+	mustTransition(t, m, TurnAssistantSpeaking, "回复")
+	mustTransition(t, m, TurnInterrupted, "打断")
+	mustTransition(t, m, TurnUserSpeaking, "第二轮")
+	if m.TurnID() != 2 {
+		t.Errorf("TurnID = %d, want 2", m.TurnID())
+	}
+
+	// TransitionFrom 只在当前状态匹配时转换
+	if m.TransitionFrom(TurnAssistantSpeaking, TurnListening, "过期的回复结束") {
+		t.Errorf("当前状态不匹配时不应转换")
+	}
+	if !m.TransitionFrom(TurnUserSpeaking, TurnWaitingModel, "说完") || m.State() != TurnWaitingModel {
+		t.Errorf("TransitionFrom 没有转换")
+	}
+
+	m.Reset("重置")
+	if m.State() != TurnListening {
+		t.Errorf("Reset 后状态 = %s", m.State())
+	}
+	if last := m.History()[len(m.History())-1]; last.From != TurnWaitingModel || last.To != TurnListening || last.Reason != "重置" {
+		t.Errorf("最后一次转换 = %+v", last)
+	}
+}
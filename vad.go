@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/binary"
 	"math"
+	"sync"
 )
 
 // VADState 语音活动检测状态
@@ -17,6 +18,19 @@ const (
 	StateSpeechEnd
 )
 
+// String 返回状态名称
+func (s VADState) String() string {
+	switch s {
+	case StateSilence:
+		return "silence"
+	case StateSpeech:
+		return "speech"
+	case StateSpeechEnd:
+		return "speech_end"
+	}
+	return "unknown"
+}
+
 // VADConfig VAD 配置参数
 type VADConfig struct {
 	// EnergyThreshold 能量阈值（RMS），用于判断是否为语音
@@ -43,11 +57,14 @@ func DefaultVADConfig() VADConfig {
 }
 
 // VADDetector 语音活动检测器
+// 录音回调中检测，阈值可以在其他线程中调整，mu 保护配置和状态
 type VADDetector struct {
+	mu            sync.Mutex
 	config        VADConfig
 	currentState  VADState
 	speechFrames  int // 连续语音帧计数
 	silenceFrames int // 连续静音帧计数
+	lastEnergy    float64
 }
 
 // NewVADDetector 创建新的 VAD 检测器
@@ -112,6 +129,9 @@ func (vad *VADDetector) DetectMulaw(mulawData []byte) VADState {
 
 // processEnergy 根据能量值处理状态转换
 func (vad *VADDetector) processEnergy(energy float64) VADState {
+	vad.mu.Lock()
+	defer vad.mu.Unlock()
+	vad.lastEnergy = energy
 	isSpeech := energy > vad.config.EnergyThreshold
 
 	switch vad.currentState {
@@ -157,6 +177,8 @@ func (vad *VADDetector) processEnergy(energy float64) VADState {
 
 // Reset 重置 VAD 状态
 func (vad *VADDetector) Reset() {
+	vad.mu.Lock()
+	defer vad.mu.Unlock()
 	vad.currentState = StateSilence
 	vad.speechFrames = 0
 	vad.silenceFrames = 0
@@ -164,16 +186,29 @@ func (vad *VADDetector) Reset() {
 
 // GetState 获取当前状态
 func (vad *VADDetector) GetState() VADState {
+	vad.mu.Lock()
+	defer vad.mu.Unlock()
 	return vad.currentState
 }
 
+// LastEnergy 获取最近一帧的 RMS 能量
+func (vad *VADDetector) LastEnergy() float64 {
+	vad.mu.Lock()
+	defer vad.mu.Unlock()
+	return vad.lastEnergy
+}
+
 // SetEnergyThreshold 动态调整能量阈值
 func (vad *VADDetector) SetEnergyThreshold(threshold float64) {
+	vad.mu.Lock()
+	defer vad.mu.Unlock()
 	vad.config.EnergyThreshold = threshold
 }
 
 // GetEnergyThreshold 获取当前能量阈值
 func (vad *VADDetector) GetEnergyThreshold() float64 {
+	vad.mu.Lock()
+	defer vad.mu.Unlock()
 	return vad.config.EnergyThreshold
 }
 
@@ -181,6 +216,8 @@ func (vad *VADDetector) GetEnergyThreshold() float64 {
 // noiseData: 环境噪音样本
 func (vad *VADDetector) CalibrateThreshold(noiseData []byte) {
 	noiseRMS := vad.CalculateRMS(noiseData)
+	vad.mu.Lock()
+	defer vad.mu.Unlock()
 	// 设置阈值为噪音的 3 倍
 	vad.config.EnergyThreshold = noiseRMS * 3.0
 }